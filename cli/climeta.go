@@ -15,6 +15,6 @@ var (
 )
 
 func init() {
-	nui := ui.NeuronUi{&ui.UiWriter{os.Stdout}}
+	nui := ui.NeuronUi{UiWriter: &ui.UiWriter{Writer: os.Stdout}}
 	cm = &cliMeta{&nui}
 }
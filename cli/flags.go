@@ -12,4 +12,52 @@ func registerFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVarP(&unpcker.Path, "path", "p", "", "path where the asset has to be created")
 	cmd.PersistentFlags().StringVarP(&unpcker.AssetVersion, "version", "v", "", "version the asset that needs to be packed")
 	cmd.PersistentFlags().StringVarP(&unpcker.ConfigPath, "config", "c", ".", "path where the config file exists")
+	cmd.PersistentFlags().StringVar(&unpcker.BackendURI, "backend", "", "URI of the backend such as gs://bucket/folder, overrides cloud, bucket and folder of the config file")
+}
+
+// Registering flags specific to generate command.
+func registerGenerateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&unpcker.Tags, "tag", "t", nil, "tags moved to the version of asset once it is stored, defaults to latest")
+	cmd.Flags().StringVarP(&unpcker.Format, "format", "f", "", "format in which the asset is packed, either stub or archive, defaults to stub")
+}
+
+// Registering flags specific to list command.
+func registerListFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&unpcker.Output, "output", "o", "table", "format in which the assets are listed, either table or json")
+}
+
+// Registering flags specific to prune command.
+func registerPruneFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&unpcker.DryRun, "dry-run", "d", false, "lists the versions which would be pruned without deleting them")
+	cmd.Flags().StringVarP(&unpcker.Output, "output", "o", "table", "format in which the pruned versions are listed, either table or json")
+}
+
+// Registering flags specific to promote command.
+func registerPromoteFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&unpcker.PromoteTo, "to", "t", "", "environment to which the asset has to be promoted")
+	cmd.Flags().StringVarP(&unpcker.FromEnvironment, "from", "f", "", "environment from which the asset has to be promoted, defaults to the one under which it was packed")
+	cmd.Flags().StringVarP(&unpcker.PromotedBy, "by", "b", "", "name recorded as the one who promoted the asset, defaults to the current user")
+	cmd.Flags().StringVarP(&unpcker.Output, "output", "o", "table", "format in which the promoted asset is listed, either table or json")
+}
+
+// Registering flags specific to inspect command.
+func registerInspectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&unpcker.InspectStub, "stub", "s", "", "path of the client stub or archive to be inspected in place of the asset stored in backend")
+	cmd.Flags().StringVarP(&unpcker.FromEnvironment, "from", "f", "", "environment to which the asset was promoted, defaults to the one under which it was packed")
+	cmd.Flags().StringVarP(&unpcker.Output, "output", "o", "table", "format in which the asset is inspected, either table or json")
+}
+
+// Registering flags specific to tag command.
+func registerTagFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&unpcker.FromEnvironment, "from", "f", "", "environment in which the asset to be tagged resides, defaults to the one under which it was packed")
+	cmd.Flags().StringVarP(&unpcker.PromotedBy, "by", "b", "", "name recorded as the one who tagged the asset, defaults to the current user")
+	cmd.Flags().BoolVarP(&unpcker.TagDelete, "delete", "d", false, "delete the tags instead of moving them")
+	cmd.Flags().StringVarP(&unpcker.Output, "output", "o", "table", "format in which the tags are listed, either table or json")
+}
+
+// Registering flags specific to share command.
+func registerShareFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&unpcker.ShareExpiryHours, "expiry", "x", 0, "number of hours for which the signed URL is valid, defaults to 1 and could be at most 168")
+	cmd.Flags().StringVarP(&unpcker.FromEnvironment, "from", "f", "", "environment to which the asset was promoted, defaults to the one under which it was packed")
+	cmd.Flags().StringVarP(&unpcker.Output, "output", "o", "table", "format in which the signed URL is listed, either table or json")
 }
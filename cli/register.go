@@ -44,9 +44,70 @@ func getUnpackkerCmds() *cobra.Command {
 		RunE:  versionConfig,
 	}
 
+	var listCmd = &cobra.Command{
+		Use:          "list [flags]",
+		Short:        "Command to list the versions of asset stored in the backend",
+		Long:         `This will help user to list all versions of the asset along with its size, upload time and metadata from the configured backend.`,
+		RunE:         unpcker.List,
+		SilenceUsage: true,
+	}
+
+	var pruneCmd = &cobra.Command{
+		Use:          "prune [flags]",
+		Short:        "Command to prune the versions of asset as per retention policy",
+		Long:         `This will help user to delete the versions of asset from the backend which are not retained by the retention policy configured.`,
+		RunE:         unpcker.Prune,
+		SilenceUsage: true,
+	}
+
+	var promoteCmd = &cobra.Command{
+		Use:          "promote [flags]",
+		Short:        "Command to promote the packed asset to other environment",
+		Long:         `This will help user to promote the already packed version of asset to other environment in the backend without packing it again.`,
+		RunE:         unpcker.Promote,
+		SilenceUsage: true,
+	}
+
+	var inspectCmd = &cobra.Command{
+		Use:          "inspect [flags]",
+		Short:        "Command to inspect the packed asset without unpacking it",
+		Long:         `This will help user to inspect the metadata, size, checksum, upload time, environment and version of the asset from the backend or from its client stub or archive.`,
+		RunE:         unpcker.Inspect,
+		SilenceUsage: true,
+	}
+
+	var tagCmd = &cobra.Command{
+		Use:          "tag [tags...] [flags]",
+		Short:        "Command to move the tags like latest or stable to a version of asset",
+		Long:         `This will help user to point the tags at the specified version of asset in the backend, so that it could be unpacked by the tag. Tags of the asset are listed when none is passed.`,
+		RunE:         unpcker.Tag,
+		SilenceUsage: true,
+	}
+
+	var shareCmd = &cobra.Command{
+		Use:          "share [flags]",
+		Short:        "Command to share the packed asset through a time-limited signed URL",
+		Long:         `This will help user to generate the signed URL of the asset in gcp, aws or azure, with which it could be unpacked without the credentials of the backend until the URL expires.`,
+		RunE:         unpcker.Share,
+		SilenceUsage: true,
+	}
+
 	unpackkerCmd.AddCommand(setCmd)
+	unpackkerCmd.AddCommand(listCmd)
+	unpackkerCmd.AddCommand(pruneCmd)
+	unpackkerCmd.AddCommand(promoteCmd)
+	unpackkerCmd.AddCommand(inspectCmd)
+	unpackkerCmd.AddCommand(tagCmd)
+	unpackkerCmd.AddCommand(shareCmd)
 	unpackkerCmd.AddCommand(versionCmd)
 	registerFlags(unpackkerCmd)
+	registerGenerateFlags(setCmd)
+	registerListFlags(listCmd)
+	registerPruneFlags(pruneCmd)
+	registerPromoteFlags(promoteCmd)
+	registerInspectFlags(inspectCmd)
+	registerTagFlags(tagCmd)
+	registerShareFlags(shareCmd)
 	return unpackkerCmd
 }
 
@@ -5,6 +5,7 @@ go 1.13
 require (
 	cloud.google.com/go v0.58.0 // indirect
 	cloud.google.com/go/storage v1.9.0
+	github.com/Masterminds/semver/v3 v3.1.0
 	github.com/aws/aws-sdk-go v1.31.13
 	github.com/caarlos0/env/v6 v6.3.0
 	github.com/go-bindata/go-bindata/v3 v3.1.3
@@ -13,8 +14,11 @@ require (
 	github.com/nikhilsbhat/config v0.0.0-20200302185303-75e52f31cf9b
 	github.com/nikhilsbhat/neuron v0.0.0-20191005183010-c891ed9d85ea
 	github.com/nikhilsbhat/terragen v0.0.1
+	github.com/pkg/sftp v1.11.0
 	github.com/spf13/cobra v0.0.5
+	golang.org/x/crypto v0.0.0-20200604202706-70a84ac30bf9
 	golang.org/x/net v0.0.0-20200602114024-627f9648deb9 // indirect
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	golang.org/x/sys v0.0.0-20200602225109-6fdc65e7d980 // indirect
 	golang.org/x/tools v0.0.0-20200608174601-1b747fd94509 // indirect
 	google.golang.org/api v0.26.0
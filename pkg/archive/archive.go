@@ -0,0 +1,387 @@
+// Package archive reads and writes the unpackker archive, the portable alternative to client stub which is packed and unpacked without go toolchain.
+//
+// Archive begins with Magic followed by the length of header as 4 bytes big endian, the header in json and the content of the files
+// listed in its manifest, in the same order, as single gzip stream.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+	"github.com/nikhilsbhat/unpackker/version"
+)
+
+const (
+	// Magic is the first line of every unpackker archive, by which it is told apart from the client stub.
+	Magic = "UNPACKKER-ARCHIVE\n"
+	// FormatVersion is the version of archive format written by this package, archives of newer format are not read.
+	FormatVersion = 1
+	// maxHeaderSize is the maximum size of the header, larger one is considered to be corrupt.
+	maxHeaderSize = 64 << 20
+)
+
+// Header describes the asset held in the archive along with the manifest of its files.
+type Header struct {
+	// FormatVersion is the version of archive format with which it was written.
+	FormatVersion int `json:"formatversion" yaml:"formatversion"`
+	// Name of the asset.
+	Name string `json:"name" yaml:"name"`
+	// Version of the asset.
+	Version string `json:"version" yaml:"version"`
+	// Environment under which the asset was packed.
+	Environment string `json:"environment" yaml:"environment"`
+	// MetaData of the asset.
+	MetaData map[string]string `json:"metadata" yaml:"metadata"`
+	// PackedAt is the time at which the archive was written.
+	PackedAt time.Time `json:"packedat" yaml:"packedat"`
+	// PackedWith is the version of unpackker which wrote the archive.
+	PackedWith string `json:"packedwith" yaml:"packedwith"`
+	// Files is the manifest of the files in the archive, in the order in which their content is written.
+	Files []*File `json:"files" yaml:"files"`
+}
+
+// File is the entry of a file in the manifest of archive.
+type File struct {
+	// Path of the file relative to the directory under which asset is unpacked, separated by slash.
+	Path string `json:"path" yaml:"path"`
+	// Mode holds the permissions of the file.
+	Mode os.FileMode `json:"mode" yaml:"mode"`
+	// Size of the file in bytes.
+	Size int64 `json:"size" yaml:"size"`
+	// Modified is the time at which the file was last modified, it is restored while unpacking.
+	Modified time.Time `json:"modified" yaml:"modified"`
+	// SHA256 of the content of file, which is verified while unpacking.
+	SHA256 string `json:"sha256" yaml:"sha256"`
+	source string
+}
+
+// Create writes the archive of the files under assetPath at archivePath, the files whose path matches any of ignore are left out.
+// Files are named relative to the directory holding assetPath, the same way the client stub names them, so that both unpack the asset alike.
+// Manifest of header is filled with the files archived, along with the format version, time and version of unpackker packing it.
+func Create(ctx context.Context, archivePath, assetPath string, ignore []*regexp.Regexp, header *Header) error {
+	target, err := filepath.Abs(archivePath)
+	if err != nil {
+		return err
+	}
+	files, err := collectFiles(assetPath, target, ignore)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if file.SHA256, err = helper.FileChecksum(file.source); err != nil {
+			return err
+		}
+	}
+
+	header.FormatVersion = FormatVersion
+	header.PackedAt = time.Now().UTC()
+	header.PackedWith = version.GetVersion()
+	header.Files = files
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return err
+	}
+	archive, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(archive)
+	if err := writeArchive(ctx, writer, encoded, files); err != nil {
+		archive.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		archive.Close()
+		return err
+	}
+	return archive.Close()
+}
+
+func writeArchive(ctx context.Context, w io.Writer, header []byte, files []*File) error {
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(header))); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	content := gzip.NewWriter(w)
+	for _, file := range files {
+		if err := writeFile(ctx, content, file); err != nil {
+			return err
+		}
+	}
+	return content.Close()
+}
+
+// writeFile writes the content of file, which should be the same as the one hashed into manifest.
+func writeFile(ctx context.Context, w io.Writer, file *File) error {
+	source, err := helper.OpenFile(file.source)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(w, hash), helper.ContextReader(ctx, source), file.Size); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("file %s changed while it was being archived", file.source)
+		}
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("file %s changed while it was being archived", file.source)
+	}
+	return nil
+}
+
+// collectFiles walks through assetPath in the order of names and returns the files which are not ignored, symlinks are followed.
+// The archive being written is skipped, incase it is under assetPath.
+func collectFiles(assetPath, archivePath string, ignore []*regexp.Regexp) ([]*File, error) {
+	info, err := os.Stat(assetPath)
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.ToSlash(helper.SplitBasePath(assetPath, "base"))
+	files := make([]*File, 0)
+	if !info.IsDir() {
+		return append(files, newFile(assetPath, prefix, info)), nil
+	}
+
+	visited := make(map[string]bool)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+		if visited[resolved] {
+			return nil
+		}
+		visited[resolved] = true
+
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entryPath := filepath.Join(dir, entry.Name())
+			if ignored(entryPath, ignore) {
+				continue
+			}
+			if absolute, err := filepath.Abs(entryPath); err == nil && absolute == archivePath {
+				continue
+			}
+			if entry.Mode()&os.ModeSymlink != 0 {
+				if entry, err = os.Stat(entryPath); err != nil {
+					return err
+				}
+			}
+			switch {
+			case entry.IsDir():
+				if err := walk(entryPath); err != nil {
+					return err
+				}
+			case entry.Mode().IsRegular():
+				files = append(files, newFile(entryPath, prefix, entry))
+			}
+		}
+		return nil
+	}
+	if err := walk(assetPath); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func newFile(source, prefix string, info os.FileInfo) *File {
+	name := strings.TrimPrefix(strings.TrimPrefix(filepath.ToSlash(source), prefix), "/")
+	return &File{
+		Path:     name,
+		Mode:     info.Mode().Perm(),
+		Size:     info.Size(),
+		Modified: info.ModTime().UTC(),
+		source:   source,
+	}
+}
+
+func ignored(filePath string, ignore []*regexp.Regexp) bool {
+	for _, pattern := range ignore {
+		if pattern.MatchString(filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsArchive reports whether the file at path is an unpackker archive.
+func IsArchive(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return string(magic) == Magic
+}
+
+// ReadHeader reads the header of the archive at path, without reading the content of its files.
+func ReadHeader(path string) (*Header, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readHeader(bufio.NewReader(file), path)
+}
+
+func readHeader(r io.Reader, path string) (*Header, error) {
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != Magic {
+		return nil, fmt.Errorf("%s is not an unpackker archive", path)
+	}
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("unable to read header of archive %s: %v", path, err)
+	}
+	if size > maxHeaderSize {
+		return nil, fmt.Errorf("header of archive %s is %d bytes, which is larger than %d bytes supported", path, size, maxHeaderSize)
+	}
+	encoded := make([]byte, size)
+	if _, err := io.ReadFull(r, encoded); err != nil {
+		return nil, fmt.Errorf("unable to read header of archive %s: %v", path, err)
+	}
+
+	header := new(Header)
+	if err := json.Unmarshal(encoded, header); err != nil {
+		return nil, fmt.Errorf("unable to decode header of archive %s: %v", path, err)
+	}
+	if header.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("archive %s is of format %d, which is newer than the format %d supported, upgrade unpackker to unpack it", path, header.FormatVersion, FormatVersion)
+	}
+	for _, file := range header.Files {
+		if !validPath(file.Path) {
+			return nil, fmt.Errorf("archive %s has file %q whose path is outside the asset", path, file.Path)
+		}
+	}
+	return header, nil
+}
+
+// validPath reports whether the path of file stays under the directory to which asset is unpacked.
+func validPath(name string) bool {
+	if len(name) == 0 || strings.Contains(name, "\\") || path.IsAbs(name) || path.Clean(name) != name {
+		return false
+	}
+	return name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// Extract unpacks the files of the archive at archivePath under dir, which should not exist already.
+// Files are written to a temporary directory next to dir and it is renamed to dir only after the checksum of every file is verified,
+// hence dir never holds partially unpacked asset. Unpacking is abandoned once ctx is done.
+func Extract(ctx context.Context, archivePath, dir string) (*Header, error) {
+	if helper.Statfile(dir) {
+		return nil, fmt.Errorf("asset was already unpacked at %s", dir)
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	reader := bufio.NewReader(archive)
+	header, err := readHeader(reader, archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, err
+	}
+	staging, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+"-")
+	if err != nil {
+		return nil, err
+	}
+	if err := extractFiles(ctx, reader, header, staging); err != nil {
+		os.RemoveAll(staging)
+		return nil, fmt.Errorf("unable to unpack archive %s: %w", archivePath, err)
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	return header, nil
+}
+
+func extractFiles(ctx context.Context, r io.Reader, header *Header, dir string) error {
+	content, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	for _, file := range header.Files {
+		if err := extractFile(helper.ContextReader(ctx, content), file, filepath.Join(dir, filepath.FromSlash(file.Path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, file *File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	extracted, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.Mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(extracted, hash), r, file.Size); err != nil {
+		extracted.Close()
+		if err == io.EOF {
+			return fmt.Errorf("content of %s is truncated", file.Path)
+		}
+		return err
+	}
+	if err := extracted.Close(); err != nil {
+		return err
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != file.SHA256 {
+		return fmt.Errorf("checksum %s of %s does not match %s recorded in manifest", checksum, file.Path, file.SHA256)
+	}
+	return os.Chtimes(target, file.Modified, file.Modified)
+}
@@ -0,0 +1,190 @@
+package archive_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/archive"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "unpackker-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeTestFiles writes the files under dir, named by their path relative to it.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeTestArchive writes the archive of header whose files hold the contents, as written by Create, without verifying either of them.
+func writeTestArchive(t *testing.T, archivePath string, header *archive.Header, contents ...string) {
+	t.Helper()
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(archive.Magic)
+	binary.Write(&buffer, binary.BigEndian, uint32(len(encoded)))
+	buffer.Write(encoded)
+	content := gzip.NewWriter(&buffer)
+	for _, file := range contents {
+		content.Write([]byte(file))
+	}
+	content.Close()
+	if err := ioutil.WriteFile(archivePath, buffer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testFile(path, content string) *archive.File {
+	sum := sha256.Sum256([]byte(content))
+	return &archive.File{Path: path, Mode: 0644, Size: int64(len(content)), Modified: time.Now().UTC(), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func TestCreateAndExtract(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	assetPath := filepath.Join(dir, "demo")
+	writeTestFiles(t, assetPath, map[string]string{
+		"README.md":         "demo asset",
+		"config/app.yaml":   "port: 8080",
+		".git/HEAD":         "ref: refs/heads/master",
+		"scripts/deploy.sh": "#!/bin/sh\necho deploy",
+	})
+	if err := os.Chmod(filepath.Join(assetPath, "scripts", "deploy.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(assetPath, "README.md"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive written under the asset itself is not archived.
+	archivePath := filepath.Join(assetPath, "demo_0_1_0.unpackker")
+	header := &archive.Header{Name: "demo", Version: "0.1.0", Environment: "production", MetaData: map[string]string{"team": "platform"}}
+	if err := archive.Create(context.Background(), archivePath, assetPath, []*regexp.Regexp{regexp.MustCompile(`/\.git(/|$)`)}, header); err != nil {
+		t.Fatal(err)
+	}
+	if !archive.IsArchive(archivePath) || archive.IsArchive(filepath.Join(assetPath, "README.md")) {
+		t.Fatal("archive was not told apart from the other files")
+	}
+
+	read, err := archive.ReadHeader(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(read.Files))
+	for _, file := range read.Files {
+		paths = append(paths, file.Path)
+	}
+	want := []string{"demo/README.md", "demo/config/app.yaml", "demo/scripts/deploy.sh"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected files %v to be archived, got %v", want, paths)
+	}
+	if read.Name != "demo" || read.Version != "0.1.0" || read.FormatVersion != archive.FormatVersion || read.MetaData["team"] != "platform" {
+		t.Errorf("header of archive was not read back, got %+v", read)
+	}
+
+	target := filepath.Join(dir, "unpacked")
+	if _, err := archive.Extract(context.Background(), archivePath, target); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(target, "demo", "config", "app.yaml"))
+	if err != nil || string(content) != "port: 8080" {
+		t.Errorf("content of file was not unpacked, got %q: %v", content, err)
+	}
+	if info, err := os.Stat(filepath.Join(target, "demo", "scripts", "deploy.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("mode of file was not restored: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(target, "demo", "README.md")); err != nil || !info.ModTime().Equal(modified) {
+		t.Errorf("modification time of file was not restored: %v", err)
+	}
+
+	if _, err := archive.Extract(context.Background(), archivePath, target); err == nil {
+		t.Errorf("expected unpacking over the asset already unpacked to fail")
+	}
+}
+
+func TestExtractRejectsInvalidArchives(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   *archive.Header
+		contents []string
+		err      string
+	}{
+		{"path outside asset", &archive.Header{FormatVersion: 1, Files: []*archive.File{testFile("../evil", "evil")}}, []string{"evil"}, "outside the asset"},
+		{"absolute path", &archive.Header{FormatVersion: 1, Files: []*archive.File{testFile("/etc/evil", "evil")}}, []string{"evil"}, "outside the asset"},
+		{"newer format", &archive.Header{FormatVersion: archive.FormatVersion + 1}, nil, "upgrade unpackker"},
+		{"content not matching checksum", &archive.Header{FormatVersion: 1, Files: []*archive.File{testFile("demo/app", "original")}}, []string{"tampered"}, "does not match"},
+		{"truncated content", &archive.Header{FormatVersion: 1, Files: []*archive.File{testFile("demo/app", "original")}}, []string{"orig"}, "truncated"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			archivePath := filepath.Join(dir, "demo.unpackker")
+			writeTestArchive(t, archivePath, test.header, test.contents...)
+
+			target := filepath.Join(dir, "unpacked", "demo")
+			_, err := archive.Extract(context.Background(), archivePath, target)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected unpacking to fail with %q, got %v", test.err, err)
+			}
+			if entries, _ := ioutil.ReadDir(filepath.Join(dir, "unpacked")); len(entries) != 0 {
+				t.Errorf("files of the archive which failed to unpack were left behind")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+				t.Errorf("file was written outside the directory asset is unpacked to")
+			}
+		})
+	}
+}
+
+func TestExtractStopsOnCancel(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	assetPath := filepath.Join(dir, "demo")
+	writeTestFiles(t, assetPath, map[string]string{"app": strings.Repeat("unpackker", 1<<10)})
+	archivePath := filepath.Join(dir, "demo.unpackker")
+	if err := archive.Create(context.Background(), archivePath, assetPath, nil, &archive.Header{Name: "demo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	target := filepath.Join(dir, "unpacked")
+	if _, err := archive.Extract(ctx, archivePath, target); err == nil {
+		t.Fatal("expected unpacking to be abandoned once cancelled")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("asset abandoned was partially unpacked")
+	}
+}
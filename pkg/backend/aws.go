@@ -0,0 +1,330 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Backend stores the asset in aws S3 or in any S3 compatible store.
+type s3Backend struct {
+	region      string
+	endpoint    string
+	bucket      string
+	kmsKey      string
+	customerKey string
+	partSize    int64
+	concurrency int
+	awsClient   *session.Session
+	awsBlobConn *s3.S3
+}
+
+func newS3Backend() Backend {
+	return &s3Backend{}
+}
+
+// Init initializes the session of aws with the credentials configured.
+func (c *s3Backend) Init(ctx context.Context, store *Store) error {
+	c.region = store.Region
+	c.endpoint = store.Endpoint
+	c.bucket = store.Bucket
+	c.partSize = store.partSize()
+	c.concurrency = store.concurrency()
+	if err := c.setEncryption(store.Encryption); err != nil {
+		return err
+	}
+	if err := c.getClient(ctx, store.CredentialPath, store.CredentialType, store.credentials()); err != nil {
+		return &CredentialError{Cloud: "aws", Type: store.CredentialType, Err: err}
+	}
+	c.awsBlobConn = s3.New(c.awsClient)
+	return nil
+}
+
+// setEncryption sets the key with which S3 encrypts the objects, either the KMS key or the key supplied with every request.
+func (c *s3Backend) setEncryption(encryption *Encryption) error {
+	if encryption == nil {
+		return nil
+	}
+	c.kmsKey = encryption.KMSKey
+	if len(encryption.CustomerKeyPath) != 0 {
+		key, err := readKey(encryption.CustomerKeyPath)
+		if err != nil {
+			return err
+		}
+		c.customerKey = string(key)
+	}
+	return nil
+}
+
+// getConfig returns the aws config with region and endpoint, the endpoint is set only when S3 compatible stores are used.
+func (c *s3Backend) getConfig() *aws.Config {
+	// Requests are retried by Store as per its Retry policy, retries of the SDK would multiply its attempts.
+	// Session is given a client of its own, as it sets the transport of AWS_CA_BUNDLE on the client it is given.
+	config := aws.NewConfig().WithMaxRetries(0).WithHTTPClient(&http.Client{})
+	if len(c.region) != 0 {
+		config = config.WithRegion(c.region)
+	}
+	if len(c.endpoint) != 0 {
+		config = config.WithEndpoint(c.endpoint).WithS3ForcePathStyle(true)
+	}
+	return config
+}
+
+// Exists checks for the object in S3 bucket.
+func (c *s3Backend) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := c.Stat(ctx, key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Put makes sure that the asset is stored to specified S3 bucket, assets larger than part size are stored with multipart upload.
+func (c *s3Backend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	asset, size, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	if size > c.partSize {
+		return c.putMultipart(ctx, key, path, meta)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(c.bucket),
+		Key:      aws.String(key),
+		Body:     asset,
+		Metadata: aws.StringMap(meta),
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = c.kmsEncryption()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = c.customerEncryption()
+	options := append(s3WriteOptions(ctx), s3ProgressOption(progressOf(ctx)))
+	_, err = c.awsBlobConn.PutObjectWithContext(ctx, input, options...)
+	if err != nil {
+		return s3WriteError(key, err)
+	}
+	return nil
+}
+
+// Get makes sure that the asset is fetched from specified aws S3 bucket onto the specified location.
+func (c *s3Backend) Get(ctx context.Context, key, path string) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = c.customerEncryption()
+	object, err := c.awsBlobConn.GetObjectWithContext(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return err
+	}
+	defer object.Body.Close()
+
+	return writeAsset(path, object.Body)
+}
+
+// GetRange reads the part of the object from S3 bucket.
+func (c *s3Backend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange(offset, length)),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = c.customerEncryption()
+	object, err := c.awsBlobConn.GetObjectWithContext(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+// List returns the objects under the prefix in S3 bucket, metadata is fetched for each of the object.
+func (c *s3Backend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	keys := make([]string, 0)
+	err := c.awsBlobConn.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*Object, 0, len(keys))
+	for _, key := range keys {
+		object, err := c.Stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// Delete removes the object from S3 bucket.
+func (c *s3Backend) Delete(ctx context.Context, key string) error {
+	exists, err := c.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	_, err = c.awsBlobConn.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Stat returns the attributes of the object stored in S3 bucket.
+func (c *s3Backend) Stat(ctx context.Context, key string) (*Object, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey = c.customerEncryption()
+	head, err := c.awsBlobConn.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	for name, value := range head.Metadata {
+		meta[strings.ToLower(name)] = aws.StringValue(value)
+	}
+	return &Object{
+		Key:      key,
+		Size:     aws.Int64Value(head.ContentLength),
+		Modified: aws.TimeValue(head.LastModified),
+		MetaData: meta,
+		ETag:     aws.StringValue(head.ETag),
+	}, nil
+}
+
+// SignedURL returns the pre-signed URL of the object in S3 bucket, it is valid until expiry elapses or the credentials that signed it expire.
+func (c *s3Backend) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if len(c.customerKey) != 0 {
+		return "", fmt.Errorf("object encrypted with customer key could not be fetched with signed URL, as the key has to be sent along with the request")
+	}
+	req, _ := c.awsBlobConn.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	req.SetContext(ctx)
+	return req.Presign(expiry)
+}
+
+// kmsEncryption returns the server side encryption and KMS key of the object to be written, nil if SSE-KMS is not configured.
+func (c *s3Backend) kmsEncryption() (*string, *string) {
+	if len(c.kmsKey) == 0 {
+		return nil, nil
+	}
+	return aws.String(s3.ServerSideEncryptionAwsKms), aws.String(c.kmsKey)
+}
+
+// customerEncryption returns the algorithm and key sent with the requests reading or writing the object, nil if SSE-C is not configured.
+// S3 SDK computes MD5 of the key on its own.
+func (c *s3Backend) customerEncryption() (*string, *string) {
+	if len(c.customerKey) == 0 {
+		return nil, nil
+	}
+	return aws.String(s3.ServerSideEncryptionAes256), aws.String(c.customerKey)
+}
+
+// s3WriteOptions returns the options of request writing the object, it carries If-None-Match precondition
+// when Put was asked to create the object only.
+func s3WriteOptions(ctx context.Context) []request.Option {
+	if !CreateOnly(ctx) {
+		return nil
+	}
+	return []request.Option{request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"})}
+}
+
+// s3ProgressOption accounts the body of request as stored while it is being sent. Body is read once before that by the SDK
+// to sign the request, which is left out by wrapping the body only once the request is signed.
+func s3ProgressOption(tracker *progressTracker) request.Option {
+	return func(r *request.Request) {
+		if tracker == nil {
+			return
+		}
+		r.Handlers.Send.PushFront(func(r *request.Request) {
+			if body := r.HTTPRequest.Body; body != nil && body != http.NoBody {
+				r.HTTPRequest.Body = &progressBody{Reader: tracker.reader(body), Closer: body}
+			}
+		})
+	}
+}
+
+// progressBody is the body of request whose bytes are accounted as stored as they are read.
+type progressBody struct {
+	io.Reader
+	io.Closer
+}
+
+// s3WriteError returns ErrAlreadyExists when the write was rejected by If-None-Match precondition,
+// S3 responds with conflict when other conditional write of the same key is in progress.
+func s3WriteError(key string, err error) error {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		if reqErr.StatusCode() == http.StatusPreconditionFailed || reqErr.Code() == "ConditionalRequestConflict" {
+			return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+		}
+	}
+	return err
+}
+
+// ClassifyError classifies the errors of S3 by their code, and by their status code when the code is not known.
+func (c *s3Backend) ClassifyError(err error) error {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return nil
+	}
+	switch awsErr.Code() {
+	case request.CanceledErrorCode:
+		return nil
+	case request.ErrCodeRequestError, request.ErrCodeResponseTimeout, request.ErrCodeSerialization,
+		"SlowDown", "Throttling", "ThrottlingException", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return ErrTransient
+	case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken":
+		return ErrPermissionDenied
+	case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket:
+		return ErrNotFound
+	}
+	if reqErr, ok := awsErr.(awserr.RequestFailure); ok {
+		return classifyStatus(reqErr.StatusCode())
+	}
+	return nil
+}
+
+func isS3NotFound(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// getClient initializes the session of aws with the credentials of the type configured, see Credentials for the types.
+// Credentials are retrieved once here with ctx, so that the misconfigured ones are reported before the asset is touched.
+func (c *s3Backend) getClient(ctx context.Context, credsPath, credstype string, options *Credentials) error {
+	creds, err := c.getCredentials(credsPath, credstype, options)
+	if err != nil {
+		return err
+	}
+
+	// Profile is picked from shared config only when credentials are left to the session.
+	profile := ""
+	config := c.getConfig()
+	if creds != nil {
+		config = config.WithCredentials(creds)
+	} else {
+		profile = options.Profile
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return fmt.Errorf("aws.NewSession: %v", err)
+	}
+	if _, err := sess.Config.Credentials.GetWithContext(ctx); err != nil {
+		return err
+	}
+	c.awsClient = sess
+	return nil
+}
+
+// getCredentials returns the credentials of the type, nil leaves them to be resolved by the credential chain of session.
+func (c *s3Backend) getCredentials(credsPath, credstype string, options *Credentials) (*credentials.Credentials, error) {
+	switch credstype {
+	case "default":
+		return nil, nil
+	case "file":
+		profile := options.Profile
+		if len(profile) == 0 {
+			profile = "default"
+		}
+		return credentials.NewSharedCredentials(credsPath, profile), nil
+	case "profile":
+		if len(options.Profile) == 0 {
+			return nil, fmt.Errorf("profile has to be set with 'profile' of credentials")
+		}
+		if len(credsPath) == 0 {
+			return nil, nil
+		}
+		sess, err := c.stsSession(options, credsPath)
+		if err != nil {
+			return nil, err
+		}
+		return sess.Config.Credentials, nil
+	case "env":
+		return credentials.NewEnvCredentials(), nil
+	case "assumerole":
+		if len(options.RoleARN) == 0 {
+			return nil, fmt.Errorf("role to be assumed has to be set with 'rolearn' of credentials")
+		}
+		sess, err := c.stsSession(options)
+		if err != nil {
+			return nil, err
+		}
+		return stscreds.NewCredentials(sess, options.RoleARN, func(provider *stscreds.AssumeRoleProvider) {
+			provider.RoleSessionName = options.sessionName()
+			if len(options.ExternalID) != 0 {
+				provider.ExternalID = aws.String(options.ExternalID)
+			}
+		}), nil
+	case "webidentity":
+		roleARN := firstSet(options.RoleARN, os.Getenv("AWS_ROLE_ARN"))
+		tokenPath := firstSet(credsPath, options.TokenPath, os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+		if len(roleARN) == 0 || len(tokenPath) == 0 {
+			return nil, fmt.Errorf("role and token file have to be set either with 'rolearn' and 'tokenpath' of credentials or with AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+		}
+		sess, err := c.stsSession(&Credentials{})
+		if err != nil {
+			return nil, err
+		}
+		return stscreds.NewWebIdentityCredentials(sess, roleARN, options.sessionName(), tokenPath), nil
+	}
+	return nil, fmt.Errorf("unsupported aws client initialization")
+}
+
+// stsSession returns the session with which the role is assumed. It is not pointed at Endpoint, which is of the S3 compatible store.
+func (c *s3Backend) stsSession(options *Credentials, sharedConfigFiles ...string) (*session.Session, error) {
+	config := aws.NewConfig().WithHTTPClient(&http.Client{})
+	if len(c.region) != 0 {
+		config = config.WithRegion(c.region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		Profile:           options.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+		SharedConfigFiles: sharedConfigFiles,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aws.NewSession: %v", err)
+	}
+	return sess, nil
+}
+
+// firstSet returns the first of the values that is set.
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if len(value) != 0 {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,174 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	// s3MinPartSize is the minimum size of the parts of multipart upload except the last one.
+	s3MinPartSize = 5 << 20
+	// s3MaxParts is the maximum number of parts of multipart upload.
+	s3MaxParts = 10000
+)
+
+// putMultipart stores the asset with multipart upload, where the parts are uploaded concurrently.
+// Upload is left open on failure, so that the next attempt uploads only the parts which are not listed by S3 for it,
+// unless ctx was cancelled in which case the upload is aborted.
+func (c *s3Backend) putMultipart(ctx context.Context, key, assetPath string, meta map[string]string) error {
+	asset, err := helper.OpenFile(assetPath)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+	info, err := asset.Stat()
+	if err != nil {
+		return err
+	}
+
+	partSize := c.multipartSize(info.Size())
+	statePath := uploadStatePath(assetPath, "s3", c.bucket)
+	state := loadUploadState(statePath, key, info.Size(), meta, partSize)
+	if err := c.resumeUpload(ctx, state, statePath, meta); err != nil {
+		return err
+	}
+
+	tracker := progressOf(ctx)
+	count := partCount(info.Size(), partSize)
+	pending := make([]int, 0, count)
+	for part := 0; part < count; part++ {
+		if _, ok := state.Parts[part]; ok {
+			_, length := partRange(part, info.Size(), partSize)
+			tracker.resume(length)
+			continue
+		}
+		pending = append(pending, part)
+	}
+
+	var mu sync.Mutex
+	err = runParts(ctx, c.concurrency, pending, func(ctx context.Context, part int) error {
+		offset, length := partRange(part, info.Size(), partSize)
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String(c.bucket),
+			Key:           aws.String(key),
+			UploadId:      aws.String(state.UploadID),
+			PartNumber:    aws.Int64(int64(part + 1)),
+			Body:          io.NewSectionReader(asset, offset, length),
+			ContentLength: aws.Int64(length),
+		}
+		input.SSECustomerAlgorithm, input.SSECustomerKey = c.customerEncryption()
+		out, err := c.awsBlobConn.UploadPartWithContext(ctx, input, s3ProgressOption(tracker))
+		if err != nil {
+			return fmt.Errorf("unable to upload part %d of %s: %w", part+1, key, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		state.Parts[part] = aws.StringValue(out.ETag)
+		return state.save(statePath)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			c.abortUpload(ctx, state, statePath)
+		}
+		return err
+	}
+
+	completed := make([]*s3.CompletedPart, count)
+	for part := range completed {
+		completed[part] = &s3.CompletedPart{ETag: aws.String(state.Parts[part]), PartNumber: aws.Int64(int64(part + 1))}
+	}
+	_, err = c.awsBlobConn.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(c.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	}, s3WriteOptions(ctx)...)
+	if err != nil {
+		if err := s3WriteError(key, err); errors.Is(err, ErrAlreadyExists) {
+			// Asset was stored by another upload, parts of this one would never be completed.
+			c.abortUpload(ctx, state, statePath)
+			return err
+		}
+		if ctx.Err() != nil {
+			c.abortUpload(ctx, state, statePath)
+		}
+		return fmt.Errorf("unable to complete multipart upload of %s: %w", key, err)
+	}
+	removeUploadState(statePath)
+	return nil
+}
+
+// abortUpload aborts the multipart upload recorded in state so that S3 drops its parts, and removes the state.
+func (c *s3Backend) abortUpload(ctx context.Context, state *uploadState, statePath string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	c.awsBlobConn.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(c.bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	})
+	removeUploadState(statePath)
+}
+
+// resumeUpload picks the parts S3 holds for the upload recorded in state, a new upload is created if there is none.
+func (c *s3Backend) resumeUpload(ctx context.Context, state *uploadState, statePath string, meta map[string]string) error {
+	if len(state.UploadID) != 0 {
+		parts := make(map[int]string)
+		err := c.awsBlobConn.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+			Bucket:   aws.String(c.bucket),
+			Key:      aws.String(state.Key),
+			UploadId: aws.String(state.UploadID),
+		}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+			for _, uploaded := range page.Parts {
+				part := int(aws.Int64Value(uploaded.PartNumber)) - 1
+				if _, length := partRange(part, state.Size, state.PartSize); aws.Int64Value(uploaded.Size) == length {
+					parts[part] = aws.StringValue(uploaded.ETag)
+				}
+			}
+			return true
+		})
+		if err == nil {
+			state.Parts = parts
+			return state.save(statePath)
+		}
+		if !isS3NotFound(err) {
+			return err
+		}
+	}
+
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(state.Key),
+		ContentType: aws.String("application/octet-stream"),
+		Metadata:    aws.StringMap(meta),
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId = c.kmsEncryption()
+	input.SSECustomerAlgorithm, input.SSECustomerKey = c.customerEncryption()
+	out, err := c.awsBlobConn.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("unable to create multipart upload of %s: %w", state.Key, err)
+	}
+	state.UploadID = aws.StringValue(out.UploadId)
+	state.Parts = make(map[int]string)
+	return state.save(statePath)
+}
+
+// multipartSize returns the part size within the limits of S3, it is raised for the assets that would otherwise need more than s3MaxParts.
+func (c *s3Backend) multipartSize(size int64) int64 {
+	partSize := c.partSize
+	if partSize < s3MinPartSize {
+		partSize = s3MinPartSize
+	}
+	if minimum := (size + s3MaxParts - 1) / s3MaxParts; partSize < minimum {
+		partSize = minimum
+	}
+	return partSize
+}
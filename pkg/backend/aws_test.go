@@ -0,0 +1,579 @@
+package backend_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+// testS3 is the in-memory S3 serving the subset of its API used by the aws backend, addressed path style.
+type testS3 struct {
+	mu      sync.Mutex
+	objects map[string]*testS3Object
+	uploads map[string]*testS3Upload
+	server  *httptest.Server
+	// requests are the operations served, named by method and the query identifying them such as PUT?partNumber.
+	requests []string
+	// fail is consulted for every request, status and code of the error returned for it are served instead when status is set.
+	fail func(operation string) (int, string)
+	// accessKey is the access key the last request was signed with.
+	accessKey string
+}
+
+type testS3Object struct {
+	content  []byte
+	header   http.Header
+	modified time.Time
+}
+
+// testS3Upload is the multipart upload in progress, header is the one of request which created it.
+type testS3Upload struct {
+	header http.Header
+	parts  map[int][]byte
+}
+
+func newTestS3() *testS3 {
+	os.Setenv("AWS_ACCESS_KEY_ID", "unpackker")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "unpackker")
+	s3 := &testS3{objects: make(map[string]*testS3Object), uploads: make(map[string]*testS3Upload)}
+	s3.server = httptest.NewServer(s3)
+	return s3
+}
+
+// uri returns the backend URI of the folder in the bucket of stand-in.
+func (s *testS3) uri(folder string) string {
+	return fmt.Sprintf("s3://unpackker/%s?endpoint=%s&region=us-east-1&credstype=env", folder, s.server.URL)
+}
+
+// count returns the number of requests served for the operation.
+func (s *testS3) count(operation string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, served := range s.requests {
+		if served == operation {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *testS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if credential := strings.SplitN(r.Header.Get("Authorization"), "Credential=", 2); len(credential) == 2 {
+		s.accessKey = strings.SplitN(credential[1], "/", 2)[0]
+	}
+	operation := r.Method
+	for _, name := range []string{"uploads", "uploadId", "partNumber", "list-type"} {
+		if _, ok := r.URL.Query()[name]; ok {
+			operation = r.Method + "?" + name
+		}
+	}
+	s.requests = append(s.requests, operation)
+	if s.fail != nil {
+		if status, code := s.fail(operation); status != 0 {
+			s.error(w, status, code)
+			return
+		}
+	}
+
+	key := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(key) != 2 {
+		s.list(w, r.URL.Query().Get("prefix"))
+		return
+	}
+	object, exists := s.objects[key[1]]
+	query := r.URL.Query()
+	switch operation {
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			s.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("ETag", s.store(key[1], content, r.Header))
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			s.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for name, values := range object.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+		content := object.content
+		if ranged := r.Header.Get("Range"); len(ranged) != 0 {
+			bounds := strings.SplitN(strings.TrimPrefix(ranged, "bytes="), "-", 2)
+			start, _ := strconv.Atoi(bounds[0])
+			end, _ := strconv.Atoi(bounds[1])
+			content = content[start : end+1]
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(object.content)))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key[1])
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost + "?uploads":
+		id := strconv.Itoa(len(s.requests))
+		s.uploads[id] = &testS3Upload{header: r.Header, parts: make(map[int][]byte)}
+		s.xml(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: id})
+	case http.MethodPut + "?partNumber":
+		upload, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[number], _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("ETag", testETag(upload.parts[number]))
+	case http.MethodGet + "?uploadId":
+		upload, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		type part struct {
+			PartNumber int
+			ETag       string
+			Size       int
+		}
+		listed := struct {
+			XMLName xml.Name `xml:"ListPartsResult"`
+			Parts   []part   `xml:"Part"`
+		}{}
+		for number, content := range upload.parts {
+			listed.Parts = append(listed.Parts, part{number, testETag(content), len(content)})
+		}
+		sort.Slice(listed.Parts, func(i, j int) bool { return listed.Parts[i].PartNumber < listed.Parts[j].PartNumber })
+		s.xml(w, listed)
+	case http.MethodPost + "?uploadId":
+		upload, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			s.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		completed := struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}{}
+		xml.NewDecoder(r.Body).Decode(&completed)
+		content := make([]byte, 0)
+		for _, part := range completed.Parts {
+			if testETag(upload.parts[part.PartNumber]) != part.ETag {
+				s.error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			content = append(content, upload.parts[part.PartNumber]...)
+		}
+		delete(s.uploads, query.Get("uploadId"))
+		s.xml(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			ETag    string
+		}{ETag: s.store(key[1], content, upload.header)})
+	case http.MethodDelete + "?uploadId":
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// store stores the object along with the metadata headers of request which created it.
+func (s *testS3) store(key string, content []byte, header http.Header) string {
+	stored := &testS3Object{content: content, header: make(http.Header), modified: time.Now()}
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			stored.header[name] = values
+		}
+	}
+	stored.header.Set("ETag", testETag(content))
+	s.objects[key] = stored
+	return testETag(content)
+}
+
+func (s *testS3) list(w http.ResponseWriter, prefix string) {
+	type content struct {
+		Key          string
+		Size         int
+		ETag         string
+		LastModified string
+	}
+	listed := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		IsTruncated bool
+		Contents    []content
+	}{}
+	for key, object := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			listed.Contents = append(listed.Contents, content{key, len(object.content), testETag(object.content), object.modified.UTC().Format(time.RFC3339)})
+		}
+	}
+	sort.Slice(listed.Contents, func(i, j int) bool { return listed.Contents[i].Key < listed.Contents[j].Key })
+	s.xml(w, listed)
+}
+
+func (s *testS3) xml(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(body)
+}
+
+func (s *testS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func testETag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// TestS3Conformance runs against the bucket set in UNPACKKER_TEST_S3, for instance of minio:
+// s3://unpackker/ci?endpoint=http://localhost:9000&region=us-east-1 with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY set.
+func TestS3Conformance(t *testing.T) {
+	backendtest.Run(t, emulatorStore(t, "UNPACKKER_TEST_S3"))
+}
+
+func TestS3ConformanceWithStandIn(t *testing.T) {
+	s3 := newTestS3()
+	defer s3.server.Close()
+	store, err := backend.Parse(s3.uri("assets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendtest.Run(t, store)
+}
+
+func TestS3MultipartUploadResumes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+	parts := 0
+	s3.fail = func(operation string) (int, string) {
+		if operation == http.MethodPut+"?partNumber" {
+			if parts++; parts == 2 {
+				return http.StatusBadRequest, "InvalidRequest"
+			}
+		}
+		return 0, ""
+	}
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 11<<20)
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", assetPath)
+	store.PartSizeMB, store.Concurrency = 5, 1
+	progress := make([]backend.Progress, 0)
+	store.OnProgress = func(event backend.Progress) {
+		progress = append(progress, event)
+	}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err == nil {
+		t.Fatal("upload of asset succeeded even though its part failed")
+	}
+	if states, _ := filepath.Glob(assetPath + ".*.upload.state"); len(states) != 1 {
+		t.Fatalf("state of the failed upload was not retained: %v", states)
+	}
+
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	if uploads := s3.count(http.MethodPost + "?uploads"); uploads != 1 {
+		t.Errorf("failed upload was not resumed, %d uploads were created", uploads)
+	}
+	if uploaded := s3.count(http.MethodPut + "?partNumber"); uploaded != 4 {
+		t.Errorf("expected the part uploaded by failed upload to not be uploaded again, %d parts were uploaded for 3 parts", uploaded)
+	}
+	if states, _ := filepath.Glob(assetPath + ".*.upload.state"); len(states) != 0 {
+		t.Errorf("state of the completed upload was left behind: %v", states)
+	}
+	if last := progress[len(progress)-1]; last.Transferred != last.Total {
+		t.Errorf("last progress reported %d of %d bytes", last.Transferred, last.Total)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+}
+
+func TestS3RetriesTransientErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+	puts := 0
+	s3.fail = func(operation string) (int, string) {
+		if operation == http.MethodPut {
+			if puts++; puts < 3 {
+				return http.StatusServiceUnavailable, "SlowDown"
+			}
+		}
+		return 0, ""
+	}
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 3, BackoffMS: 1, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatalf("asset was not stored on retrying the throttled upload: %v", err)
+	}
+	if puts := s3.count(http.MethodPut); puts != 3 {
+		t.Errorf("expected upload to be attempted 3 times, it was attempted %d times", puts)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+}
+
+func TestS3DoesNotRetryDeniedRequests(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+	s3.fail = func(operation string) (int, string) {
+		if operation == http.MethodPut {
+			return http.StatusForbidden, "AccessDenied"
+		}
+		return 0, ""
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 3, BackoffMS: 1, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); !errors.Is(err, backend.ErrPermissionDenied) {
+		t.Fatalf("expected upload to be denied, got %v", err)
+	}
+	if puts := s3.count(http.MethodPut); puts != 1 {
+		t.Errorf("denied upload was attempted %d times", puts)
+	}
+}
+
+func TestS3RejectsVersionStoredMeanwhile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+	s3.fail = func(operation string) (int, string) {
+		// Another run stores the same version after this one checked for it.
+		if operation == http.MethodPut {
+			s3.store("assets/demo_0_1_0", []byte("stored meanwhile"), nil)
+		}
+		return 0, ""
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); !errors.Is(err, backend.ErrAlreadyExists) {
+		t.Fatalf("expected upload of version stored meanwhile to be rejected, got %v", err)
+	}
+	if content := s3.objects["assets/demo_0_1_0"].content; string(content) != "stored meanwhile" {
+		t.Errorf("version stored meanwhile was overwritten")
+	}
+}
+
+func TestS3LeavesDefaultClientUntouched(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	bundle := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("AWS_CA_BUNDLE", os.Getenv("AWS_CA_BUNDLE"))
+	os.Setenv("AWS_CA_BUNDLE", bundle)
+
+	transport := http.DefaultClient.Transport
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", "")
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if http.DefaultClient.Transport != transport {
+		t.Errorf("CA bundle of aws was set on http.DefaultClient, which is shared by the other backends")
+	}
+}
+
+// testSTS is the stand-in of aws STS issuing the credentials of the roles assumed, named after the action they are issued by.
+type testSTS struct {
+	mu     sync.Mutex
+	server *httptest.Server
+	// requests are the actions served along with the parameters identifying the role and the session.
+	requests []string
+}
+
+func newTestSTS() *testSTS {
+	sts := &testSTS{}
+	sts.server = httptest.NewServer(sts)
+	return sts
+}
+
+func (s *testSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	action := r.PostForm.Get("Action")
+	request := strings.Join([]string{action, r.PostForm.Get("RoleArn"), r.PostForm.Get("RoleSessionName")}, " ")
+	switch action {
+	case "AssumeRole":
+		request += " external " + r.PostForm.Get("ExternalId")
+	case "AssumeRoleWithWebIdentity":
+		request += " token " + r.PostForm.Get("WebIdentityToken")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, request)
+	fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult><Credentials><AccessKeyId>%[1]s</AccessKeyId><SecretAccessKey>unpackker</SecretAccessKey>`+
+		`<SessionToken>unpackker</SessionToken><Expiration>%[2]s</Expiration></Credentials></%[1]sResult></%[1]sResponse>`,
+		action, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+}
+
+// redirect sends the requests meant for the endpoints of aws to the stand-in, it returns the function restoring http.DefaultTransport.
+func (s *testSTS) redirect() func() {
+	restore := http.DefaultTransport
+	target, _ := url.Parse(s.server.URL)
+	http.DefaultTransport = testRoundTripper(func(req *http.Request) (*http.Response, error) {
+		if !strings.HasSuffix(req.URL.Hostname(), ".amazonaws.com") {
+			return restore.RoundTrip(req)
+		}
+		redirected := req.Clone(req.Context())
+		redirected.URL.Scheme, redirected.URL.Host, redirected.Host = target.Scheme, target.Host, target.Host
+		return restore.RoundTrip(redirected)
+	})
+	return func() {
+		http.DefaultTransport = restore
+	}
+}
+
+type testRoundTripper func(req *http.Request) (*http.Response, error)
+
+func (f testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestS3Credentials(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+	sts := newTestSTS()
+	defer sts.server.Close()
+	defer sts.redirect()()
+	for _, name := range []string{"AWS_CA_BUNDLE", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_PROFILE"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	sharedCredentials := filepath.Join(dir, "credentials")
+	sharedConfig := filepath.Join(dir, "config")
+	token := filepath.Join(dir, "token")
+	for path, content := range map[string]string{
+		sharedCredentials: "[deployer]\naws_access_key_id = file\naws_secret_access_key = unpackker\n",
+		sharedConfig:      "[profile deployer]\naws_access_key_id = profile\naws_secret_access_key = unpackker\n",
+		token:             "web-identity",
+	} {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const role = "arn:aws:iam::123456789012:role/deployer"
+
+	tests := []struct {
+		name        string
+		credsType   string
+		credsPath   string
+		credentials *backend.Credentials
+		// accessKey is the one requests are expected to be signed with, the credentials are expected to be rejected when empty.
+		accessKey string
+		assumed   []string
+	}{
+		{"env", "env", "", nil, "unpackker", nil},
+		{"default", "default", "", nil, "unpackker", nil},
+		{"file", "file", sharedCredentials, &backend.Credentials{Profile: "deployer"}, "file", nil},
+		{"file without profile present", "file", sharedCredentials, nil, "", nil},
+		{"file without credspath", "file", "", nil, "unpackker", nil},
+		{"profile", "profile", sharedConfig, &backend.Credentials{Profile: "deployer"}, "profile", nil},
+		{"profile without profile", "profile", sharedConfig, nil, "", nil},
+		{"assumerole", "assumerole", "", &backend.Credentials{RoleARN: role, ExternalID: "ci"}, "AssumeRole",
+			[]string{"AssumeRole " + role + " unpackker external ci"}},
+		{"assumerole without role", "assumerole", "", nil, "", nil},
+		{"webidentity", "webidentity", token, &backend.Credentials{RoleARN: role, SessionName: "deploy"}, "AssumeRoleWithWebIdentity",
+			[]string{"AssumeRoleWithWebIdentity " + role + " deploy token web-identity"}},
+		{"webidentity without token", "webidentity", "", &backend.Credentials{RoleARN: role}, "", nil},
+		{"unsupported", "vault", sharedCredentials, nil, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s3.accessKey, sts.requests = "", nil
+			store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", "")
+			store.CredentialType, store.CredentialPath, store.Credentials = test.credsType, test.credsPath, test.credentials
+			err := store.InitBackend()
+			if len(test.accessKey) == 0 {
+				var credErr *backend.CredentialError
+				if !errors.As(err, &credErr) || credErr.Cloud != "aws" || credErr.Type != test.credsType {
+					t.Fatalf("expected %s credentials to be rejected, got %v", test.credsType, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists, err := store.Backend().Exists(context.Background(), "assets/demo_0_1_0"); err != nil || exists {
+				t.Fatalf("expected asset not to exist, got %v: %v", exists, err)
+			}
+			if s3.accessKey != test.accessKey {
+				t.Errorf("expected requests to be signed with %s access key, got %q", test.accessKey, s3.accessKey)
+			}
+			if !reflect.DeepEqual(sts.requests, test.assumed) {
+				t.Errorf("expected role to be assumed by %v, got %v", test.assumed, sts.requests)
+			}
+		})
+	}
+}
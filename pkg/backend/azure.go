@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// azureBackend stores the asset in azure blob storage, Store.Bucket is the container and Store.Folder the blob prefix.
+type azureBackend struct {
+	endpoint    string
+	container   string
+	azureClient *azureBlobClient
+}
+
+func newAzureBackend() Backend {
+	return &azureBackend{}
+}
+
+// Init initializes the client of azure blob storage with the credentials configured.
+func (c *azureBackend) Init(ctx context.Context, store *Store) error {
+	c.endpoint = store.Endpoint
+	c.container = store.Bucket
+	if err := c.getClient(store.CredentialPath, store.CredentialType); err != nil {
+		return err
+	}
+	if store.Encryption != nil {
+		c.azureClient.encryptionScope = store.Encryption.Scope
+	}
+	return nil
+}
+
+func (c *azureBackend) getClient(credsPath, credstype string) error {
+	account, err := readAzureAccount(credsPath, credstype)
+	if err != nil {
+		return err
+	}
+
+	client, err := newAzureBlobClient(account, credstype, c.endpoint)
+	if err != nil {
+		return err
+	}
+	c.azureClient = client
+	return nil
+}
+
+// Exists checks for the blob in azure container.
+func (c *azureBackend) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := c.Stat(ctx, key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Put makes sure that the asset is stored to specified azure container.
+func (c *azureBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	asset, size, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	// Block blob is committed only once it is completely uploaded, hence partially written asset is never visible.
+	err = c.azureClient.putBlob(ctx, c.container, key, progressOf(ctx).reader(asset), size, meta, CreateOnly(ctx))
+	if azErr, ok := err.(*azureError); ok && (azErr.StatusCode == http.StatusConflict || azErr.StatusCode == http.StatusPreconditionFailed) {
+		return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+	}
+	return err
+}
+
+// Get makes sure that the asset is fetched from specified azure container onto the specified location.
+func (c *azureBackend) Get(ctx context.Context, key, path string) error {
+	rc, err := c.azureClient.getBlob(ctx, c.container, key)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return err
+	}
+	defer rc.Close()
+
+	return writeAsset(path, rc)
+}
+
+// GetRange reads the part of the blob from azure container.
+func (c *azureBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := c.azureClient.getBlobRange(ctx, c.container, key, offset, length)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return rc, nil
+}
+
+// List returns the blobs under the prefix in azure container.
+func (c *azureBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	blobs, err := c.azureClient.listBlobs(ctx, c.container, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*Object, 0, len(blobs))
+	for _, blob := range blobs {
+		modified, _ := time.Parse(http.TimeFormat, blob.Properties.LastModified)
+		objects = append(objects, &Object{
+			Key:      blob.Name,
+			Size:     blob.Properties.ContentLength,
+			Modified: modified,
+			MetaData: blob.Metadata,
+		})
+	}
+	return objects, nil
+}
+
+// Delete removes the blob from azure container.
+func (c *azureBackend) Delete(ctx context.Context, key string) error {
+	if err := c.azureClient.deleteBlob(ctx, c.container, key); err != nil {
+		if isAzureNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Stat returns the properties and metadata of the blob stored in azure container.
+func (c *azureBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	header, meta, err := c.azureClient.getBlobProperties(ctx, c.container, key)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	size, _ := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	modified, _ := time.Parse(http.TimeFormat, header.Get("Last-Modified"))
+	return &Object{
+		Key:      key,
+		Size:     size,
+		Modified: modified,
+		MetaData: meta,
+		ETag:     header.Get("ETag"),
+	}, nil
+}
+
+// SignedURL returns the URL of the blob with service SAS granting read access to it until expiry elapses.
+func (c *azureBackend) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return c.azureClient.blobSAS(c.container, key, time.Now().Add(expiry))
+}
+
+func isAzureNotFound(err error) bool {
+	if azErr, ok := err.(*azureError); ok && azErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	return false
+}
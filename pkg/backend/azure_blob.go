@@ -0,0 +1,422 @@
+package backend
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	azureAPIVersion       = "2019-12-12"
+	azureMetaHeaderPrefix = "x-ms-meta-"
+)
+
+// azureBlobClient is a minimal client of Azure Blob Storage REST API, it supports both shared-key and SAS authorization.
+type azureBlobClient struct {
+	account  string
+	key      []byte
+	sasToken url.Values
+	endpoint *url.URL
+	client   *http.Client
+	// encryptionScope with which the blobs are encrypted, account default is used if not set.
+	encryptionScope string
+}
+
+// azureAccount holds the credentials of storage account read from the credential file.
+type azureAccount struct {
+	AccountName string `json:"accountname" yaml:"accountname"`
+	AccountKey  string `json:"accountkey" yaml:"accountkey"`
+	SASToken    string `json:"sastoken" yaml:"sastoken"`
+}
+
+// azureBlobList is the response of list blobs operation.
+type azureBlobList struct {
+	Blobs      []azureBlob `xml:"Blobs>Blob"`
+	NextMarker string      `xml:"NextMarker"`
+}
+
+// azureBlob is a blob entry in the response of list blobs operation.
+type azureBlob struct {
+	Name       string `xml:"Name"`
+	Properties struct {
+		LastModified  string `xml:"Last-Modified"`
+		ContentLength int64  `xml:"Content-Length"`
+	} `xml:"Properties"`
+	Metadata azureMetadata `xml:"Metadata"`
+}
+
+// azureMetadata decodes the metadata of blob, where each of the element name is the key of metadata.
+type azureMetadata map[string]string
+
+func (m *azureMetadata) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	meta := make(azureMetadata)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &element); err != nil {
+				return err
+			}
+			meta[strings.ToLower(element.Name.Local)] = value
+		case xml.EndElement:
+			*m = meta
+			return nil
+		}
+	}
+}
+
+// azureError is returned when blob service responds with an unexpected status.
+type azureError struct {
+	StatusCode int
+	Code       string
+}
+
+func (e *azureError) Error() string {
+	if len(e.Code) == 0 {
+		return fmt.Sprintf("azure blob service responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("azure blob service responded with status %d: %s", e.StatusCode, e.Code)
+}
+
+func (e *azureError) statusCode() int {
+	return e.StatusCode
+}
+
+// readAzureAccount reads the storage account details either from credential file or from environment variables.
+func readAzureAccount(credsPath, credstype string) (*azureAccount, error) {
+	account := new(azureAccount)
+	if credstype == "default" {
+		account.AccountName = os.Getenv("AZURE_STORAGE_ACCOUNT")
+		account.AccountKey = os.Getenv("AZURE_STORAGE_KEY")
+		account.SASToken = os.Getenv("AZURE_STORAGE_SAS_TOKEN")
+		if len(account.AccountName) == 0 {
+			return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT has to be set when default credentials are used for azure")
+		}
+		return account, nil
+	}
+
+	content, err := ioutil.ReadFile(credsPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, account); err != nil {
+		return nil, fmt.Errorf("unable to decode azure credential file %s: %v", credsPath, err)
+	}
+	if len(account.AccountName) == 0 {
+		return nil, fmt.Errorf("accountname is missing in azure credential file %s", credsPath)
+	}
+	return account, nil
+}
+
+// newAzureBlobClient returns the client of the storage account, endpoint defaults to public azure cloud.
+func newAzureBlobClient(account *azureAccount, credstype, endpoint string) (*azureBlobClient, error) {
+	if len(endpoint) == 0 {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", account.AccountName)
+	}
+	endpointURL, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure endpoint %s: %v", endpoint, err)
+	}
+
+	client := &azureBlobClient{account: account.AccountName, endpoint: endpointURL, client: http.DefaultClient}
+	switch credstype {
+	case "sas":
+		if len(account.SASToken) == 0 {
+			return nil, fmt.Errorf("sastoken is required for azure credential type sas")
+		}
+	case "sharedkey":
+		if len(account.AccountKey) == 0 {
+			return nil, fmt.Errorf("accountkey is required for azure credential type sharedkey")
+		}
+	case "default":
+		if len(account.AccountKey) == 0 && len(account.SASToken) == 0 {
+			return nil, fmt.Errorf("either AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN has to be set for azure")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported azure client initialization")
+	}
+
+	if len(account.AccountKey) != 0 && credstype != "sas" {
+		key, err := base64.StdEncoding.DecodeString(account.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("azure account key is not a valid base64 string: %v", err)
+		}
+		client.key = key
+		return client, nil
+	}
+
+	sas, err := url.ParseQuery(strings.TrimPrefix(account.SASToken, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure sas token: %v", err)
+	}
+	client.sasToken = sas
+	return client, nil
+}
+
+// blobURL returns the URL of the blob under the container.
+func (c *azureBlobClient) blobURL(container, blob string) *url.URL {
+	blobURL := *c.endpoint
+	blobURL.Path = path.Join(c.endpoint.Path, container, blob)
+	return &blobURL
+}
+
+// blobSAS returns the URL of the blob along with service SAS granting read access to it until expiry, signed with the account key.
+func (c *azureBlobClient) blobSAS(container, blob string, expiry time.Time) (string, error) {
+	if len(c.key) == 0 {
+		return "", fmt.Errorf("signed URL of azure blob could be generated only with account key, set credstype to sharedkey")
+	}
+
+	expires := expiry.UTC().Format("2006-01-02T15:04:05Z")
+	canonicalResource := "/blob/" + c.account + "/" + container + "/" + blob
+	// Fields of service SAS are signed in this order, the ones not set are left empty.
+	stringToSign := strings.Join([]string{
+		"r", "", expires, canonicalResource, "", "", "", azureAPIVersion, "b", "", "", "", "", "", "",
+	}, "\n")
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(stringToSign))
+
+	query := url.Values{}
+	query.Set("sv", azureAPIVersion)
+	query.Set("sr", "b")
+	query.Set("sp", "r")
+	query.Set("se", expires)
+	query.Set("sig", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	blobURL := c.blobURL(container, blob)
+	blobURL.RawQuery = query.Encode()
+	return blobURL.String(), nil
+}
+
+// putBlob uploads the content as block blob along with the metadata, blob is not overwritten if createOnly is set.
+func (c *azureBlobClient) putBlob(ctx context.Context, container, blob string, body io.Reader, length int64, meta map[string]string, createOnly bool) error {
+	header := make(http.Header)
+	header.Set("x-ms-blob-type", "BlockBlob")
+	header.Set("Content-Type", "application/octet-stream")
+	if createOnly {
+		header.Set("If-None-Match", "*")
+	}
+	if len(c.encryptionScope) != 0 {
+		header.Set("x-ms-encryption-scope", c.encryptionScope)
+	}
+	for key, value := range meta {
+		header.Set(azureMetaHeaderPrefix+key, value)
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, c.blobURL(container, blob), header, body, length)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// getBlob returns the reader of blob content, the caller has to close it.
+func (c *azureBlobClient) getBlob(ctx context.Context, container, blob string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.blobURL(container, blob), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// getBlobRange returns the reader of length bytes of blob content starting at offset, the caller has to close it.
+func (c *azureBlobClient) getBlobRange(ctx context.Context, container, blob string, offset, length int64) (io.ReadCloser, error) {
+	header := make(http.Header)
+	header.Set("Range", byteRange(offset, length))
+
+	resp, err := c.do(ctx, http.MethodGet, c.blobURL(container, blob), header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// getBlobProperties returns the system properties and metadata of the blob.
+func (c *azureBlobClient) getBlobProperties(ctx context.Context, container, blob string) (http.Header, map[string]string, error) {
+	resp, err := c.do(ctx, http.MethodHead, c.blobURL(container, blob), nil, nil, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	meta := make(map[string]string)
+	for key, values := range resp.Header {
+		name := strings.ToLower(key)
+		if strings.HasPrefix(name, azureMetaHeaderPrefix) && len(values) != 0 {
+			meta[strings.TrimPrefix(name, azureMetaHeaderPrefix)] = values[0]
+		}
+	}
+	return resp.Header, meta, nil
+}
+
+// deleteBlob deletes the blob from the container.
+func (c *azureBlobClient) deleteBlob(ctx context.Context, container, blob string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.blobURL(container, blob), nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// listBlobs lists all the blobs along with its metadata from the container whose name begins with prefix.
+func (c *azureBlobClient) listBlobs(ctx context.Context, container, prefix string) ([]azureBlob, error) {
+	blobs := make([]azureBlob, 0)
+	marker := ""
+	for {
+		listURL := c.blobURL(container, "")
+		query := url.Values{}
+		query.Set("restype", "container")
+		query.Set("comp", "list")
+		query.Set("include", "metadata")
+		if len(prefix) != 0 {
+			query.Set("prefix", prefix)
+		}
+		if len(marker) != 0 {
+			query.Set("marker", marker)
+		}
+		listURL.RawQuery = query.Encode()
+
+		resp, err := c.do(ctx, http.MethodGet, listURL, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		result := new(azureBlobList)
+		err = xml.NewDecoder(resp.Body).Decode(result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode blob list of container %s: %v", container, err)
+		}
+
+		blobs = append(blobs, result.Blobs...)
+		if len(result.NextMarker) == 0 {
+			return blobs, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// do sends the request to blob service and returns error if the response is not successful.
+func (c *azureBlobClient) do(ctx context.Context, method string, reqURL *url.URL, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	if c.sasToken != nil {
+		query := reqURL.Query()
+		for key, values := range c.sasToken {
+			query[key] = values
+		}
+		reqURL.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequest(method, reqURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.ContentLength = length
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+
+	if c.key != nil {
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", c.account, c.signature(req)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		return nil, &azureError{StatusCode: resp.StatusCode, Code: resp.Header.Get("x-ms-error-code")}
+	}
+	return resp, nil
+}
+
+// signature computes the shared key signature of the request as documented by azure storage services.
+func (c *azureBlobClient) signature(req *http.Request) string {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"",
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		c.canonicalHeaders(req.Header) + c.canonicalResource(req.URL),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, c.key)
+	_, _ = mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *azureBlobClient) canonicalHeaders(header http.Header) string {
+	names := make([]string, 0)
+	values := make(map[string]string)
+	for key, value := range header {
+		name := strings.ToLower(key)
+		if strings.HasPrefix(name, "x-ms-") {
+			names = append(names, name)
+			values[name] = strings.TrimSpace(strings.Join(value, ","))
+		}
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+	return canonical.String()
+}
+
+func (c *azureBlobClient) canonicalResource(reqURL *url.URL) string {
+	var canonical strings.Builder
+	canonical.WriteString("/" + c.account + reqURL.EscapedPath())
+
+	query := make(map[string][]string)
+	for name, values := range reqURL.Query() {
+		name = strings.ToLower(name)
+		query[name] = append(query[name], values...)
+	}
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		canonical.WriteString("\n" + name + ":" + strings.Join(values, ","))
+	}
+	return canonical.String()
+}
@@ -0,0 +1,260 @@
+package backend_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+const (
+	// testAzureAccount and testAzureKey are the well-known development account of azurite.
+	testAzureAccount = "devstoreaccount1"
+	testAzureKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// testAzure is the in-memory blob service serving the subset of its API used by the azure backend.
+// Requests are authorized by shared key signature of the development account, or by the SAS token it expects.
+type testAzure struct {
+	mu     sync.Mutex
+	blobs  map[string]*testAzureBlob
+	server *httptest.Server
+	sas    string
+	// fail is consulted for every request, status of the error returned for it is served instead when it is set.
+	fail func(method string) int
+}
+
+type testAzureBlob struct {
+	content  []byte
+	meta     map[string]string
+	modified time.Time
+}
+
+func newTestAzure() *testAzure {
+	azure := &testAzure{blobs: make(map[string]*testAzureBlob), sas: "sv=2019-12-12&sig=unpackker"}
+	azure.server = httptest.NewServer(azure)
+	return azure
+}
+
+// uri returns the backend URI of the folder in the container of stand-in.
+func (a *testAzure) uri(folder string) string {
+	return fmt.Sprintf("azblob://unpackker/%s?endpoint=%s/%s", folder, a.server.URL, testAzureAccount)
+}
+
+func (a *testAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.authorized(r) {
+		a.error(w, http.StatusForbidden, "AuthenticationFailed")
+		return
+	}
+	if a.fail != nil {
+		if status := a.fail(r.Method); status != 0 {
+			a.error(w, status, "ServerBusy")
+			return
+		}
+	}
+
+	name := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"+testAzureAccount+"/"), "/", 2)
+	if r.URL.Query().Get("comp") == "list" {
+		a.list(w, r.URL.Query().Get("prefix"))
+		return
+	}
+	blob, exists := a.blobs[name[1]]
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			a.error(w, http.StatusConflict, "BlobAlreadyExists")
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		stored := &testAzureBlob{content: content, meta: make(map[string]string), modified: time.Now()}
+		for header := range r.Header {
+			if strings.HasPrefix(strings.ToLower(header), "x-ms-meta-") {
+				stored.meta[strings.ToLower(strings.TrimPrefix(strings.ToLower(header), "x-ms-meta-"))] = r.Header.Get(header)
+			}
+		}
+		a.blobs[name[1]] = stored
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			a.error(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		for key, value := range blob.meta {
+			w.Header().Set("x-ms-meta-"+key, value)
+		}
+		w.Header().Set("Last-Modified", blob.modified.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, blob.modified.UnixNano()))
+		content := blob.content
+		if ranged := r.Header.Get("Range"); len(ranged) != 0 {
+			bounds := strings.SplitN(strings.TrimPrefix(ranged, "bytes="), "-", 2)
+			start, _ := strconv.Atoi(bounds[0])
+			end, _ := strconv.Atoi(bounds[1])
+			content = content[start : end+1]
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	case http.MethodDelete:
+		if !exists {
+			a.error(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(a.blobs, name[1])
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		a.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// authorized verifies either the SAS token or the shared key signature of request, as documented by azure storage services.
+func (a *testAzure) authorized(r *http.Request) bool {
+	if sig := r.URL.Query().Get("sig"); len(sig) != 0 {
+		return strings.Contains(a.sas, "sig="+sig)
+	}
+
+	headers := make([]string, 0)
+	for name := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-") {
+			headers = append(headers, strings.ToLower(name)+":"+r.Header.Get(name)+"\n")
+		}
+	}
+	sort.Strings(headers)
+	query := make([]string, 0)
+	for name, values := range r.URL.Query() {
+		sort.Strings(values)
+		query = append(query, "\n"+strings.ToLower(name)+":"+strings.Join(values, ","))
+	}
+	sort.Strings(query)
+	length := ""
+	if r.ContentLength > 0 {
+		length = strconv.FormatInt(r.ContentLength, 10)
+	}
+	stringToSign := strings.Join([]string{
+		r.Method, "", "", length, "", r.Header.Get("Content-Type"), "", "", "",
+		r.Header.Get("If-None-Match"), "", r.Header.Get("Range"),
+		strings.Join(headers, "") + "/" + testAzureAccount + r.URL.EscapedPath() + strings.Join(query, ""),
+	}, "\n")
+	key, _ := base64.StdEncoding.DecodeString(testAzureKey)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return r.Header.Get("Authorization") == "SharedKey "+testAzureAccount+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *testAzure) list(w http.ResponseWriter, prefix string) {
+	names := make([]string, 0)
+	for name := range a.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	fmt.Fprint(w, "<EnumerationResults><Blobs>")
+	for _, name := range names {
+		blob := a.blobs[name]
+		fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Content-Length>%d</Content-Length></Properties><Metadata>",
+			name, blob.modified.UTC().Format(http.TimeFormat), len(blob.content))
+		for key, value := range blob.meta {
+			fmt.Fprintf(w, "<%s>", key)
+			xml.EscapeText(w, []byte(value))
+			fmt.Fprintf(w, "</%s>", key)
+		}
+		fmt.Fprint(w, "</Metadata></Blob>")
+	}
+	fmt.Fprint(w, "</Blobs><NextMarker/></EnumerationResults>")
+}
+
+func (a *testAzure) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+}
+
+// TestAzureConformance runs against the container set in UNPACKKER_TEST_AZBLOB, for instance of azurite:
+// azblob://unpackker/ci?endpoint=http://127.0.0.1:10000/devstoreaccount1 with AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY set.
+func TestAzureConformance(t *testing.T) {
+	backendtest.Run(t, emulatorStore(t, "UNPACKKER_TEST_AZBLOB"))
+}
+
+func TestAzureConformanceWithStandIn(t *testing.T) {
+	azure := newTestAzure()
+	defer azure.server.Close()
+	os.Setenv("AZURE_STORAGE_ACCOUNT", testAzureAccount)
+	os.Setenv("AZURE_STORAGE_KEY", testAzureKey)
+	store, err := backend.Parse(azure.uri("assets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendtest.Run(t, store)
+}
+
+func TestAzureStoresWithSASToken(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	azure := newTestAzure()
+	defer azure.server.Close()
+
+	credsPath := filepath.Join(dir, "azure.yaml")
+	if err := ioutil.WriteFile(credsPath, []byte("accountname: "+testAzureAccount+"\nsastoken: ?"+azure.sas+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, azure.uri("assets")+"&credstype=sas&credspath="+credsPath, "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+}
+
+func TestAzureRetriesBusyService(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	azure := newTestAzure()
+	defer azure.server.Close()
+	os.Setenv("AZURE_STORAGE_ACCOUNT", testAzureAccount)
+	os.Setenv("AZURE_STORAGE_KEY", testAzureKey)
+	puts := 0
+	azure.fail = func(method string) int {
+		if method == http.MethodPut {
+			if puts++; puts == 1 {
+				return http.StatusServiceUnavailable
+			}
+		}
+		return 0
+	}
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, azure.uri("assets"), "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 2, BackoffMS: 1, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatalf("asset was not stored on retrying the busy service: %v", err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+}
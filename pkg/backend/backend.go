@@ -3,25 +3,49 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
 
-	"cloud.google.com/go/storage"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	// MetaDataVersion is the metadata key under which the version of the asset is stored.
+	MetaDataVersion = "assetversion"
+	// MetaDataEnvironment is the metadata key under which the environment of the asset is stored.
+	MetaDataEnvironment = "environment"
+	// MetaDataPromotedFrom is the metadata key under which the environment from which asset was promoted is stored.
+	MetaDataPromotedFrom = "promotedfrom"
+	// MetaDataPromotedBy is the metadata key under which the user who promoted the asset is stored.
+	MetaDataPromotedBy = "promotedby"
+	// MetaDataPromotedAt is the metadata key under which the time at which the asset was promoted is stored.
+	MetaDataPromotedAt = "promotedat"
 )
 
 // Store helps one to specify where the artifact should be tranported, default to local.
+// It could as well be configured with the URI of backend, see Parse.
 type Store struct {
+	// URI of the backend such as gs://bucket/folder, it sets Cloud, Bucket and Folder when specified.
+	URI string `json:"uri" yaml:"uri" env:"UNPACKKER_BACKEND"`
 	// Name of the asset which has to be either uploaded or downloaded.
 	Name string `json:"name" yaml:"name"`
 	// Cloud name of the bucket to which asset belongs to.
 	Cloud string `json:"cloud" yaml:"cloud"`
 	// Bucket name in appropriate cloud for asset store.
+	// Incase of fs it is the root directory of the asset store, asset is left where it was packed if not set.
+	// Incase of http it is the base URL of the repository in artifact server.
 	Bucket string `json:"bucket" yaml:"bucket"`
 	// Folder under which the asset has to be placed.
 	Folder string `json:"folder" yaml:"folder"`
+	// Environment is the namespace under Folder in which the asset resides, assets promoted to an environment are placed under it.
+	// It is not set for the assets that are stored by generate.
+	Environment string `json:"environment" yaml:"environment"`
 	// Path to the asset which has to be store on to cloud.
 	Path string `json:"path" yaml:"path"`
 	// TargetPath refers to path where the asset has to be fetched to.
@@ -29,29 +53,43 @@ type Store struct {
 	// Path to cloud credentail file, 'service-account.json' incase of gcp.
 	CredentialPath string `json:"credspath" yaml:"credspath" env:"UNPACKKER_CREDENTIAL_PATH"`
 	// CredentialType of for cloud config. Unpackker supports two type, default and file type.
+	// Aws and gcp support few more types configured with Credentials, see Credentials for them.
+	// Azure supports sharedkey and sas types, where credential file holds accountname along with accountkey or sastoken.
+	// Http supports basic and bearer types, where credential file holds username and password or the token.
+	// Sftp supports key and agent types, where credential file is the private key.
 	// It defaults to default config.
 	CredentialType string `json:"credstype" yaml:"credstype" env:"UNPACKKER_CREDENTIAL_TYPE"`
+	// Credentials holds the options of credential types of aws and gcp, such as profile, role to be assumed or service account to be impersonated.
+	Credentials *Credentials `json:"credentials" yaml:"credentials"`
 	// SkipRemoteCheck would skip feature which avoids pushing asset which is present at backend.
 	SkipRemoteCheck bool `json:"skipremotecheck" yaml:"skipremotecheck"`
 	// Region where the bucket resides.
 	Region string `json:"region" yaml:"region" env:"UNPACKKER_CLOUD_REGION"`
+	// Endpoint overrides the default endpoint of the cloud storage, set this while using S3 compatible stores.
+	// Incase of gcp it is the JSON API endpoint of the emulator such as http://localhost:4443/storage/v1/, set along with STORAGE_EMULATOR_HOST.
+	// Incase of sftp it is the address of the server as [user@]host[:port].
+	Endpoint string `json:"endpoint" yaml:"endpoint" env:"UNPACKKER_CLOUD_ENDPOINT"`
+	// Headers are the custom headers sent with every request of http backend.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// PartSizeMB is the size in MiB of the parts in which the asset is fetched, or stored to gcp and aws, defaults to 16.
+	// Assets larger than it are stored in parts, which are resumed if the upload is interrupted.
+	PartSizeMB int `json:"partsizemb" yaml:"partsizemb"`
+	// Concurrency is the number of parts fetched or stored in parallel, defaults to 4.
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+	// Encryption holds the keys with which asset is encrypted at rest, either by the cloud or on client side before it is stored.
+	Encryption *Encryption `json:"encryption" yaml:"encryption"`
+	// Retry is the policy with which the operations failing with transient errors of the backend, such as 5xx responses,
+	// throttling and connection resets, are retried. Operations are attempted thrice by default.
+	Retry *Retry `json:"retry" yaml:"retry"`
+	// Cache is the local directory from which the fetched assets are served once their revision is confirmed with the backend.
+	Cache *Cache `json:"cache" yaml:"cache"`
+	// OnProgress is invoked with the progress of the asset being stored, at most once a second and once it is stored.
+	OnProgress func(Progress) `json:"-" yaml:"-"`
 	// Metadata of the asset that would be stored.
 	MetaData   map[string]string `json:"metadata" yaml:"metadata"`
 	sourcePath string
-	gcpCreds   *gcpCredentials
-	awsCreds   *awsCredentials
-	// azureCreds can be added when unpackker supports azure as backend.
-}
-
-type gcpCredentials struct {
-	ctx         context.Context
-	gcpClient   *storage.Client
-	gcpBlobConn *storage.ObjectHandle
-}
-
-type awsCredentials struct {
-	awsClient   *session.Session
-	awsBlobConn *s3.S3
+	appliedURI string
+	backend    Backend
 }
 
 // New returns new config of Store.
@@ -59,85 +97,262 @@ func New() *Store {
 	return &Store{}
 }
 
-// newGCPCreds returns new instance of gcpCredentials.
-func newGCPCreds() *gcpCredentials {
-	return &gcpCredentials{}
-}
-
-// newAWSCreds returns new instance of awsCredentials.
-func newAWSCreds() *awsCredentials {
-	return &awsCredentials{}
-}
-
 // InitBackend initializes backend for Unpackker to store or retrieve the packed asset.
+// Backend is not reached when Cache is offline, only FetchAsset and Resolve could be used then.
 func (b *Store) InitBackend() error {
+	return b.InitBackendWithContext(context.Background())
+}
+
+// InitBackendWithContext is InitBackend whose requests to the backend, such as the ones retrieving credentials, are cancelled along with ctx.
+// Backend initialized outlives ctx.
+func (b *Store) InitBackendWithContext(ctx context.Context) error {
 	if err := b.validate(); err != nil {
 		return err
 	}
-	if b.Cloud == "fs" {
+	if b.Cache.offline() {
 		return nil
 	}
-	if err := b.getClient(); err != nil {
+
+	backend, err := getBackend(b.Cloud)
+	if err != nil {
+		return err
+	}
+	err = b.Retry.do(ctx, backend, func(ctx context.Context) error {
+		return backend.Init(ctx, b)
+	})
+	if err != nil {
 		return err
 	}
+	b.backend = &retryBackend{Backend: backend, policy: b.Retry}
 	return nil
 }
 
 // StoreAsset stores the packed asset at specified location.
 // Make sure that InitBackend is invoked before calling this.
 func (b *Store) StoreAsset() error {
-	if b.Cloud == "fs" {
-		return nil
-	}
+	return b.StoreAssetWithContext(context.Background())
+}
 
-	b.Name = filepath.Join(b.Folder, b.Name)
-	if err := b.connectBucket(); err != nil {
-		return err
+// StoreAssetWithContext is StoreAsset which is abandoned once ctx is done. Unlike the upload that failed, the one cancelled is not
+// resumed by the next attempt, the parts it stored are discarded from the backend along with its state.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) StoreAssetWithContext(ctx context.Context) error {
+	if b.backend == nil {
+		return fmt.Errorf("unable to store asset, backend was not initialized")
 	}
 
-	object, err := b.objectExists()
+	object, err := b.backend.Exists(ctx, b.key())
 	if err != nil {
-		if err == storage.ErrObjectNotExist {
-			fmt.Println(ui.Info("Looks like object is not present we are creating one\n"))
-		} else {
-			return err
-		}
+		return err
 	}
 	if !b.SkipRemoteCheck {
 		if object {
-			return fmt.Errorf("asset with current version already exists at the backend as %s", b.Name)
+			return fmt.Errorf("asset with current version already exists at the backend as %s: %w", b.key(), ErrAlreadyExists)
 		}
+		// Check above only saves uploading the asset which would be rejected, it is the conditional write that
+		// keeps the concurrent runs publishing the same version from overwriting each other.
+		ctx = WithCreateOnly(ctx)
 	}
 
-	if err := b.storeAsset(); err != nil {
+	assetPath := b.Path
+	if b.Encryption.clientSide() {
+		encryptedPath, err := b.Encryption.encryptFile(b.Path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(encryptedPath)
+		assetPath = encryptedPath
+	}
+
+	meta, err := b.metaDataWithChecksum(assetPath)
+	if err != nil {
+		return err
+	}
+	if b.Encryption.clientSide() {
+		meta[MetaDataEncryption] = envelopeScheme
+	}
+	var tracker *progressTracker
+	if b.OnProgress != nil {
+		info, err := os.Stat(assetPath)
+		if err != nil {
+			return err
+		}
+		tracker = newProgressTracker(b.key(), info.Size(), b.OnProgress)
+		ctx = withProgress(ctx, tracker)
+	}
+	if err := b.backend.Put(ctx, b.key(), assetPath, meta); err != nil {
+		if errors.Is(err, ErrAlreadyExists) {
+			return fmt.Errorf("version already published, asset was stored as %s by another run meanwhile: %w", b.key(), err)
+		}
 		return err
 	}
+	tracker.finish()
 	return nil
 }
 
-// FetchAsset stores the packed asset at specified location.
+// FetchAsset fetches the packed asset on to the specified location.
+// Asset is downloaded to a partial file, in parallel parts if backend supports it, and is renamed to TargetPath only
+// after its checksum is verified, asset encrypted on client side is decrypted onto TargetPath instead. The partial file is retained on failure so that the next fetch resumes from there.
+// When Cache is set, the asset is served from it if it holds the same revision and the asset fetched already at TargetPath is replaced.
 // Make sure that InitBackend is invoked before calling this.
 func (b *Store) FetchAsset() error {
-	if b.Cloud == "fs" {
-		b.TargetPath = b.getTargetPath()
-		return nil
+	return b.FetchAssetWithContext(context.Background())
+}
+
+// FetchAssetWithContext is FetchAsset which is abandoned once ctx is done, the partial file of the fetch cancelled is removed
+// instead of being retained for resume.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) FetchAssetWithContext(ctx context.Context) error {
+	if b.Cache.offline() {
+		return b.fetchCachedAsset()
 	}
-	if err := b.connectBucket(); err != nil {
-		return err
+	if b.backend == nil {
+		return fmt.Errorf("unable to fetch asset, backend was not initialized")
 	}
 
 	b.TargetPath = b.getTargetPath()
-	if err := b.fetchAsset(); err != nil {
+	object, err := b.backend.Stat(ctx, b.key())
+	if err != nil {
+		// Backends which do not hold the asset, like fs without root directory, are left to handle it on their own.
+		if errors.Is(err, ErrNotFound) {
+			return b.backend.Get(ctx, b.key(), b.TargetPath)
+		}
 		return err
 	}
+	if helper.Statfile(b.TargetPath) && b.Cache == nil {
+		return fmt.Errorf("asset already fetched in the specified path: %s", b.TargetPath)
+	}
+
+	if b.Cache != nil {
+		served, err := b.serveFromCache(object)
+		if err != nil || served {
+			return err
+		}
+	}
+
+	// Download is retried as a whole, where the parts fetched by the failed attempt are not fetched again.
+	partPath := b.TargetPath + partSuffix
+	err = b.Retry.do(ctx, b.provider(), func(ctx context.Context) error {
+		return b.download(ctx, object, partPath)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			removeParts(partPath)
+		}
+		return err
+	}
+	if err := verifyChecksum(partPath, object.MetaData[MetaDataChecksum]); err != nil {
+		removeParts(partPath)
+		return err
+	}
+	if b.Cache != nil {
+		if err := b.Cache.add(b.String(), object, partPath); err != nil {
+			fmt.Println(ui.Warn(fmt.Sprintf("Asset %s could not be cached: %v\n", object.Key, err)))
+		}
+	}
+	if object.MetaData[MetaDataEncryption] == envelopeScheme {
+		defer removeParts(partPath)
+		return b.Encryption.decryptFile(partPath, b.TargetPath)
+	}
+	if err := os.Rename(partPath, b.TargetPath); err != nil {
+		return err
+	}
+	removeParts(partPath)
 	return nil
 }
 
+// List lists all versions of the asset stored under Folder/Name in the backend, oldest first. Tags of the asset are not listed.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) List() ([]*Object, error) {
+	return b.ListWithContext(context.Background())
+}
+
+// ListWithContext is List which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) ListWithContext(ctx context.Context) ([]*Object, error) {
+	if b.backend == nil {
+		return nil, fmt.Errorf("unable to list assets, backend was not initialized")
+	}
+
+	listed, err := b.backend.List(ctx, b.key()+"/")
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]*Object, 0, len(listed))
+	for _, object := range listed {
+		if !isTagKey(object.Key) {
+			objects = append(objects, object)
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].Modified.Before(objects[j].Modified)
+	})
+	return objects, nil
+}
+
+// Stat returns the size, upload time and metadata of the asset stored in the backend, without fetching it.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) Stat() (*Object, error) {
+	return b.StatWithContext(context.Background())
+}
+
+// StatWithContext is Stat which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) StatWithContext(ctx context.Context) (*Object, error) {
+	if b.backend == nil {
+		return nil, fmt.Errorf("unable to stat asset, backend was not initialized")
+	}
+	return b.backend.Stat(ctx, b.key())
+}
+
+// Backend returns the backend initialized by InitBackend, nil if it was not initialized.
+// Its operations are neither retried nor have their errors classified, unlike the ones of Store.
+func (b *Store) Backend() Backend {
+	if b.backend == nil {
+		return nil
+	}
+	return b.provider()
+}
+
+// Close releases the connections held by the backend, such as the ssh connection of sftp, for the backends implementing io.Closer.
+// Backend has to be initialized again with InitBackend to be used after it is closed.
+func (b *Store) Close() error {
+	if b.backend == nil {
+		return nil
+	}
+	closer, ok := b.provider().(io.Closer)
+	b.backend = nil
+	if !ok {
+		return nil
+	}
+	return closer.Close()
+}
+
+// metaDataWithChecksum returns the metadata of the asset along with SHA-256 of the file stored, which is verified while fetching it.
+func (b *Store) metaDataWithChecksum(assetPath string) (map[string]string, error) {
+	checksum, err := helper.FileChecksum(assetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := map[string]string{MetaDataChecksum: checksum}
+	for key, value := range b.MetaData {
+		meta[key] = value
+	}
+	return meta, nil
+}
+
 func (b *Store) validate() error {
+	if err := b.applyURI(); err != nil {
+		return err
+	}
 	if len(b.Cloud) == 0 {
 		b.Cloud = "fs"
 	}
-	if (len(b.CredentialType) == 0) || (len(b.CredentialPath) == 0) || (len(b.CredentialPath) == 0) {
+	if err := b.Encryption.validate(b.Cloud); err != nil {
+		return err
+	}
+	if (len(b.CredentialType) == 0) || (len(b.CredentialPath) == 0 && !keylessCredentials[b.CredentialType]) {
 		b.CredentialType = "default"
 	}
 	return nil
@@ -146,3 +361,30 @@ func (b *Store) validate() error {
 func (b *Store) getTargetPath() string {
 	return fmt.Sprintf("%s/%s", b.TargetPath, b.Name)
 }
+
+// String returns the URI of the backend, it is formed from Cloud, Bucket and Folder unless Store was configured with URI.
+func (b *Store) String() string {
+	if len(b.URI) != 0 {
+		return b.URI
+	}
+	location := b.Bucket
+	if len(b.Folder) != 0 {
+		location = strings.TrimSuffix(location, "/") + "/" + strings.Trim(b.Folder, "/")
+	}
+	if strings.Contains(b.Bucket, "://") {
+		return location
+	}
+	if b.Cloud == "sftp" {
+		return "sftp://" + b.Endpoint + "/" + strings.TrimPrefix(location, "/")
+	}
+	prefix, ok := bucketPrefix[b.Cloud]
+	if !ok {
+		prefix = b.Cloud + "://"
+	}
+	return prefix + location
+}
+
+// key returns the key of the asset in the backend.
+func (b *Store) key() string {
+	return path.Join(b.Folder, b.Environment, b.Name)
+}
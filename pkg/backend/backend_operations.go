@@ -2,132 +2,64 @@ package backend
 
 import (
 	"fmt"
-	"strings"
+	"io"
+	"os"
+
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
 )
 
 var (
-	bucketPrefix   = map[string]string{"aws": "s3://", "gcp": "gs://", "azure": "azblob://", "fs": "file://"}
-	cloudSUpported = []string{"gcp", "aws", "azure", "fs"}
+	bucketPrefix = map[string]string{"aws": "s3://", "gcp": "gs://", "azure": "azblob://", "fs": "file://"}
 )
 
-// ConnectBucket will establish connection to the bucket of appropriate cloud so that the content can be accessed.
-func (b *Store) connectBucket() error {
-	if err := b.validateBucketURL(); err != nil {
-		return err
-	}
-
-	if b.Cloud == "gcp" {
-		if err := b.gcpCreds.connectBucket(b.Bucket, b.Name); err != nil {
-			return nil
-		}
-	} else if b.Cloud == "aws" {
-		if err := b.awsCreds.connectBucket(b.Bucket, b.Name); err != nil {
-			return nil
-		}
-	} else if b.Cloud == "azure" {
-		return nil
+// writeAsset writes the content read from the backend on to the specified path.
+func writeAsset(path string, content io.Reader) error {
+	if helper.Statfile(path) {
+		return fmt.Errorf("asset already fetched in the specified path: %s", path)
 	}
-	return nil
-}
 
-func (b *Store) objectExists() (bool, error) {
-	if err := b.validateBucketURL(); err != nil {
-		return false, err
-	}
-
-	// This verifies if root object exists.
-	if b.Cloud == "gcp" {
-		exists, err := b.gcpCreds.objectExists(b.Bucket, b.Name)
-		return exists, err
-	} else if b.Cloud == "aws" {
-		exists, err := b.awsCreds.objectExists(b.Bucket, b.Name)
-		return exists, err
-	} else if b.Cloud == "azure" {
-		return false, nil
+	asset, err := helper.CreateFile(path)
+	if err != nil {
+		return err
 	}
-	return false, nil
-}
-
-// // ReadBucket reads through the configured bucket.
-// func (b *Store) readBucket() error {
-// 	if err := b.validateBucketURL(); err != nil {
-// 		return err
-// 	}
-// 	// r, err := b.blobConn.NewReader(b.ctx, "foo.txt", nil)
-// 	// if err != nil {
-// 	// 	return err
-// 	// }
-// 	// defer r.Close()
-// 	// return nil
-// 	return nil
-// }
 
-// storeAsset downloads the asset from specified cloud.
-func (b *Store) storeAsset() error {
-	if err := b.validateBucketURL(); err != nil {
+	if _, err := io.Copy(asset, content); err != nil {
+		asset.Close()
 		return err
 	}
 
-	if b.Cloud == "gcp" {
-		if err := b.gcpCreds.storeAsset(b.Path, b.MetaData); err != nil {
-			return err
-		}
-	} else if b.Cloud == "aws" {
-		if err := b.awsCreds.storeAsset(b.Path, b.MetaData); err != nil {
-			return err
-		}
-	} else if b.Cloud == "azure" {
-		return nil
+	if err := asset.Close(); err != nil {
+		return err
 	}
-
 	return nil
 }
 
-// fetchAsset downloads the asset from specified cloud.
-func (b *Store) fetchAsset() error {
-	if err := b.validateBucketURL(); err != nil {
-		return err
+// openAsset opens the asset which has to be stored to the backend and returns its size along with it.
+func openAsset(path string) (*os.File, int64, error) {
+	if !helper.Statfile(path) {
+		return nil, 0, fmt.Errorf("unable to find asset under specified path: %s", path)
 	}
 
-	if b.Cloud == "gcp" {
-		if err := b.gcpCreds.fetchAsset(b.TargetPath); err != nil {
-			return err
-		}
-	} else if b.Cloud == "aws" {
-		if err := b.awsCreds.fetchAsset(b.TargetPath); err != nil {
-			return err
-		}
-	} else if b.Cloud == "azure" {
-		return nil
+	asset, err := helper.OpenFile(path)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return nil
-}
-
-// ValidateBucketURL validates the bucket passed to Unpackker.
-func (b *Store) validateBucketURL() error {
-	if !b.validateCloud() {
-		return fmt.Errorf("at the moment unpackker does not support backend for the cloud %s configured", b.Cloud)
+	info, err := asset.Stat()
+	if err != nil {
+		asset.Close()
+		return nil, 0, err
 	}
-	return nil
+	return asset, info.Size(), nil
 }
 
-func (b *Store) validateCloud() bool {
-	for _, cloud := range cloudSUpported {
-		if b.Cloud == cloud {
-			return true
-		}
-	}
-	return false
+// byteRange returns the value of Range header to read length bytes starting at offset.
+func byteRange(offset, length int64) string {
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
 }
 
-func (b *Store) createBucketURL() {
-	b.Bucket = (bucketPrefix[b.Cloud] + b.Bucket)
-}
-
-func (b *Store) validateURL(url string) bool {
-	if strings.HasPrefix(b.Bucket, bucketPrefix[b.Cloud]) {
-		return true
-	}
-	return false
+// readCloser closes the Closer once the Reader is read, it helps in returning part of a file as io.ReadCloser.
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
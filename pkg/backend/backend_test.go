@@ -0,0 +1,90 @@
+package backend_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+// newTestAsset writes the asset of size bytes of random content under dir and returns its path along with the content.
+func newTestAsset(t *testing.T, dir, name string, size int) (string, []byte) {
+	t.Helper()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	assetPath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(assetPath, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return assetPath, content
+}
+
+// newTestStore returns the store of backend URI, for the asset at assetPath which is stored and fetched as name.
+func newTestStore(t *testing.T, uri, name, assetPath string) *backend.Store {
+	t.Helper()
+	store, err := backend.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Name = name
+	store.Path = assetPath
+	return store
+}
+
+// fetchTestAsset fetches the asset of store under dir and verifies that it matches the content.
+func fetchTestAsset(t *testing.T, store *backend.Store, dir string, content []byte) {
+	t.Helper()
+	store.TargetPath = dir
+	if err := store.FetchAsset(); err != nil {
+		t.Fatalf("unable to fetch asset from %s: %v", store, err)
+	}
+	fetched, err := ioutil.ReadFile(filepath.Join(dir, store.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fetched, content) {
+		t.Errorf("asset fetched from %s has %d bytes which do not match the %d bytes stored", store, len(fetched), len(content))
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "unpackker-backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// emulatorStore returns the store of backend URI set in the environment variable, the test is skipped when it is not set.
+// These run the tests against emulators of the clouds, such as minio, fake-gcs-server and azurite, or against the clouds themselves.
+func emulatorStore(t *testing.T, env string) *backend.Store {
+	t.Helper()
+	uri := os.Getenv(env)
+	if len(uri) == 0 {
+		t.Skipf("%s is not set to the backend URI of emulator", env)
+	}
+	store, err := backend.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// trustTestServer makes http.DefaultTransport, on which the clients of backends are built, trust the certificate of TLS server.
+// It returns the function restoring the transport.
+func trustTestServer(server *httptest.Server) func() {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	restore := http.DefaultTransport
+	http.DefaultTransport = transport
+	return func() {
+		http.DefaultTransport = restore
+	}
+}
@@ -0,0 +1,290 @@
+// Package backendtest is the conformance suite of backend.Backend, it verifies that a backend behaves the way Store expects it to.
+// The suite is run from the tests of the code implementing or configuring the backend, for instance against a local emulator of the cloud:
+//
+//	func TestStore(t *testing.T) {
+//		store, _ := backend.Parse("s3://assets/team-a?endpoint=http://localhost:9000&region=us-east-1")
+//		backendtest.Run(t, store)
+//	}
+//
+// Builtin backends could be verified this way against emulators such as fake-gcs-server for gcp, minio for aws and azurite for azure,
+// and against a temporary directory for fs.
+package backendtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+// Run runs the conformance suite against the backend of store, which is initialized by it.
+// Assets are stored under a folder of their own in store.Folder and are deleted once the suite is done,
+// hence store could point at the bucket that is shared with other tests.
+func Run(t *testing.T, store *backend.Store) {
+	t.Helper()
+	if err := store.InitBackend(); err != nil {
+		t.Fatalf("unable to initialize backend %s: %v", store, err)
+	}
+	if store.Backend() == nil {
+		t.Fatalf("backend %s was not initialized, it could not be tested while the cache is offline", store)
+	}
+
+	dir, err := ioutil.TempDir("", "backendtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &suite{
+		backend: store.Backend(),
+		prefix:  path.Join(store.Folder, fmt.Sprintf("backendtest-%d", time.Now().UnixNano())),
+		dir:     dir,
+		content: bytes.Repeat([]byte("unpackker conformance "), 1024),
+		meta:    map[string]string{backend.MetaDataVersion: "1.0.0", backend.MetaDataEnvironment: "test"},
+	}
+	defer s.cleanup()
+
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{"Put", s.testPut},
+		{"Exists", s.testExists},
+		{"Get", s.testGet},
+		{"GetRange", s.testGetRange},
+		{"Conflict", s.testConflict},
+		{"MetaData", s.testMetaData},
+		{"List", s.testList},
+		{"Delete", s.testDelete},
+	} {
+		if !t.Run(test.name, test.run) && test.name == "Put" {
+			return
+		}
+	}
+}
+
+type suite struct {
+	backend backend.Backend
+	prefix  string
+	dir     string
+	content []byte
+	meta    map[string]string
+	stored  []string
+}
+
+func (s *suite) testPut(t *testing.T) {
+	if err := s.put(context.Background(), s.key("asset"), s.content, s.meta); err != nil {
+		t.Fatalf("unable to put asset: %v", err)
+	}
+}
+
+func (s *suite) testExists(t *testing.T) {
+	exists, err := s.backend.Exists(context.Background(), s.key("asset"))
+	if err != nil {
+		t.Fatalf("unable to check for asset: %v", err)
+	}
+	if !exists {
+		t.Errorf("asset %s that was put does not exist", s.key("asset"))
+	}
+
+	exists, err = s.backend.Exists(context.Background(), s.key("missing"))
+	if err != nil {
+		t.Fatalf("unable to check for missing asset: %v", err)
+	}
+	if exists {
+		t.Errorf("asset %s that was never put exists", s.key("missing"))
+	}
+}
+
+func (s *suite) testGet(t *testing.T) {
+	target := filepath.Join(s.dir, "get")
+	if err := s.backend.Get(context.Background(), s.key("asset"), target); err != nil {
+		t.Fatalf("unable to get asset: %v", err)
+	}
+	s.verifyContent(t, target, s.content)
+
+	err := s.backend.Get(context.Background(), s.key("missing"), filepath.Join(s.dir, "missing"))
+	if !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("getting missing asset returned %v, want %v", err, backend.ErrNotFound)
+	}
+}
+
+func (s *suite) testGetRange(t *testing.T) {
+	reader, ok := s.backend.(backend.RangeReader)
+	if !ok {
+		t.Skip("backend does not implement backend.RangeReader")
+	}
+
+	offset, length := int64(100), int64(1000)
+	part, err := reader.GetRange(context.Background(), s.key("asset"), offset, length)
+	if err != nil {
+		t.Fatalf("unable to get range of asset: %v", err)
+	}
+	defer part.Close()
+	content, err := ioutil.ReadAll(part)
+	if err != nil {
+		t.Fatalf("unable to read range of asset: %v", err)
+	}
+	if !bytes.Equal(content, s.content[offset:offset+length]) {
+		t.Errorf("range of %d bytes at %d does not match the asset put, got %d bytes", length, offset, len(content))
+	}
+}
+
+func (s *suite) testConflict(t *testing.T) {
+	ctx := backend.WithCreateOnly(context.Background())
+	err := s.put(ctx, s.key("asset"), []byte("overwritten"), nil)
+	if !errors.Is(err, backend.ErrAlreadyExists) {
+		t.Errorf("putting asset that is present with create only returned %v, want %v", err, backend.ErrAlreadyExists)
+	}
+
+	target := filepath.Join(s.dir, "conflict")
+	if err := s.backend.Get(context.Background(), s.key("asset"), target); err != nil {
+		t.Fatalf("unable to get asset: %v", err)
+	}
+	s.verifyContent(t, target, s.content)
+
+	if err := s.put(ctx, s.key("created"), s.content, s.meta); err != nil {
+		t.Errorf("unable to put asset that is not present with create only: %v", err)
+	}
+}
+
+func (s *suite) testMetaData(t *testing.T) {
+	object, err := s.backend.Stat(context.Background(), s.key("asset"))
+	if err != nil {
+		t.Fatalf("unable to stat asset: %v", err)
+	}
+	if object.Key != s.key("asset") {
+		t.Errorf("key of asset is %s, want %s", object.Key, s.key("asset"))
+	}
+	if object.Size != int64(len(s.content)) {
+		t.Errorf("size of asset is %d, want %d", object.Size, len(s.content))
+	}
+	for key, value := range s.meta {
+		if object.MetaData[key] != value {
+			t.Errorf("metadata %s of asset is %q, want %q", key, object.MetaData[key], value)
+		}
+	}
+
+	_, err = s.backend.Stat(context.Background(), s.key("missing"))
+	if !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("stat of missing asset returned %v, want %v", err, backend.ErrNotFound)
+	}
+}
+
+func (s *suite) testList(t *testing.T) {
+	want := []string{s.key("list/asset_1_0"), s.key("list/asset_2_0")}
+	for _, key := range append(want, s.key("listed/asset_1_0")) {
+		if err := s.put(context.Background(), key, s.content, s.meta); err != nil {
+			t.Fatalf("unable to put asset: %v", err)
+		}
+	}
+
+	objects, err := s.backend.List(context.Background(), s.key("list")+"/")
+	if err != nil {
+		t.Fatalf("unable to list assets: %v", err)
+	}
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+		if object.Size != int64(len(s.content)) {
+			t.Errorf("size of listed asset %s is %d, want %d", object.Key, object.Size, len(s.content))
+		}
+	}
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("listed assets are %v, want %v", keys, want)
+	}
+}
+
+func (s *suite) testDelete(t *testing.T) {
+	if err := s.backend.Delete(context.Background(), s.key("asset")); err != nil {
+		t.Fatalf("unable to delete asset: %v", err)
+	}
+
+	exists, err := s.backend.Exists(context.Background(), s.key("asset"))
+	if err != nil {
+		t.Fatalf("unable to check for asset: %v", err)
+	}
+	if exists {
+		t.Errorf("asset %s exists after it was deleted", s.key("asset"))
+	}
+	if _, err := s.backend.Stat(context.Background(), s.key("asset")); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("stat of deleted asset returned %v, want %v", err, backend.ErrNotFound)
+	}
+	if err := s.backend.Delete(context.Background(), s.key("asset")); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("deleting asset again returned %v, want %v", err, backend.ErrNotFound)
+	}
+}
+
+// put writes the content to a file and puts it as the asset identified by key, the key is deleted once the suite is done.
+func (s *suite) put(ctx context.Context, key string, content []byte, meta map[string]string) error {
+	source, err := ioutil.TempFile(s.dir, "asset-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(source.Name())
+	if _, err := source.Write(content); err != nil {
+		source.Close()
+		return err
+	}
+	if err := source.Close(); err != nil {
+		return err
+	}
+
+	s.stored = append(s.stored, key)
+	return s.backend.Put(ctx, key, source.Name(), meta)
+}
+
+func (s *suite) verifyContent(t *testing.T, path string, want []byte) {
+	t.Helper()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read asset got: %v", err)
+	}
+	if !bytes.Equal(content, want) {
+		t.Errorf("asset got has %d bytes which do not match the %d bytes put", len(content), len(want))
+	}
+}
+
+// ClearMem deletes all the assets stored in the bucket of mem backend, the stores already initialized with it see it empty as well.
+// Tests storing the assets in mem backend defer it, so that the tests run after them do not see their assets.
+func ClearMem(t *testing.T, bucket string) {
+	t.Helper()
+	store, err := backend.Parse("mem://" + bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := store.Backend().List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, object := range objects {
+		if err := store.Backend().Delete(context.Background(), object.Key); err != nil && !errors.Is(err, backend.ErrNotFound) {
+			t.Errorf("unable to clear %s from mem bucket %s: %v", object.Key, bucket, err)
+		}
+	}
+}
+
+// cleanup deletes the assets put by the suite, the ones already deleted are skipped.
+func (s *suite) cleanup() {
+	for _, key := range s.stored {
+		s.backend.Delete(context.Background(), key)
+	}
+}
+
+// key returns the key of the asset under the folder of suite.
+func (s *suite) key(name string) string {
+	return path.Join(s.prefix, name)
+}
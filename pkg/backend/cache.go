@@ -0,0 +1,440 @@
+package backend
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	defaultCacheSizeMB = 4096
+	cacheDirName       = "unpackker"
+	cacheObjectsDir    = "objects"
+	cacheIndexFile     = "index.json"
+	cacheLockFile      = ".lock"
+	cacheLockTimeout   = 30 * time.Second
+	// cacheStaleLock is the age after which the lock is considered to be left behind by the run that was killed.
+	cacheStaleLock = time.Minute
+)
+
+// Cache is the local directory holding the assets fetched from the backends, so that the asset fetched again is served from it
+// once its revision is confirmed with the backend. Assets are cached as they are stored in the backend and are keyed by backend,
+// name, version and checksum, the least recently used ones are evicted once the cache grows beyond MaxSizeMB.
+type Cache struct {
+	// Dir is the directory of the cache, defaults to unpackker under the cache directory of the user.
+	Dir string `json:"dir" yaml:"dir" env:"UNPACKKER_CACHE_DIR"`
+	// MaxSizeMB bounds the size in MiB of the assets held by the cache, defaults to 4096.
+	MaxSizeMB int `json:"maxsizemb" yaml:"maxsizemb"`
+	// Offline serves the assets only from the cache without reaching the backend, hence credentials are not loaded either.
+	// Tags and semver constraints are resolved to the asset they were resolved to when the backend was last reached.
+	Offline bool `json:"offline" yaml:"offline" env:"UNPACKKER_OFFLINE"`
+}
+
+// cacheIndex records the assets held by the cache along with the references resolved, it is stored as index.json of the cache.
+type cacheIndex struct {
+	Entries map[string]*cacheEntry `json:"entries"`
+	Refs    map[string]*cacheRef   `json:"refs"`
+}
+
+// cacheEntry is the asset held by the cache under objects/ID, where ID is derived from its backend, key, version and checksum.
+type cacheEntry struct {
+	Backend  string            `json:"backend"`
+	Key      string            `json:"key"`
+	Size     int64             `json:"size"`
+	Modified time.Time         `json:"modified"`
+	ETag     string            `json:"etag"`
+	MetaData map[string]string `json:"metadata"`
+	LastUsed time.Time         `json:"lastused"`
+}
+
+// cacheRef is the asset to which a tag or semver constraint was resolved.
+type cacheRef struct {
+	Environment string    `json:"environment"`
+	Name        string    `json:"name"`
+	ResolvedAt  time.Time `json:"resolvedat"`
+}
+
+// offline reports whether the assets have to be served only from the cache.
+func (c *Cache) offline() bool {
+	return c != nil && c.Offline
+}
+
+// lookup returns the path of the asset in the cache if it holds the same revision of the object, the entry of an older
+// revision is dropped. Found is false when the cache does not hold it.
+func (c *Cache) lookup(backend string, object *Object) (cachedPath string, found bool, err error) {
+	id := cacheID(backend, object.Key, object.MetaData)
+	err = c.update(func(dir string, index *cacheIndex) error {
+		entry, ok := index.Entries[id]
+		if !ok {
+			return nil
+		}
+		cachedPath = filepath.Join(dir, cacheObjectsDir, id)
+		if !entry.revisionOf(object) || !helper.Statfile(cachedPath) {
+			index.remove(dir, id)
+			return nil
+		}
+		entry.LastUsed = time.Now().UTC()
+		found = true
+		return nil
+	})
+	return cachedPath, found, err
+}
+
+// latest returns the entry of the asset cached last from the backend under key along with its path, it is what offline fetch serves.
+func (c *Cache) latest(backend, key string) (*cacheEntry, string, error) {
+	var latest *cacheEntry
+	var cachedPath string
+	err := c.update(func(dir string, index *cacheIndex) error {
+		for id, entry := range index.Entries {
+			if entry.Backend != backend || entry.Key != key {
+				continue
+			}
+			if latest == nil || entry.Modified.After(latest.Modified) {
+				latest, cachedPath = entry, filepath.Join(dir, cacheObjectsDir, id)
+			}
+		}
+		if latest != nil {
+			latest.LastUsed = time.Now().UTC()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if latest == nil || !helper.Statfile(cachedPath) {
+		return nil, "", fmt.Errorf("asset %s of %s is not in the cache: %w", key, backend, ErrNotFound)
+	}
+	return latest, cachedPath, nil
+}
+
+// add copies the fetched object at assetPath into the cache, evicting the least recently used assets to keep it within MaxSizeMB.
+// Assets larger than MaxSizeMB are not cached.
+func (c *Cache) add(backend string, object *Object, assetPath string) error {
+	if object.Size > c.maxSize() {
+		return nil
+	}
+	dir, err := c.dir()
+	if err != nil {
+		return err
+	}
+
+	id := cacheID(backend, object.Key, object.MetaData)
+	objects := filepath.Join(dir, cacheObjectsDir)
+	if err := os.MkdirAll(objects, 0755); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(objects, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+	if err := linkOrCopy(assetPath, temp.Name()); err != nil {
+		return err
+	}
+
+	return c.update(func(dir string, index *cacheIndex) error {
+		if err := os.Rename(temp.Name(), filepath.Join(objects, id)); err != nil {
+			return err
+		}
+		// Asset overwritten in the backend supersedes the one cached earlier under the same key.
+		for cachedID, entry := range index.Entries {
+			if cachedID != id && entry.Backend == backend && entry.Key == object.Key {
+				index.remove(dir, cachedID)
+			}
+		}
+		index.Entries[id] = &cacheEntry{
+			Backend:  backend,
+			Key:      object.Key,
+			Size:     object.Size,
+			Modified: object.Modified,
+			ETag:     object.ETag,
+			MetaData: object.MetaData,
+			LastUsed: time.Now().UTC(),
+		}
+		index.evict(dir, c.maxSize())
+		return nil
+	})
+}
+
+// drop removes the asset cached for the object.
+func (c *Cache) drop(backend string, object *Object) error {
+	return c.update(func(dir string, index *cacheIndex) error {
+		index.remove(dir, cacheID(backend, object.Key, object.MetaData))
+		return nil
+	})
+}
+
+// saveRef records the asset to which the reference was resolved, so that it could be resolved offline.
+func (c *Cache) saveRef(ref, environment, name string) error {
+	return c.update(func(dir string, index *cacheIndex) error {
+		index.Refs[ref] = &cacheRef{Environment: environment, Name: name, ResolvedAt: time.Now().UTC()}
+		return nil
+	})
+}
+
+// ref returns the asset to which the reference was resolved when the backend was last reached.
+func (c *Cache) ref(ref string) (*cacheRef, error) {
+	var resolved *cacheRef
+	err := c.update(func(dir string, index *cacheIndex) error {
+		resolved = index.Refs[ref]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resolved == nil {
+		return nil, ErrNotFound
+	}
+	return resolved, nil
+}
+
+// update invokes fn with the index of the cache while holding its lock, and saves the index once fn succeeds.
+func (c *Cache) update(fn func(dir string, index *cacheIndex) error) error {
+	dir, err := c.dir()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockCache(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	index := loadCacheIndex(dir)
+	if err := fn(dir, index); err != nil {
+		return err
+	}
+	return saveCacheIndex(dir, index)
+}
+
+// dir returns the directory of the cache, creating it if it does not exist.
+func (c *Cache) dir() (string, error) {
+	dir := c.Dir
+	if len(dir) == 0 {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to find cache directory of the user, set 'dir' of cache: %v", err)
+		}
+		dir = filepath.Join(userCache, cacheDirName)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (c *Cache) maxSize() int64 {
+	if c.MaxSizeMB > 0 {
+		return int64(c.MaxSizeMB) << 20
+	}
+	return defaultCacheSizeMB << 20
+}
+
+// revisionOf reports whether the entry is the same revision of the object, by ETag if the backend tracks it else by size and modified time.
+func (e *cacheEntry) revisionOf(object *Object) bool {
+	if len(object.ETag) != 0 || len(e.ETag) != 0 {
+		return e.ETag == object.ETag
+	}
+	return e.Size == object.Size && e.Modified.Equal(object.Modified)
+}
+
+// evict removes the least recently used assets until the cache is within maxSize.
+func (index *cacheIndex) evict(dir string, maxSize int64) {
+	ids := make([]string, 0, len(index.Entries))
+	var size int64
+	for id, entry := range index.Entries {
+		ids = append(ids, id)
+		size += entry.Size
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return index.Entries[ids[i]].LastUsed.Before(index.Entries[ids[j]].LastUsed)
+	})
+	for _, id := range ids {
+		if size <= maxSize {
+			return
+		}
+		size -= index.Entries[id].Size
+		index.remove(dir, id)
+	}
+}
+
+func (index *cacheIndex) remove(dir, id string) {
+	os.Remove(filepath.Join(dir, cacheObjectsDir, id))
+	delete(index.Entries, id)
+}
+
+// cacheID derives the ID of the asset in the cache from its backend, key, version and checksum.
+func cacheID(backend, key string, meta map[string]string) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{backend, key, meta[MetaDataVersion], meta[MetaDataChecksum]}, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// cacheRefKey is the key under which the asset the reference was resolved to is recorded.
+func cacheRefKey(backend, dir, reference string) string {
+	return strings.Join([]string{backend, dir, reference}, "\x00")
+}
+
+// loadCacheIndex reads the index of the cache, the index which could not be read is started afresh.
+func loadCacheIndex(dir string) *cacheIndex {
+	index := new(cacheIndex)
+	if content, err := ioutil.ReadFile(filepath.Join(dir, cacheIndexFile)); err == nil {
+		if err := json.Unmarshal(content, index); err != nil {
+			index = new(cacheIndex)
+		}
+	}
+	if index.Entries == nil {
+		index.Entries = make(map[string]*cacheEntry)
+	}
+	if index.Refs == nil {
+		index.Refs = make(map[string]*cacheRef)
+	}
+	return index
+}
+
+// saveCacheIndex writes the index to a temporary file and renames it, so that the index is never left half written.
+func saveCacheIndex(dir string, index *cacheIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(dir, cacheIndexFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filepath.Join(dir, cacheIndexFile))
+}
+
+// lockCache takes the lock of the cache shared by the concurrent runs, the returned function releases it.
+func lockCache(dir string) (func(), error) {
+	lockPath := filepath.Join(dir, cacheLockFile)
+	deadline := time.Now().Add(cacheLockTimeout)
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			lock.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > cacheStaleLock {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("unable to lock cache %s, remove %s if no other unpackker is running", dir, lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// linkOrCopy places the file at source onto target, hard linking it when both are on the same file system.
+func linkOrCopy(source, target string) error {
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(source, target); err == nil {
+		return nil
+	}
+
+	reader, _, err := openAsset(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer, err := helper.CreateFile(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Close()
+		os.Remove(target)
+		return err
+	}
+	return writer.Close()
+}
+
+// serveFromCache places the asset held by the cache onto TargetPath if it is the same revision as the object and is intact.
+// The asset that could not be served from the cache is fetched from the backend, hence the failures of the cache are only warned.
+func (b *Store) serveFromCache(object *Object) (bool, error) {
+	cachedPath, found, err := b.Cache.lookup(b.String(), object)
+	if err != nil {
+		fmt.Println(ui.Warn(fmt.Sprintf("Cache could not be read, fetching asset from backend: %v\n", err)))
+		return false, nil
+	}
+	if !found {
+		return false, nil
+	}
+	if err := verifyChecksum(cachedPath, object.MetaData[MetaDataChecksum]); err != nil {
+		fmt.Println(ui.Warn(fmt.Sprintf("Cached asset %s is corrupted, fetching it from backend: %v\n", object.Key, err)))
+		if err := b.Cache.drop(b.String(), object); err != nil {
+			fmt.Println(ui.Warn(fmt.Sprintf("Corrupted asset could not be dropped from cache: %v\n", err)))
+		}
+		return false, nil
+	}
+
+	fmt.Println(ui.Info(fmt.Sprintf("Asset %s is served from cache\n", object.Key)))
+	return true, b.placeCachedAsset(cachedPath, object.MetaData)
+}
+
+// fetchCachedAsset places the asset cached last from the backend onto TargetPath, without reaching the backend.
+func (b *Store) fetchCachedAsset() error {
+	b.TargetPath = b.getTargetPath()
+	entry, cachedPath, err := b.Cache.latest(b.String(), b.key())
+	if err != nil {
+		return fmt.Errorf("unable to fetch asset offline: %w", err)
+	}
+	if err := verifyChecksum(cachedPath, entry.MetaData[MetaDataChecksum]); err != nil {
+		return fmt.Errorf("unable to fetch asset offline, cached asset is corrupted: %v", err)
+	}
+	return b.placeCachedAsset(cachedPath, entry.MetaData)
+}
+
+// placeCachedAsset places the cached asset onto TargetPath, decrypting it if it was encrypted on client side.
+func (b *Store) placeCachedAsset(cachedPath string, meta map[string]string) error {
+	if meta[MetaDataEncryption] == envelopeScheme {
+		return b.Encryption.decryptFile(cachedPath, b.TargetPath)
+	}
+	return linkOrCopy(cachedPath, b.TargetPath)
+}
+
+// resolveCached points Name and Environment of the Store at the asset the reference was resolved to when backend was last reached.
+func (b *Store) resolveCached(ref, reference string) error {
+	resolved, err := b.Cache.ref(ref)
+	if err != nil {
+		return fmt.Errorf("%s was never resolved through %s, it could not be resolved offline: %w", reference, b.String(), err)
+	}
+	b.Environment = resolved.Environment
+	b.Name = resolved.Name
+	return nil
+}
+
+// cacheRef records the asset the reference was resolved to, so that the reference could be resolved offline.
+func (b *Store) cacheRef(ref string) {
+	if b.Cache == nil {
+		return
+	}
+	if err := b.Cache.saveRef(ref, b.Environment, b.Name); err != nil {
+		fmt.Println(ui.Warn(fmt.Sprintf("Resolved asset could not be cached: %v\n", err)))
+	}
+}
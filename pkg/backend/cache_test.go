@@ -0,0 +1,132 @@
+package backend_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+// assetDownloads returns the number of requests downloading the asset demo_0_1_0, either as a whole or in parts.
+func assetDownloads(server *testArtifactServer) int {
+	downloads := 0
+	for _, request := range server.served("GET /assets/demo_0_1_0") {
+		if request == "GET /assets/demo_0_1_0" || strings.HasPrefix(request, "GET /assets/demo_0_1_0 bytes=") {
+			downloads++
+		}
+	}
+	return downloads
+}
+
+func TestCacheServesAssetFetchedAgain(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.Cache = &backend.Cache{Dir: filepath.Join(dir, "cache")}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "first"), content)
+	fetchTestAsset(t, store, filepath.Join(dir, "second"), content)
+	if downloads := assetDownloads(server); downloads != 1 {
+		t.Errorf("expected asset to be downloaded once and then served from cache, got %d downloads", downloads)
+	}
+
+	// The cached asset which is corrupted is fetched again from the backend.
+	cached, err := filepath.Glob(filepath.Join(dir, "cache", "objects", "*"))
+	if err != nil || len(cached) != 1 {
+		t.Fatalf("expected asset to be held by the cache, got %v", cached)
+	}
+	if err := ioutil.WriteFile(cached[0], []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "third"), content)
+	if downloads := assetDownloads(server); downloads != 2 {
+		t.Errorf("expected corrupted asset in cache to be downloaded again, got %d downloads", downloads)
+	}
+}
+
+func TestCacheFetchesChangedRevision(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.Cache = &backend.Cache{Dir: filepath.Join(dir, "cache")}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "first"), content)
+
+	// The version is stored again with other content, which the cache must not serve the previous one for.
+	changedPath, changed := newTestAsset(t, dir, "changed", 2<<10)
+	store.Path, store.SkipRemoteCheck = changedPath, true
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "second"), changed)
+}
+
+func TestCacheResolvesAndFetchesOffline(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	uri := server.server.URL + "/assets"
+	cache := filepath.Join(dir, "cache")
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, uri, "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SetTag("latest", "ci"); err != nil {
+		t.Fatal(err)
+	}
+	online := newTestStore(t, uri, "demo", "")
+	online.Cache = &backend.Cache{Dir: cache}
+	if err := online.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := online.Resolve("latest"); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, online, filepath.Join(dir, "online"), content)
+
+	// The backend is not reachable anymore.
+	server.server.Close()
+	offline := newTestStore(t, uri, "demo", "")
+	offline.Cache = &backend.Cache{Dir: cache, Offline: true}
+	if err := offline.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := offline.Resolve("latest"); err != nil {
+		t.Fatal(err)
+	}
+	if offline.Name != "demo_0_1_0" {
+		t.Errorf("latest was resolved offline to %s", offline.Name)
+	}
+	fetchTestAsset(t, offline, filepath.Join(dir, "offline"), content)
+
+	if err := offline.Resolve("stable"); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("expected reference never resolved online to be not found offline, got %v", err)
+	}
+}
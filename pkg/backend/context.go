@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// cleanupTimeout bounds the requests which clean up after the operation that was cancelled.
+const cleanupTimeout = 30 * time.Second
+
+// detachedContext carries the values of its parent but is never cancelled, it is used by the clients and token sources
+// which outlive the call that created them.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// detach returns the context which is not cancelled along with ctx.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+// cleanupContext returns the context with which the objects left by cancelled ctx are cleaned up.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detach(ctx), cleanupTimeout)
+}
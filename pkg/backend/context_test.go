@@ -0,0 +1,80 @@
+package backend_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+func TestOperationsStopOnCancel(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SetTag("stable", "ci"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	operations := map[string]func() error{
+		"list": func() error {
+			_, err := store.ListWithContext(ctx)
+			return err
+		},
+		"stat": func() error {
+			_, err := store.StatWithContext(ctx)
+			return err
+		},
+		"tags": func() error {
+			_, err := store.TagsWithContext(ctx)
+			return err
+		},
+		"get tag": func() error {
+			_, err := store.GetTagWithContext(ctx, "stable")
+			return err
+		},
+		"delete tag": func() error {
+			return store.DeleteTagWithContext(ctx, "stable")
+		},
+		"prune": func() error {
+			_, err := store.PruneWithContext(ctx, &backend.Retention{KeepLast: 1}, false)
+			return err
+		},
+		"promote": func() error {
+			_, err := store.PromoteWithContext(ctx, "production", "ci")
+			return err
+		},
+		"signed URL": func() error {
+			_, err := store.SignedURLWithContext(ctx, 0)
+			return err
+		},
+	}
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			s3.mu.Lock()
+			s3.requests = nil
+			s3.mu.Unlock()
+			if err := operation(); err == nil {
+				t.Fatal("expected operation to be abandoned once cancelled")
+			}
+			if len(s3.requests) != 0 {
+				t.Errorf("requests were sent to the backend after cancellation: %v", s3.requests)
+			}
+		})
+	}
+	if _, err := store.GetTag("stable"); err != nil {
+		t.Errorf("tag was deleted even though deleting it was cancelled: %v", err)
+	}
+}
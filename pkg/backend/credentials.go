@@ -0,0 +1,93 @@
+package backend
+
+import (
+	"fmt"
+)
+
+// defaultSessionName is the name of the session of role assumed by aws credential types assumerole and webidentity.
+const defaultSessionName = "unpackker"
+
+// keylessCredentials are the credential types that do not need CredentialPath, other types fall back to default without it.
+var keylessCredentials = map[string]bool{
+	"profile":          true,
+	"env":              true,
+	"assumerole":       true,
+	"webidentity":      true,
+	"impersonate":      true,
+	"workloadidentity": true,
+	"agent":            true,
+}
+
+// Credentials holds the options of the credential types of aws and gcp, other than the credential file itself.
+//
+// Aws supports the credential types:
+//
+//	default          credential chain of aws SDK, from Profile if set.
+//	file             shared credentials file at credspath, from Profile which defaults to default.
+//	profile          Profile of shared config and credentials files, from credspath if set. It could as well assume role.
+//	env              static keys from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+//	assumerole       RoleARN assumed with ExternalID, using the credential chain of aws SDK or Profile.
+//	webidentity      RoleARN assumed with the web identity token at credspath or TokenPath, defaulting to
+//	                 AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE as set by EKS.
+//
+// Gcp supports the credential types:
+//
+//	default          application default credentials.
+//	file             service account key at credspath.
+//	impersonate      ServiceAccount impersonated through Delegates, with the key at credspath or application default credentials.
+//	workloadidentity workload identity federation configuration at credspath, whose subject token is read from the file
+//	                 it names or from TokenPath.
+type Credentials struct {
+	// Profile of aws shared config and credentials files.
+	Profile string `json:"profile" yaml:"profile"`
+	// RoleARN is the aws role assumed by assumerole and webidentity types.
+	RoleARN string `json:"rolearn" yaml:"rolearn"`
+	// ExternalID is passed while assuming the role, when trust policy of the role requires it.
+	ExternalID string `json:"externalid" yaml:"externalid"`
+	// SessionName of the assumed role, defaults to unpackker.
+	SessionName string `json:"sessionname" yaml:"sessionname"`
+	// TokenPath is the file holding web identity token of aws or subject token of gcp workload identity federation.
+	TokenPath string `json:"tokenpath" yaml:"tokenpath"`
+	// ServiceAccount is the email of gcp service account impersonated by impersonate type.
+	ServiceAccount string `json:"serviceaccount" yaml:"serviceaccount"`
+	// Delegates are the service accounts through which ServiceAccount is impersonated, each of them impersonating the next.
+	Delegates []string `json:"delegates" yaml:"delegates"`
+}
+
+// CredentialError is returned by InitBackend when the credentials of the type configured could not be loaded.
+type CredentialError struct {
+	Cloud string
+	Type  string
+	Err   error
+}
+
+func (e *CredentialError) Error() string {
+	return fmt.Sprintf("unable to load %s credentials of type %s: %v", e.Cloud, e.Type, e.Err)
+}
+
+func (e *CredentialError) Unwrap() error {
+	return e.Err
+}
+
+// credentials returns the credential options of Store, it is never nil.
+func (b *Store) credentials() *Credentials {
+	if b.Credentials == nil {
+		return &Credentials{}
+	}
+	return b.Credentials
+}
+
+// ownCredentials sets the copy of credential options to Store and returns it, so that the options shared with other Store are not changed.
+func (b *Store) ownCredentials() *Credentials {
+	credentials := *b.credentials()
+	b.Credentials = &credentials
+	return b.Credentials
+}
+
+// sessionName returns the name of the session of assumed role.
+func (c *Credentials) sessionName() string {
+	if len(c.SessionName) != 0 {
+		return c.SessionName
+	}
+	return defaultSessionName
+}
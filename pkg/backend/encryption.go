@@ -0,0 +1,324 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// MetaDataEncryption is the metadata key under which the scheme the asset was encrypted with on client side is stored.
+	MetaDataEncryption = "encryption"
+
+	envelopeScheme    = "aes256gcm-envelope"
+	envelopeMagic     = "UNPKENC1"
+	envelopeChunkSize = 64 << 10
+	encryptedSuffix   = ".encrypted"
+	decryptedSuffix   = ".decrypted"
+	keySize           = 32
+	passphraseEnv     = "env:"
+)
+
+// Layout of the envelope header, the data key is wrapped with the key derived from the key file or passphrase.
+const (
+	saltOffset         = len(envelopeMagic)
+	keyNonceOffset     = saltOffset + 16
+	wrappedKeyOffset   = keyNonceOffset + 12
+	noncePrefixOffset  = wrappedKeyOffset + keySize + 16
+	envelopeHeaderSize = noncePrefixOffset + 4
+)
+
+// Encryption holds the keys with which the asset is encrypted at rest, either by the cloud or on client side before it is stored.
+// Cloud encryption applies to the asset as it is stored, while the asset encrypted on client side is stored as ciphertext
+// in any of the backends and is decrypted by FetchAsset only after its checksum is verified.
+type Encryption struct {
+	// KMSKey is the customer managed key with which the cloud encrypts the asset, the resource name of Cloud KMS key
+	// (projects/P/locations/L/keyRings/R/cryptoKeys/K) incase of gcp and ID or ARN of KMS key incase of aws (SSE-KMS).
+	KMSKey string `json:"kmskey" yaml:"kmskey"`
+	// CustomerKeyPath is the path of file holding 32 bytes key, raw or base64 encoded, sent along with every request of aws (SSE-C).
+	// S3 does not retain the key, hence the asset could be fetched only with the same key.
+	CustomerKeyPath string `json:"customerkeypath" yaml:"customerkeypath"`
+	// Scope is the encryption scope of azure storage account with which the blob is encrypted.
+	Scope string `json:"scope" yaml:"scope"`
+	// KeyPath is the path of file holding 32 bytes key, raw or base64 encoded, with which the asset is encrypted on client side.
+	KeyPath string `json:"keypath" yaml:"keypath"`
+	// Passphrase from which the key to encrypt the asset on client side is derived, set it to env:NAME to read it from
+	// environment variable NAME rather than keeping it in config file. Either KeyPath or Passphrase could be set.
+	Passphrase string `json:"passphrase" yaml:"passphrase"`
+}
+
+// validate makes sure that the options set are supported by the cloud.
+func (e *Encryption) validate(cloud string) error {
+	if e == nil {
+		return nil
+	}
+	if len(e.KMSKey) != 0 && cloud != "gcp" && cloud != "aws" {
+		return fmt.Errorf("encryption with kmskey is supported only by gcp and aws, not by %s", cloud)
+	}
+	if len(e.CustomerKeyPath) != 0 && cloud != "aws" {
+		return fmt.Errorf("encryption with customerkeypath is supported only by aws, not by %s", cloud)
+	}
+	if len(e.KMSKey) != 0 && len(e.CustomerKeyPath) != 0 {
+		return fmt.Errorf("either kmskey or customerkeypath could be set for encryption, not both")
+	}
+	if len(e.Scope) != 0 && cloud != "azure" {
+		return fmt.Errorf("encryption with scope is supported only by azure, not by %s", cloud)
+	}
+	if len(e.KeyPath) != 0 && len(e.Passphrase) != 0 {
+		return fmt.Errorf("either keypath or passphrase could be set for encryption on client side, not both")
+	}
+	return nil
+}
+
+// clientSide reports whether the asset has to be encrypted on client side.
+func (e *Encryption) clientSide() bool {
+	return e != nil && (len(e.KeyPath) != 0 || len(e.Passphrase) != 0)
+}
+
+// encryptFile encrypts the asset into a file of its own next to the asset and returns its path, the caller has to remove it.
+// Stores sharing the asset encrypt it concurrently, each with its own key, hence the file is never shared between them.
+func (e *Encryption) encryptFile(assetPath string) (string, error) {
+	source, _, err := openAsset(assetPath)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	target, err := ioutil.TempFile(filepath.Dir(assetPath), filepath.Base(assetPath)+".*"+encryptedSuffix)
+	if err != nil {
+		return "", err
+	}
+	encryptedPath := target.Name()
+	if err := e.encrypt(target, source); err != nil {
+		target.Close()
+		os.Remove(encryptedPath)
+		return "", fmt.Errorf("unable to encrypt asset: %v", err)
+	}
+	if err := target.Close(); err != nil {
+		os.Remove(encryptedPath)
+		return "", err
+	}
+	return encryptedPath, nil
+}
+
+// decryptFile decrypts the fetched asset onto targetPath, which is written only if the whole asset was authenticated.
+func (e *Encryption) decryptFile(encryptedPath, targetPath string) error {
+	if !e.clientSide() {
+		return fmt.Errorf("asset was encrypted on client side, set either keypath or passphrase of encryption to decrypt it")
+	}
+
+	source, _, err := openAsset(encryptedPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	target, err := ioutil.TempFile(filepath.Dir(targetPath), filepath.Base(targetPath)+".*"+decryptedSuffix)
+	if err != nil {
+		return err
+	}
+	decryptedPath := target.Name()
+	// Decrypted asset is the client stub, which has to be executable.
+	if err := target.Chmod(0755); err != nil {
+		target.Close()
+		os.Remove(decryptedPath)
+		return err
+	}
+	if err := e.decrypt(target, source); err != nil {
+		target.Close()
+		os.Remove(decryptedPath)
+		return fmt.Errorf("unable to decrypt asset: %v", err)
+	}
+	if err := target.Close(); err != nil {
+		os.Remove(decryptedPath)
+		return err
+	}
+	return os.Rename(decryptedPath, targetPath)
+}
+
+// encrypt writes the envelope of content to w. Content is encrypted with a random data key in chunks of envelopeChunkSize
+// with AES-256-GCM, the last chunk is marked in its additional data so that the truncated envelope is rejected.
+func (e *Encryption) encrypt(w io.Writer, r io.Reader) error {
+	header := make([]byte, envelopeHeaderSize)
+	copy(header, envelopeMagic)
+	if _, err := rand.Read(header[saltOffset:wrappedKeyOffset]); err != nil {
+		return err
+	}
+	if _, err := rand.Read(header[noncePrefixOffset:]); err != nil {
+		return err
+	}
+
+	kek, err := e.keyEncryptionKey(header[saltOffset:keyNonceOffset])
+	if err != nil {
+		return err
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	wrapper, err := newGCM(kek)
+	if err != nil {
+		return err
+	}
+	copy(header[wrappedKeyOffset:noncePrefixOffset], wrapper.Seal(nil, header[keyNonceOffset:wrappedKeyOffset], dataKey, header[:wrappedKeyOffset]))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(r, envelopeChunkSize)
+	chunk := make([]byte, envelopeChunkSize)
+	sealed := make([]byte, 0, envelopeChunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(reader, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		final, err := lastChunk(reader)
+		if err != nil {
+			return err
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(header, counter), chunk[:n], chunkData(header, final))
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decrypt writes the content of envelope read from r to w, it fails if the envelope was tampered or truncated.
+func (e *Encryption) decrypt(w io.Writer, r io.Reader) error {
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:saltOffset]) != envelopeMagic {
+		return fmt.Errorf("asset is not an envelope encrypted by unpackker")
+	}
+
+	kek, err := e.keyEncryptionKey(header[saltOffset:keyNonceOffset])
+	if err != nil {
+		return err
+	}
+	wrapper, err := newGCM(kek)
+	if err != nil {
+		return err
+	}
+	dataKey, err := wrapper.Open(nil, header[keyNonceOffset:wrappedKeyOffset], header[wrappedKeyOffset:noncePrefixOffset], header[:wrappedKeyOffset])
+	if err != nil {
+		return fmt.Errorf("key does not match the one asset was encrypted with")
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(r, envelopeChunkSize+aead.Overhead())
+	sealed := make([]byte, envelopeChunkSize+aead.Overhead())
+	chunk := make([]byte, 0, envelopeChunkSize)
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(reader, sealed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		final, err := lastChunk(reader)
+		if err != nil {
+			return err
+		}
+		chunk, err = aead.Open(chunk[:0], chunkNonce(header, counter), sealed[:n], chunkData(header, final))
+		if err != nil {
+			return fmt.Errorf("asset was either tampered or truncated")
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// keyEncryptionKey returns the key with which the data key is wrapped, read from KeyPath or derived from Passphrase with scrypt.
+func (e *Encryption) keyEncryptionKey(salt []byte) ([]byte, error) {
+	if len(e.KeyPath) != 0 {
+		return readKey(e.KeyPath)
+	}
+	passphrase := e.Passphrase
+	if strings.HasPrefix(passphrase, passphraseEnv) {
+		name := strings.TrimPrefix(passphrase, passphraseEnv)
+		if passphrase = os.Getenv(name); len(passphrase) == 0 {
+			return nil, fmt.Errorf("environment variable %s holding the passphrase of encryption is not set", name)
+		}
+	}
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, keySize)
+}
+
+// readKey reads 32 bytes key from the file, either raw or base64 encoded.
+func readKey(keyPath string) ([]byte, error) {
+	content, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key file: %v", err)
+	}
+	if len(content) == keySize {
+		return content, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("key file %s has to hold %d bytes key either raw or base64 encoded", keyPath, keySize)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// lastChunk reports whether the reader has nothing left to be read.
+func lastChunk(reader *bufio.Reader) (bool, error) {
+	if _, err := reader.Peek(1); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// chunkNonce returns the nonce of the chunk, which is the nonce prefix of the envelope followed by the chunk counter.
+func chunkNonce(header []byte, counter uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[noncePrefixOffset:])
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// chunkData returns the additional data of the chunk, which binds it to the header and marks the last chunk.
+func chunkData(header []byte, final bool) []byte {
+	data := make([]byte, len(header)+1)
+	copy(data, header)
+	if final {
+		data[len(header)] = 1
+	}
+	return data
+}
@@ -0,0 +1,80 @@
+package backend_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestStoreAssetEncryptedConcurrently(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 3<<20)
+
+	// Stores share the asset the way packer stores it to Backend and Backends, each encrypting it with a key of its own.
+	stores := make([]*backend.Store, 0, 3)
+	for i := 0; i < 3; i++ {
+		bucket := fmt.Sprintf("encrypted-%d", i)
+		defer backendtest.ClearMem(t, bucket)
+		store := newTestStore(t, "mem://"+bucket+"/assets", "demo_0_1_0", assetPath)
+		store.Encryption = &backend.Encryption{Passphrase: fmt.Sprintf("passphrase-%d", i)}
+		if err := store.InitBackend(); err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(stores))
+	for i, store := range stores {
+		wg.Add(1)
+		go func(i int, store *backend.Store) {
+			defer wg.Done()
+			errs[i] = store.StoreAsset()
+		}(i, store)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("unable to store asset to %s: %v", stores[i], err)
+		}
+	}
+
+	if left, _ := filepath.Glob(filepath.Join(dir, "*.encrypted")); len(left) != 0 {
+		t.Errorf("encrypted copies of asset were left behind: %v", left)
+	}
+	for i, store := range stores {
+		target := filepath.Join(dir, fmt.Sprintf("fetched-%d", i))
+		fetchTestAsset(t, store, target, content)
+	}
+}
+
+func TestFetchAssetEncryptedWithWrongPassphrase(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer backendtest.ClearMem(t, "encrypted-wrong")
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<20)
+
+	store := newTestStore(t, "mem://encrypted-wrong/assets", "demo_0_1_0", assetPath)
+	store.Encryption = &backend.Encryption{Passphrase: "right"}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Encryption.Passphrase = "wrong"
+	store.TargetPath = filepath.Join(dir, "fetched")
+	if err := store.FetchAsset(); err == nil {
+		t.Fatal("asset was fetched with wrong passphrase")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fetched", "demo_0_1_0")); !os.IsNotExist(err) {
+		t.Errorf("asset which could not be decrypted was placed under target path")
+	}
+}
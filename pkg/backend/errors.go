@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrPermissionDenied is matched by the errors of operations which the credentials are not authorized for.
+	ErrPermissionDenied = errors.New("permission denied by the backend")
+	// ErrTransient is matched by the errors which could go away on retrying the operation, such as 5xx responses,
+	// throttling and connection resets. Operations failing with it are retried as per Store.Retry.
+	ErrTransient = errors.New("transient failure of the backend")
+)
+
+// errorClasses are the errors with which the errors of backends are classified.
+var errorClasses = []error{ErrNotFound, ErrAlreadyExists, ErrPermissionDenied, ErrTransient}
+
+// ErrorClassifier is implemented by the backends which could tell the errors of their provider apart, such as the throttling ones.
+// Errors returned by the operations of Store are classified by it, falling back to the network and file system errors it does not classify.
+type ErrorClassifier interface {
+	// ClassifyError returns ErrNotFound, ErrAlreadyExists, ErrPermissionDenied or ErrTransient for the error of backend, nil if it is none of them.
+	ClassifyError(err error) error
+}
+
+// classifiedError is the error of backend marked with its class, errors.Is matches it with the class along with the errors it wraps.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+// classify marks the error returned by the backend with its class. Errors which already match one of the classes,
+// the ones caused by cancellation and the ones that could not be classified are returned as they are.
+func classify(backend Backend, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, class := range errorClasses {
+		if errors.Is(err, class) {
+			return err
+		}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var class error
+	if classifier, ok := backend.(ErrorClassifier); ok {
+		class = classifier.ClassifyError(err)
+	}
+	if class == nil {
+		class = classifyCommon(err)
+	}
+	if class == nil {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// statusCoder is implemented by the error responses of backends reached over HTTP.
+type statusCoder interface {
+	statusCode() int
+}
+
+// statusError is the error response of the backends which have no error type of their own.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+func (e *statusError) statusCode() int {
+	return e.code
+}
+
+// classifyCommon classifies the errors common to all backends, the HTTP error responses and the failures of network or file system.
+func classifyCommon(err error) error {
+	var status statusCoder
+	if errors.As(err, &status) {
+		return classifyStatus(status.statusCode())
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTransient
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTransient
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// classifyStatus classifies the HTTP status code of the error response.
+func classifyStatus(code int) error {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrPermissionDenied
+	case code == http.StatusNotFound:
+		return ErrNotFound
+	case code == http.StatusPreconditionFailed:
+		return ErrAlreadyExists
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests:
+		return ErrTransient
+	case code >= http.StatusInternalServerError && code != http.StatusNotImplemented:
+		return ErrTransient
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+package backend
+
+// GCSCompositeSize exposes the part size of parallel composite upload to the tests.
+func GCSCompositeSize(partSize, size int64) int64 {
+	return (&gcsBackend{partSize: partSize}).compositeSize(size)
+}
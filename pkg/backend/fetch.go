@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	// MetaDataChecksum is the metadata key under which the SHA-256 of the asset is stored while storing it.
+	MetaDataChecksum = "sha256"
+
+	defaultPartSizeMB  = 16
+	defaultConcurrency = 4
+	partSuffix         = ".part"
+	partStateSuffix    = ".state"
+)
+
+// errRangeUnsupported is returned by GetRange when the backend could not serve a part of the object,
+// FetchAsset falls back to download the whole object when it is returned.
+var errRangeUnsupported = errors.New("range requests are not supported by the backend")
+
+// RangeReader is implemented by the backends which could read a part of the object.
+// FetchAsset uses it to download the asset with parallel range requests and to resume the partial downloads.
+type RangeReader interface {
+	// GetRange returns the reader of length bytes of the object identified by key starting at offset, the caller has to close it.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// fetchState is saved next to the partial download, so that an interrupted fetch downloads only the parts yet to be fetched.
+type fetchState struct {
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Checksum string    `json:"checksum"`
+	PartSize int64     `json:"partsize"`
+	Done     []bool    `json:"done"`
+}
+
+// download fetches the object on to partPath, in parts when the backend supports range requests.
+func (b *Store) download(ctx context.Context, object *Object, partPath string) error {
+	if reader, ok := b.provider().(RangeReader); ok && object.Size > 0 {
+		err := b.downloadRanges(ctx, reader, object, partPath)
+		if err != errRangeUnsupported {
+			return err
+		}
+		removeParts(partPath)
+	}
+
+	if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return b.provider().Get(ctx, object.Key, partPath)
+}
+
+// downloadRanges fetches the parts of the object concurrently and writes them at their offset in partPath.
+// Parts fetched by the earlier attempt are skipped as long as the object has not changed since.
+func (b *Store) downloadRanges(ctx context.Context, reader RangeReader, object *Object, partPath string) error {
+	state := loadFetchState(partPath, object, b.partSize())
+
+	asset, err := helper.CreateFile(partPath)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+	if err := asset.Truncate(object.Size); err != nil {
+		return err
+	}
+
+	pending := make([]int, 0, len(state.Done))
+	for part, done := range state.Done {
+		if !done {
+			pending = append(pending, part)
+		}
+	}
+
+	var mu sync.Mutex
+	return runParts(ctx, b.concurrency(), pending, func(ctx context.Context, part int) error {
+		if err := fetchPart(ctx, reader, object.Key, asset, state, part); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		state.Done[part] = true
+		return saveFetchState(partPath, asset, state)
+	})
+}
+
+// fetchPart downloads the part of the object and writes it at its offset.
+func fetchPart(ctx context.Context, reader RangeReader, key string, asset io.WriterAt, state *fetchState, part int) error {
+	offset, length := partRange(part, state.Size, state.PartSize)
+	rc, err := reader.GetRange(ctx, key, offset, length)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	written, err := io.Copy(&offsetWriter{writer: asset, offset: offset}, io.LimitReader(rc, length))
+	if err != nil {
+		return err
+	}
+	if written != length {
+		return fmt.Errorf("unable to fetch part %d of %s, received %d of %d bytes", part, key, written, length)
+	}
+	return nil
+}
+
+// loadFetchState returns the state of the earlier attempt if it was fetching the same object, else a fresh one.
+func loadFetchState(partPath string, object *Object, partSize int64) *fetchState {
+	state := new(fetchState)
+	if content, err := ioutil.ReadFile(partPath + partStateSuffix); err == nil && json.Unmarshal(content, state) == nil {
+		if state.Key == object.Key && state.Size == object.Size && state.Modified.Equal(object.Modified) &&
+			state.Checksum == object.MetaData[MetaDataChecksum] && helper.Statfile(partPath) {
+			fmt.Println(ui.Info(fmt.Sprintf("Resuming the partial download of %s\n", object.Key)))
+			return state
+		}
+	}
+
+	removeParts(partPath)
+	return &fetchState{
+		Key:      object.Key,
+		Size:     object.Size,
+		Modified: object.Modified,
+		Checksum: object.MetaData[MetaDataChecksum],
+		PartSize: partSize,
+		Done:     make([]bool, partCount(object.Size, partSize)),
+	}
+}
+
+// saveFetchState flushes the parts written so far and records them as done.
+func saveFetchState(partPath string, asset *os.File, state *fetchState) error {
+	if err := asset.Sync(); err != nil {
+		return err
+	}
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(partPath+partStateSuffix, content, 0644)
+}
+
+// removeParts removes the partial download along with its state.
+func removeParts(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partPath + partStateSuffix)
+}
+
+// verifyChecksum compares the SHA-256 of the fetched asset with the one recorded while storing it.
+// Assets stored before checksums were recorded are not verified.
+func verifyChecksum(path, checksum string) error {
+	if len(checksum) == 0 {
+		fmt.Println(ui.Warn("Checksum of the asset was not recorded while storing it, skipping verification\n"))
+		return nil
+	}
+
+	actual, err := helper.FileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if actual != checksum {
+		return fmt.Errorf("checksum of the fetched asset %s does not match the stored one %s", actual, checksum)
+	}
+	return nil
+}
+
+func (b *Store) partSize() int64 {
+	if b.PartSizeMB > 0 {
+		return int64(b.PartSizeMB) << 20
+	}
+	return defaultPartSizeMB << 20
+}
+
+func (b *Store) concurrency() int {
+	if b.Concurrency > 0 {
+		return b.Concurrency
+	}
+	return defaultConcurrency
+}
+
+// offsetWriter writes to the underlying WriterAt sequentially from the offset.
+type offsetWriter struct {
+	writer io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,95 @@
+package backend_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const testPartRange = "bytes=1048576-2097151"
+
+func TestFetchResumesPartialDownload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 3<<20)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.PartSizeMB, store.Concurrency = 1, 1
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	server.fail = func(r *http.Request) int {
+		if r.Header.Get("Range") == testPartRange {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+	store.TargetPath = filepath.Join(dir, "fetched")
+	if err := store.FetchAsset(); err == nil {
+		t.Fatal("expected fetch to fail on the second part")
+	}
+	partPath := filepath.Join(dir, "fetched", "demo_0_1_0.part")
+	if !helper.Statfile(partPath) || !helper.Statfile(partPath+".state") {
+		t.Fatal("partial download was not retained along with its state for resume")
+	}
+
+	server.fail, server.requests = nil, nil
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+	want := []string{"GET /assets/demo_0_1_0 " + testPartRange, "GET /assets/demo_0_1_0 bytes=2097152-3145727"}
+	if got := server.served("GET /assets/demo_0_1_0 "); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected only the parts yet to be fetched to be requested on resume, got %v", got)
+	}
+	if helper.Statfile(partPath) || helper.Statfile(partPath+".state") {
+		t.Errorf("partial download was left behind once the asset was fetched")
+	}
+}
+
+func TestFetchRestartsWhenAssetChanged(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 3<<20)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.PartSizeMB, store.Concurrency = 1, 1
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	server.fail = func(r *http.Request) int {
+		if r.Header.Get("Range") == testPartRange {
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+	store.TargetPath = filepath.Join(dir, "fetched")
+	if err := store.FetchAsset(); err == nil {
+		t.Fatal("expected fetch to fail on the second part")
+	}
+
+	// The version is stored again with other content before the fetch is resumed.
+	server.fail = nil
+	changedPath, changed := newTestAsset(t, dir, "changed", 3<<20+1)
+	store.Path, store.SkipRemoteCheck = changedPath, true
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	server.requests = nil
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), changed)
+	if got := server.served("GET /assets/demo_0_1_0 bytes=0-"); len(got) != 1 {
+		t.Errorf("expected the first part of changed asset to be fetched again, got %v", got)
+	}
+}
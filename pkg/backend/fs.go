@@ -0,0 +1,344 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	// fsMetaDataSuffix is the suffix of sidecar file in which metadata of the asset is saved.
+	fsMetaDataSuffix = ".metadata.json"
+	// fsUploadsDir is the directory under root in which the asset is written before it is moved to its key.
+	fsUploadsDir = ".unpackker"
+)
+
+// fsBackend stores the asset under a root directory in local filesystem, which could as well be a NFS share.
+// Store.Bucket is the root directory, when it is not set asset is left where it was packed.
+type fsBackend struct {
+	root string
+}
+
+func newFSBackend() Backend {
+	return &fsBackend{}
+}
+
+// Init makes sure that the root directory exists.
+func (c *fsBackend) Init(ctx context.Context, store *Store) error {
+	if len(store.Bucket) == 0 {
+		return nil
+	}
+
+	root, err := filepath.Abs(strings.TrimPrefix(store.Bucket, bucketPrefix["fs"]))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("unable to create root directory %s of fs backend: %v", root, err)
+	}
+	c.root = root
+	return nil
+}
+
+// Exists checks for the asset under the root directory.
+func (c *fsBackend) Exists(ctx context.Context, key string) (bool, error) {
+	if len(c.root) == 0 {
+		return false, nil
+	}
+	return helper.Statfile(c.path(key)), nil
+}
+
+// Put copies the asset under the root directory and saves the metadata next to it.
+// Asset is written to a temporary file first and is then moved to its key, by linking it when it has to be created only
+// as link fails if the asset is present. Metadata of the asset created is saved before that and is rolled back if linking fails,
+// so that neither partially written asset nor the one without its checksum is ever visible under its key.
+// Asset replacing the one present is moved first and its sidecar is replaced after, so that failing to move it leaves the previous
+// asset along with its own checksum.
+func (c *fsBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	if len(c.root) == 0 {
+		return nil
+	}
+
+	asset, _, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	temp, err := c.tempFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := io.Copy(temp, progressOf(ctx).reader(helper.ContextReader(ctx, asset))); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path(key)), 0755); err != nil {
+		return err
+	}
+	if !CreateOnly(ctx) {
+		content, err := metaDataContent(meta)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(temp.Name(), c.path(key)); err != nil {
+			return err
+		}
+		return c.replaceFile(c.path(key)+fsMetaDataSuffix, content)
+	}
+
+	rollback, err := c.createMetaData(key, meta)
+	if err != nil {
+		return err
+	}
+	if err := os.Link(temp.Name(), c.path(key)); err != nil {
+		rollback()
+		if os.IsExist(err) {
+			return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get copies the asset from root directory onto the specified location.
+func (c *fsBackend) Get(ctx context.Context, key, path string) error {
+	if len(c.root) == 0 {
+		if !helper.Statfile(path) {
+			return fmt.Errorf("%s: %w", path, ErrNotFound)
+		}
+		return nil
+	}
+
+	if !helper.Statfile(c.path(key)) {
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	asset, err := helper.OpenFile(c.path(key))
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	return writeAsset(path, helper.ContextReader(ctx, asset))
+}
+
+// GetRange reads the part of the asset under the root directory.
+func (c *fsBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if len(c.root) == 0 || !helper.Statfile(c.path(key)) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	asset, err := helper.OpenFile(c.path(key))
+	if err != nil {
+		return nil, err
+	}
+	return &readCloser{Reader: helper.ContextReader(ctx, io.NewSectionReader(asset, offset, length)), Closer: asset}, nil
+}
+
+// List walks through the directory under root and returns all the assets whose key begins with prefix.
+func (c *fsBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	if len(c.root) == 0 {
+		return nil, fmt.Errorf("listing assets requires root directory of fs backend to be set with 'bucket'")
+	}
+
+	objects := make([]*Object, 0)
+	err := filepath.Walk(c.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path == filepath.Join(c.root, fsUploadsDir) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || strings.HasSuffix(path, fsMetaDataSuffix) {
+			return nil
+		}
+
+		key, err := filepath.Rel(c.root, path)
+		if err != nil {
+			return err
+		}
+		key = filepath.ToSlash(key)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		object, err := c.Stat(ctx, key)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// Delete removes the asset along with its metadata from root directory.
+func (c *fsBackend) Delete(ctx context.Context, key string) error {
+	if len(c.root) == 0 {
+		return fmt.Errorf("deleting assets requires root directory of fs backend to be set with 'bucket'")
+	}
+	if !helper.Statfile(c.path(key)) {
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+
+	if err := os.Remove(c.path(key)); err != nil {
+		return err
+	}
+	if err := os.Remove(c.path(key) + fsMetaDataSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat returns the attributes of the asset along with the metadata read from its sidecar file.
+func (c *fsBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	if len(c.root) == 0 {
+		return nil, ErrNotFound
+	}
+
+	info, err := os.Stat(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	meta, err := c.readMetaData(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Key:      key,
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+		MetaData: meta,
+	}, nil
+}
+
+// path returns the path of the asset in local filesystem.
+func (c *fsBackend) path(key string) string {
+	return filepath.Join(c.root, filepath.FromSlash(key))
+}
+
+// tempFile creates the file under the uploads directory of root, which is on the same filesystem as the assets
+// so that it could be moved to its key atomically.
+func (c *fsBackend) tempFile() (*os.File, error) {
+	uploads := filepath.Join(c.root, fsUploadsDir, "uploads")
+	if err := os.MkdirAll(uploads, 0755); err != nil {
+		return nil, err
+	}
+	temp, err := ioutil.TempFile(uploads, "asset-")
+	if err != nil {
+		return nil, err
+	}
+	if err := temp.Chmod(0755); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return nil, err
+	}
+	return temp, nil
+}
+
+// createMetaData saves the metadata of the asset in its sidecar file only if it is not present, by linking it as link fails
+// if the sidecar is present, and returns the function which rolls it back.
+func (c *fsBackend) createMetaData(key string, meta map[string]string) (func(), error) {
+	content, err := metaDataContent(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	sidecar := c.path(key) + fsMetaDataSuffix
+	temp, err := c.writeTemp(content)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp)
+	if err := os.Link(temp, sidecar); err != nil {
+		if os.IsExist(err) {
+			return nil, sidecarExistsError(key, sidecar, helper.Statfile(c.path(key)))
+		}
+		return nil, err
+	}
+	return func() { os.Remove(sidecar) }, nil
+}
+
+// metaDataContent encodes the metadata as it is saved in the sidecar file.
+func metaDataContent(meta map[string]string) ([]byte, error) {
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+	return json.MarshalIndent(meta, "", "  ")
+}
+
+// replaceFile writes the content to a temporary file and moves it to path, replacing the one present.
+func (c *fsBackend) replaceFile(path string, content []byte) error {
+	temp, err := c.writeTemp(content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+	return os.Rename(temp, path)
+}
+
+// writeTemp writes the content to a temporary file under the uploads directory and returns its path.
+func (c *fsBackend) writeTemp(content []byte) (string, error) {
+	temp, err := c.tempFile()
+	if err != nil {
+		return "", err
+	}
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return "", err
+	}
+	if err := temp.Chmod(0644); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return "", err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return "", err
+	}
+	return temp.Name(), nil
+}
+
+// sidecarExistsError is returned by the Put which has to create the asset, when its sidecar is already present.
+// Sidecar without the asset is of the run which is storing the same asset meanwhile, or of the one that was interrupted.
+func sidecarExistsError(key, sidecar string, assetExists bool) error {
+	if assetExists {
+		return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+	}
+	return fmt.Errorf("metadata of %s is present without the asset, it is either being stored by another run or was left by an interrupted one, remove %s in the latter case: %w",
+		key, sidecar, ErrAlreadyExists)
+}
+
+func (c *fsBackend) readMetaData(key string) (map[string]string, error) {
+	meta := make(map[string]string)
+	content, err := ioutil.ReadFile(c.path(key) + fsMetaDataSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("unable to decode metadata of asset %s: %v", key, err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,108 @@
+package backend_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestFSConformance(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store, err := backend.Parse("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Folder = "assets"
+	backendtest.Run(t, store)
+}
+
+// newTestFSStore returns the initialized store of fs backend rooted at dir/root, for the asset demo_0_1_0 of 1KiB.
+func newTestFSStore(t *testing.T, dir string) *backend.Store {
+	t.Helper()
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, "file://"+filepath.Join(dir, "root"), "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "root"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestFSRejectsVersionStoredMeanwhile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store := newTestFSStore(t, dir)
+	// Another run has stored the same version, yet not its sidecar, after this one checked for it.
+	remotePath := filepath.Join(dir, "root", "demo_0_1_0")
+	if err := ioutil.WriteFile(remotePath, []byte("stored meanwhile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := backend.WithCreateOnly(context.Background())
+	if err := store.Backend().Put(ctx, "demo_0_1_0", store.Path, nil); !errors.Is(err, backend.ErrAlreadyExists) {
+		t.Fatalf("expected upload of version stored meanwhile to be rejected, got %v", err)
+	}
+	if content, _ := ioutil.ReadFile(remotePath); string(content) != "stored meanwhile" {
+		t.Errorf("version stored meanwhile was overwritten")
+	}
+	if _, err := os.Stat(remotePath + ".metadata.json"); !os.IsNotExist(err) {
+		t.Errorf("sidecar of asset which was not stored was left behind")
+	}
+	if uploads, _ := ioutil.ReadDir(filepath.Join(dir, "root", ".unpackker", "uploads")); len(uploads) != 0 {
+		t.Errorf("temporary files of upload were left behind: %d", len(uploads))
+	}
+}
+
+func TestFSRejectsVersionBeingStored(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store := newTestFSStore(t, dir)
+	// Another run has saved the sidecar and is yet to move the asset to its key.
+	sidecar := filepath.Join(dir, "root", "demo_0_1_0.metadata.json")
+	if err := ioutil.WriteFile(sidecar, []byte(`{"version":"0.1.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := backend.WithCreateOnly(context.Background())
+	err := store.Backend().Put(ctx, "demo_0_1_0", store.Path, nil)
+	if !errors.Is(err, backend.ErrAlreadyExists) || !strings.Contains(err.Error(), sidecar) {
+		t.Fatalf("expected upload to be rejected naming the sidecar present without asset, got %v", err)
+	}
+	if content, _ := ioutil.ReadFile(sidecar); string(content) != `{"version":"0.1.0"}` {
+		t.Errorf("sidecar of the other run was overwritten")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "root", "demo_0_1_0")); !os.IsNotExist(err) {
+		t.Errorf("asset was stored while the other run was storing it")
+	}
+}
+
+func TestFSKeepsSidecarOfFailedOverwrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	store := newTestFSStore(t, dir)
+	// The asset is a directory that is not empty, which renaming does not replace.
+	remotePath := filepath.Join(dir, "root", "demo_0_1_0")
+	if err := os.MkdirAll(filepath.Join(remotePath, "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(remotePath+".metadata.json", []byte(`{"version":"0.0.9"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Backend().Put(context.Background(), "demo_0_1_0", store.Path, map[string]string{backend.MetaDataVersion: "0.1.0"}); err == nil {
+		t.Fatal("expected overwriting the asset to fail")
+	}
+	if sidecar, _ := ioutil.ReadFile(remotePath + ".metadata.json"); string(sidecar) != `{"version":"0.0.9"}` {
+		t.Errorf("sidecar of asset was replaced by the overwrite which failed, got %s", sidecar)
+	}
+}
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// gcsBackend stores the asset in google cloud storage.
+type gcsBackend struct {
+	bucket      string
+	endpoint    string
+	kmsKey      string
+	partSize    int64
+	concurrency int
+	gcpClient   *storage.Client
+	// credentials with which the client was initialized, the URLs are signed with them.
+	credsPath   string
+	credsType   string
+	credentials *Credentials
+}
+
+func newGCSBackend() Backend {
+	return &gcsBackend{}
+}
+
+// Init initializes the client of google cloud storage with the credentials configured.
+func (c *gcsBackend) Init(ctx context.Context, store *Store) error {
+	c.bucket, c.endpoint = store.Bucket, store.Endpoint
+	if store.Encryption != nil {
+		c.kmsKey = store.Encryption.KMSKey
+	}
+	c.partSize = store.partSize()
+	c.concurrency = store.concurrency()
+	c.credsPath, c.credsType, c.credentials = store.CredentialPath, store.CredentialType, store.credentials()
+	if err := c.getClient(ctx, store.CredentialPath, store.CredentialType, store.credentials()); err != nil {
+		return &CredentialError{Cloud: "gcp", Type: store.CredentialType, Err: err}
+	}
+	return nil
+}
+
+// Exists checks for the object in GCS bucket.
+func (c *gcsBackend) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := c.Stat(ctx, key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Put makes sure that that the asset is stored to specified GCS bucket, assets larger than part size are stored in parts.
+func (c *gcsBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	asset, size, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	if size > c.partSize {
+		return c.putComposite(ctx, key, path, meta)
+	}
+
+	// Object is created by GCS only when the writer is closed, hence partially written asset is never visible.
+	wc := c.object(ctx, key).NewWriter(ctx)
+	wc.Metadata = meta
+	wc.KMSKeyName = c.kmsKey
+
+	if _, err := io.Copy(wc, progressOf(ctx).reader(asset)); err != nil {
+		wc.Close()
+		return gcsWriteError(key, err)
+	}
+
+	if err := wc.Close(); err != nil {
+		return gcsWriteError(key, fmt.Errorf("Writer.Close: %w", err))
+	}
+	return nil
+}
+
+// object returns the handle of object to be written, it is conditioned on the object not being present when Put was asked to create it only.
+func (c *gcsBackend) object(ctx context.Context, key string) *storage.ObjectHandle {
+	object := c.gcpClient.Bucket(c.bucket).Object(key)
+	if CreateOnly(ctx) {
+		return object.If(storage.Conditions{DoesNotExist: true})
+	}
+	return object
+}
+
+// gcsWriteError returns ErrAlreadyExists when the write was rejected by DoesNotExist precondition.
+func gcsWriteError(key string, err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+	}
+	return err
+}
+
+// ClassifyError classifies the errors of google cloud storage by their status code.
+func (c *gcsBackend) ClassifyError(err error) error {
+	if errors.Is(err, storage.ErrObjectNotExist) || errors.Is(err, storage.ErrBucketNotExist) {
+		return ErrNotFound
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return classifyStatus(apiErr.Code)
+	}
+	return nil
+}
+
+// Get makes sure that the asset is fetched from specified GCS bucket onto the specified location.
+func (c *gcsBackend) Get(ctx context.Context, key, path string) error {
+	rc, err := c.gcpClient.Bucket(c.bucket).Object(key).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return err
+	}
+	defer rc.Close()
+
+	return writeAsset(path, rc)
+}
+
+// GetRange reads the part of the object from GCS bucket.
+func (c *gcsBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := c.gcpClient.Bucket(c.bucket).Object(key).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	return rc, nil
+}
+
+// List returns the objects under the prefix in GCS bucket.
+func (c *gcsBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	objects := make([]*Object, 0)
+	it := c.gcpClient.Bucket(c.bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, c.toObject(attrs))
+	}
+	return objects, nil
+}
+
+// Delete removes the object from GCS bucket.
+func (c *gcsBackend) Delete(ctx context.Context, key string) error {
+	if err := c.gcpClient.Bucket(c.bucket).Object(key).Delete(ctx); err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Stat returns the attributes of the object stored in GCS bucket.
+func (c *gcsBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	attrs, err := c.gcpClient.Bucket(c.bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return c.toObject(attrs), nil
+}
+
+func (c *gcsBackend) toObject(attrs *storage.ObjectAttrs) *Object {
+	return &Object{
+		Key:      attrs.Name,
+		Size:     attrs.Size,
+		Modified: attrs.Updated,
+		MetaData: attrs.Metadata,
+		ETag:     strconv.FormatInt(attrs.Generation, 10),
+	}
+}
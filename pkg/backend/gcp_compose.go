@@ -0,0 +1,201 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	// gcsUploadsPrefix is the prefix under which the parts of the asset are stored as temporary objects until they are composed.
+	gcsUploadsPrefix = ".unpackker/uploads/"
+	// gcsComposeLimit is the maximum number of objects GCS composes at once.
+	gcsComposeLimit = 32
+	// gcsMaxComponents is the maximum number of components of the composite object, counting the ones of intermediate composites.
+	gcsMaxComponents = 1024
+)
+
+// putComposite stores the asset as parallel composite upload, where the parts are stored as temporary objects concurrently
+// and then composed into the object. Parts stored by an interrupted upload are not stored again,
+// but the ones stored by the upload cancelled with ctx are deleted.
+func (c *gcsBackend) putComposite(ctx context.Context, key, assetPath string, meta map[string]string) error {
+	asset, err := helper.OpenFile(assetPath)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+	info, err := asset.Stat()
+	if err != nil {
+		return err
+	}
+
+	partSize := c.compositeSize(info.Size())
+	statePath := uploadStatePath(assetPath, "gs", c.bucket)
+	state := loadUploadState(statePath, key, info.Size(), meta, partSize)
+	tracker := progressOf(ctx)
+	count := partCount(info.Size(), partSize)
+	pending := make([]int, 0, count)
+	for part := 0; part < count; part++ {
+		_, length := partRange(part, info.Size(), partSize)
+		if name, ok := state.Parts[part]; ok && c.partStored(ctx, name, length) {
+			tracker.resume(length)
+			continue
+		}
+		delete(state.Parts, part)
+		pending = append(pending, part)
+	}
+
+	var mu sync.Mutex
+	err = runParts(ctx, c.concurrency, pending, func(ctx context.Context, part int) error {
+		offset, length := partRange(part, info.Size(), partSize)
+		name := fmt.Sprintf("%s%s/part-%05d", gcsUploadsPrefix, key, part)
+
+		wc := c.gcpClient.Bucket(c.bucket).Object(name).NewWriter(ctx)
+		wc.KMSKeyName = c.kmsKey
+		if _, err := io.Copy(wc, tracker.reader(io.NewSectionReader(asset, offset, length))); err != nil {
+			wc.Close()
+			return err
+		}
+		if err := wc.Close(); err != nil {
+			return fmt.Errorf("unable to store part %d of %s: %w", part, key, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		state.Parts[part] = name
+		return state.save(statePath)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			c.discardParts(ctx, state, statePath)
+		}
+		return err
+	}
+
+	parts := make([]string, count)
+	for part := range parts {
+		parts[part] = state.Parts[part]
+	}
+	if err := c.compose(ctx, key, parts, meta); err != nil {
+		if errors.Is(err, ErrAlreadyExists) || ctx.Err() != nil {
+			// Asset was stored by another upload or the upload was cancelled, parts of this one would never be composed.
+			c.discardParts(ctx, state, statePath)
+		}
+		return err
+	}
+
+	if err := c.deleteTemporary(ctx, parts); err != nil {
+		return err
+	}
+	removeUploadState(statePath)
+	return nil
+}
+
+// compositeSize returns the part size within the limits of GCS, it is raised for the assets that would otherwise need more than gcsMaxComponents.
+func (c *gcsBackend) compositeSize(size int64) int64 {
+	partSize := c.partSize
+	if minimum := (size + gcsMaxComponents - 1) / gcsMaxComponents; partSize < minimum {
+		partSize = minimum
+	}
+	return partSize
+}
+
+// discardParts deletes the parts recorded in state and the object into which they were being composed, along with the state.
+func (c *gcsBackend) discardParts(ctx context.Context, state *uploadState, statePath string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	parts := []string{gcsStagingName(state.Key)}
+	for _, name := range state.Parts {
+		parts = append(parts, name)
+	}
+	c.deleteTemporary(ctx, parts)
+	removeUploadState(statePath)
+}
+
+// deleteTemporary deletes the temporary objects created while storing the asset in parts.
+func (c *gcsBackend) deleteTemporary(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if err := c.gcpClient.Bucket(c.bucket).Object(name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("unable to delete temporary object %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// gcsStagingName returns the name of the temporary object into which the parts of the asset are composed before it is stored under key.
+func gcsStagingName(key string) string {
+	return fmt.Sprintf("%s%s/composed", gcsUploadsPrefix, key)
+}
+
+// partStored reports whether the temporary object holding the part is present with expected size.
+func (c *gcsBackend) partStored(ctx context.Context, name string, length int64) bool {
+	attrs, err := c.gcpClient.Bucket(c.bucket).Object(name).Attrs(ctx)
+	return err == nil && attrs.Size == length
+}
+
+// compose composes the parts into the object. More than gcsComposeLimit parts are first composed into a temporary object
+// by appending them in batches, so that partially composed asset is never visible under key.
+// Compose does not take the KMS key of the object, hence the parts are composed into the temporary object which is
+// then rewritten to the object with the key when asset has to be encrypted with customer managed key.
+func (c *gcsBackend) compose(ctx context.Context, key string, parts []string, meta map[string]string) error {
+	bucket := c.gcpClient.Bucket(c.bucket)
+	if len(parts) > gcsComposeLimit || len(c.kmsKey) != 0 {
+		staging := gcsStagingName(key)
+		composed := false
+		for len(parts) != 0 {
+			sources := make([]*storage.ObjectHandle, 0, gcsComposeLimit)
+			if composed {
+				sources = append(sources, bucket.Object(staging))
+			}
+			batch := gcsComposeLimit - len(sources)
+			if batch > len(parts) {
+				batch = len(parts)
+			}
+			for _, part := range parts[:batch] {
+				sources = append(sources, bucket.Object(part))
+			}
+			parts = parts[batch:]
+
+			if _, err := bucket.Object(staging).ComposerFrom(sources...).Run(ctx); err != nil {
+				return fmt.Errorf("unable to compose parts of %s: %w", key, err)
+			}
+			composed = true
+		}
+		defer c.deleteTemporary(ctx, []string{staging})
+		parts = []string{staging}
+	}
+
+	if len(c.kmsKey) != 0 {
+		copier := c.object(ctx, key).CopierFrom(bucket.Object(parts[0]))
+		copier.ContentType = "application/octet-stream"
+		copier.Metadata = meta
+		copier.DestinationKMSKeyName = c.kmsKey
+		if _, err := copier.Run(ctx); err != nil {
+			if err := gcsWriteError(key, err); errors.Is(err, ErrAlreadyExists) {
+				return err
+			}
+			return fmt.Errorf("unable to encrypt composed parts of %s with kms key: %w", key, err)
+		}
+		return nil
+	}
+
+	sources := make([]*storage.ObjectHandle, 0, len(parts))
+	for _, part := range parts {
+		sources = append(sources, bucket.Object(part))
+	}
+	composer := c.object(ctx, key).ComposerFrom(sources...)
+	composer.ContentType = "application/octet-stream"
+	composer.Metadata = meta
+	if _, err := composer.Run(ctx); err != nil {
+		if err := gcsWriteError(key, err); errors.Is(err, ErrAlreadyExists) {
+			return err
+		}
+		return fmt.Errorf("unable to compose parts of %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+const (
+	gcpCloudPlatformScope  = "https://www.googleapis.com/auth/cloud-platform"
+	gcpGenerateTokenURL    = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:generateAccessToken"
+	gcpTokenLifetime       = "3600s"
+	gcpExternalAccountType = "external_account"
+)
+
+// gcpExternalAccountConfig is the configuration of workload identity federation, as generated by
+// gcloud iam workload-identity-pools create-cred-config. Only the subject tokens read from file are supported.
+type gcpExternalAccountConfig struct {
+	Type                           string `json:"type"`
+	Audience                       string `json:"audience"`
+	SubjectTokenType               string `json:"subject_token_type"`
+	TokenURL                       string `json:"token_url"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		File   string `json:"file"`
+		Format struct {
+			Type                  string `json:"type"`
+			SubjectTokenFieldName string `json:"subject_token_field_name"`
+		} `json:"format"`
+	} `json:"credential_source"`
+}
+
+// getClient initializes the client of google cloud storage with the credentials of the type configured, see Credentials for the types.
+// Client outlives ctx, hence only the requests made while initializing it are cancelled along with ctx.
+func (c *gcsBackend) getClient(ctx context.Context, credsPath, credstype string, options *Credentials) error {
+	clientOptions, err := gcpClientOptions(ctx, credsPath, credstype, options)
+	if err != nil {
+		return err
+	}
+	if len(c.endpoint) != 0 {
+		clientOptions = append(clientOptions, option.WithEndpoint(c.endpoint))
+	}
+	client, err := storage.NewClient(detach(ctx), clientOptions...)
+	if err != nil {
+		return fmt.Errorf("gcp.NewClient: %v", err)
+	}
+	c.gcpClient = client
+	return nil
+}
+
+// gcpClientOptions returns the options carrying the credentials of the type. Tokens of impersonated and federated identities
+// are fetched once here with ctx, so that the misconfigured ones are reported before the asset is touched.
+// Later tokens are fetched by the source which is not cancelled along with ctx, as the client outlives it.
+func gcpClientOptions(ctx context.Context, credsPath, credstype string, options *Credentials) ([]option.ClientOption, error) {
+	var newSource func(ctx context.Context) (oauth2.TokenSource, error)
+	switch credstype {
+	case "default":
+		return nil, nil
+	case "file":
+		return []option.ClientOption{option.WithCredentialsFile(credsPath)}, nil
+	case "impersonate":
+		if len(options.ServiceAccount) == 0 {
+			return nil, fmt.Errorf("service account to be impersonated has to be set with 'serviceaccount' of credentials")
+		}
+		newSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+			base, err := gcpBaseCredentials(ctx, credsPath)
+			if err != nil {
+				return nil, err
+			}
+			return &gcpImpersonation{
+				ctx:       ctx,
+				base:      base.TokenSource,
+				url:       fmt.Sprintf(gcpGenerateTokenURL, url.PathEscape(options.ServiceAccount)),
+				delegates: options.Delegates,
+			}, nil
+		}
+	case "workloadidentity":
+		if len(credsPath) == 0 {
+			return nil, fmt.Errorf("workload identity federation configuration has to be set with 'credspath'")
+		}
+		config, err := readExternalAccountConfig(credsPath)
+		if err != nil {
+			return nil, err
+		}
+		newSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+			var source oauth2.TokenSource = &gcpExternalAccount{ctx: ctx, config: config, tokenPath: firstSet(options.TokenPath, config.CredentialSource.File)}
+			if len(config.ServiceAccountImpersonationURL) != 0 {
+				source = &gcpImpersonation{ctx: ctx, base: oauth2.ReuseTokenSource(nil, source), url: config.ServiceAccountImpersonationURL}
+			}
+			return source, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported gcp client initialization")
+	}
+
+	source, err := newSource(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if source, err = newSource(detach(ctx)); err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithTokenSource(oauth2.ReuseTokenSource(token, source))}, nil
+}
+
+// gcpBaseCredentials returns the credentials with which the service account is impersonated,
+// from the key at credsPath if set else the application default credentials.
+func gcpBaseCredentials(ctx context.Context, credsPath string) (*google.Credentials, error) {
+	if len(credsPath) == 0 {
+		return google.FindDefaultCredentials(ctx, gcpCloudPlatformScope)
+	}
+	content, err := ioutil.ReadFile(credsPath)
+	if err != nil {
+		return nil, err
+	}
+	return google.CredentialsFromJSON(ctx, content, gcpCloudPlatformScope)
+}
+
+func readExternalAccountConfig(credsPath string) (*gcpExternalAccountConfig, error) {
+	content, err := ioutil.ReadFile(credsPath)
+	if err != nil {
+		return nil, err
+	}
+	config := new(gcpExternalAccountConfig)
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("invalid workload identity federation configuration %s: %v", credsPath, err)
+	}
+	if config.Type != gcpExternalAccountType || len(config.Audience) == 0 || len(config.TokenURL) == 0 {
+		return nil, fmt.Errorf("%s is not a workload identity federation configuration of type %s with audience and token_url", credsPath, gcpExternalAccountType)
+	}
+	return config, nil
+}
+
+// gcpImpersonation is the source of access tokens of service account, generated with the token of base identity.
+type gcpImpersonation struct {
+	ctx       context.Context
+	base      oauth2.TokenSource
+	url       string
+	delegates []string
+}
+
+func (s *gcpImpersonation) Token() (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"delegates": gcpDelegates(s.delegates),
+		"scope":     []string{gcpCloudPlatformScope},
+		"lifetime":  gcpTokenLifetime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := oauth2.NewClient(s.ctx, s.base).Do(req.WithContext(s.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to impersonate service account: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := decodeTokenResponse(resp, &token); err != nil {
+		return nil, fmt.Errorf("unable to impersonate service account: %v", err)
+	}
+	return &oauth2.Token{AccessToken: token.AccessToken, TokenType: "Bearer", Expiry: token.ExpireTime}, nil
+}
+
+// gcpExternalAccount is the source of federated access tokens, exchanged for the subject token read from tokenPath.
+type gcpExternalAccount struct {
+	ctx       context.Context
+	config    *gcpExternalAccountConfig
+	tokenPath string
+}
+
+func (s *gcpExternalAccount) Token() (*oauth2.Token, error) {
+	subjectToken, err := s.subjectToken()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {s.config.Audience},
+		"scope":                {gcpCloudPlatformScope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {s.config.SubjectTokenType},
+	}
+	req, err := http.NewRequest(http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req.WithContext(s.ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to exchange subject token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := decodeTokenResponse(resp, &token); err != nil {
+		return nil, fmt.Errorf("unable to exchange subject token: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// subjectToken reads the token of workload from its file, which is either the token itself or json holding it.
+func (s *gcpExternalAccount) subjectToken() (string, error) {
+	if len(s.tokenPath) == 0 {
+		return "", fmt.Errorf("subject token file is neither in credential_source of the configuration nor set with 'tokenpath' of credentials")
+	}
+	content, err := ioutil.ReadFile(s.tokenPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to read subject token: %v", err)
+	}
+	format := s.config.CredentialSource.Format
+	if format.Type != "json" {
+		return strings.TrimSpace(string(content)), nil
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return "", fmt.Errorf("subject token file %s is not json: %v", s.tokenPath, err)
+	}
+	token, ok := fields[format.SubjectTokenFieldName].(string)
+	if !ok {
+		return "", fmt.Errorf("subject token file %s has no field %s", s.tokenPath, format.SubjectTokenFieldName)
+	}
+	return token, nil
+}
+
+// gcpDelegates returns the resource names of the delegate service accounts.
+func gcpDelegates(delegates []string) []string {
+	names := make([]string, 0, len(delegates))
+	for _, delegate := range delegates {
+		names = append(names, "projects/-/serviceAccounts/"+delegate)
+	}
+	return names
+}
+
+// decodeTokenResponse decodes the token from the response, error response is returned along with its body.
+func decodeTokenResponse(resp *http.Response, token interface{}) error {
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(content)))
+	}
+	return json.Unmarshal(content, token)
+}
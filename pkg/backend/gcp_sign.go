@@ -0,0 +1,130 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcpSignBlobURL          = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:signBlob"
+	gcpGenerateTokenSuffix  = ":generateAccessToken"
+	gcpSignBlobSuffix       = ":signBlob"
+	gcpServiceAccountPrefix = "serviceAccounts/"
+)
+
+// SignedURL returns the V4 signed URL of the object in GCS bucket, valid until expiry elapses.
+// It is signed with the key of service account, or through IAM by the service account impersonated when there is no key.
+func (c *gcsBackend) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	options, err := c.signedURLOptions(ctx)
+	if err != nil {
+		return "", err
+	}
+	options.Method = http.MethodGet
+	options.Expires = time.Now().Add(expiry)
+	options.Scheme = storage.SigningSchemeV4
+	return storage.SignedURL(c.bucket, key, options)
+}
+
+// signedURLOptions returns the options carrying the service account which signs the URL along with the means to sign it.
+func (c *gcsBackend) signedURLOptions(ctx context.Context) (*storage.SignedURLOptions, error) {
+	switch c.credsType {
+	case "file":
+		content, err := ioutil.ReadFile(c.credsPath)
+		if err != nil {
+			return nil, err
+		}
+		return gcpKeySigner(content)
+	case "default":
+		credentials, err := google.FindDefaultCredentials(ctx, gcpCloudPlatformScope)
+		if err != nil {
+			return nil, err
+		}
+		if len(credentials.JSON) == 0 {
+			return nil, fmt.Errorf("application default credentials hold no service account key to sign the URL, use credstype file or impersonate")
+		}
+		return gcpKeySigner(credentials.JSON)
+	case "impersonate":
+		base, err := gcpBaseCredentials(ctx, c.credsPath)
+		if err != nil {
+			return nil, err
+		}
+		signBlobURL := fmt.Sprintf(gcpSignBlobURL, url.PathEscape(c.credentials.ServiceAccount))
+		return &storage.SignedURLOptions{
+			GoogleAccessID: c.credentials.ServiceAccount,
+			SignBytes:      gcpSignBlob(ctx, base.TokenSource, signBlobURL, c.credentials.Delegates),
+		}, nil
+	case "workloadidentity":
+		config, err := readExternalAccountConfig(c.credsPath)
+		if err != nil {
+			return nil, err
+		}
+		impersonationURL := config.ServiceAccountImpersonationURL
+		start := strings.LastIndex(impersonationURL, gcpServiceAccountPrefix)
+		if start < 0 || !strings.HasSuffix(impersonationURL, gcpGenerateTokenSuffix) {
+			return nil, fmt.Errorf("URL could be signed only by the service account impersonated by workload identity federation, set service_account_impersonation_url in %s", c.credsPath)
+		}
+		serviceAccount, err := url.PathUnescape(strings.TrimSuffix(impersonationURL[start+len(gcpServiceAccountPrefix):], gcpGenerateTokenSuffix))
+		if err != nil {
+			return nil, err
+		}
+		source := oauth2.ReuseTokenSource(nil, &gcpExternalAccount{ctx: ctx, config: config, tokenPath: firstSet(c.credentials.TokenPath, config.CredentialSource.File)})
+		return &storage.SignedURLOptions{
+			GoogleAccessID: serviceAccount,
+			SignBytes:      gcpSignBlob(ctx, source, strings.TrimSuffix(impersonationURL, gcpGenerateTokenSuffix)+gcpSignBlobSuffix, nil),
+		}, nil
+	}
+	return nil, fmt.Errorf("URL could not be signed with credentials of type %s", c.credsType)
+}
+
+// gcpKeySigner returns the options signing the URL with the key of service account.
+func gcpKeySigner(content []byte) (*storage.SignedURLOptions, error) {
+	config, err := google.JWTConfigFromJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("URL could be signed only with the key of service account: %v", err)
+	}
+	return &storage.SignedURLOptions{GoogleAccessID: config.Email, PrivateKey: config.PrivateKey}, nil
+}
+
+// gcpSignBlob returns the function signing the bytes through IAM, as the service account of signBlobURL impersonated with the token of source.
+func gcpSignBlob(ctx context.Context, source oauth2.TokenSource, signBlobURL string, delegates []string) func([]byte) ([]byte, error) {
+	return func(payload []byte) ([]byte, error) {
+		body, err := json.Marshal(map[string]interface{}{
+			"delegates": gcpDelegates(delegates),
+			"payload":   base64.StdEncoding.EncodeToString(payload),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, signBlobURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := oauth2.NewClient(ctx, source).Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("unable to sign through IAM: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var signed struct {
+			SignedBlob string `json:"signedBlob"`
+		}
+		if err := decodeTokenResponse(resp, &signed); err != nil {
+			return nil, fmt.Errorf("unable to sign through IAM: %v", err)
+		}
+		return base64.StdEncoding.DecodeString(signed.SignedBlob)
+	}
+}
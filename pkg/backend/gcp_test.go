@@ -0,0 +1,787 @@
+package backend_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testServiceAccount = "unpackker@unpackker.iam.gserviceaccount.com"
+	testDeployer       = "deployer@unpackker.iam.gserviceaccount.com"
+	testDelegate       = "delegate@unpackker.iam.gserviceaccount.com"
+	testSubjectToken   = "workload-token"
+	testKMSKey         = "projects/unpackker/locations/global/keyRings/assets/cryptoKeys/demo"
+)
+
+// testGCS is the in-memory GCS serving the subset of its JSON API, and of the XML API reading objects, used by the gcp backend.
+// It serves the oauth2, STS and IAM credentials endpoints as well, which issue the tokens the storage requests are authorized with.
+// It is served over TLS, as the client reads objects over https unless STORAGE_EMULATOR_HOST is set, which drops the credentials.
+type testGCS struct {
+	mu         sync.Mutex
+	objects    map[string]*testGCSObject
+	generation int64
+	server     *httptest.Server
+	// requests are the operations served, named by the operation and the object, such as compose assets/demo_0_1_0.
+	requests []string
+	// tokens are the access tokens issued, bearer is the one with which the last storage request was authorized.
+	tokens map[string]bool
+	bearer string
+	// keyPath is the key of service account whose token_uri is the one of stand-in.
+	keyPath string
+	// restore restores http.DefaultTransport, which trusts the stand-in until it is closed.
+	restore func()
+	// fail is consulted for every request while the stand-in is locked, status returned for it is served instead when set.
+	fail func(operation, name string) int
+}
+
+type testGCSObject struct {
+	content    []byte
+	metadata   map[string]string
+	kmsKey     string
+	generation int64
+	updated    time.Time
+}
+
+// testGCSResource is the object resource of JSON API.
+type testGCSResource struct {
+	Bucket      string            `json:"bucket"`
+	Name        string            `json:"name"`
+	Size        int64             `json:"size,string"`
+	Generation  int64             `json:"generation,string"`
+	Updated     string            `json:"updated"`
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	KMSKeyName  string            `json:"kmsKeyName,omitempty"`
+}
+
+func newTestGCS(t *testing.T) *testGCS {
+	t.Helper()
+	gcs := &testGCS{objects: make(map[string]*testGCSObject), tokens: make(map[string]bool)}
+	gcs.server = httptest.NewTLSServer(gcs)
+	gcs.restore = trustTestServer(gcs.server)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "unpackker",
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"client_email":   testServiceAccount,
+		"client_id":      "1",
+		"token_uri":      gcs.server.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := ioutil.TempFile("", "unpackker-gcs-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyFile.Close()
+	if _, err := keyFile.Write(encoded); err != nil {
+		t.Fatal(err)
+	}
+	gcs.keyPath = keyFile.Name()
+	return gcs
+}
+
+func (s *testGCS) close() {
+	s.server.Close()
+	os.Remove(s.keyPath)
+	s.restore()
+}
+
+// uri returns the backend URI of the folder in the bucket of stand-in, authorized with the key of service account.
+func (s *testGCS) uri(folder string) string {
+	return fmt.Sprintf("gs://unpackker/%s?endpoint=%s/storage/v1/&credstype=file&credspath=%s", folder, s.server.URL, s.keyPath)
+}
+
+// iamContext returns the context whose oauth2 client sends the requests meant for IAM credentials API to the stand-in.
+func (s *testGCS) iamContext() context.Context {
+	target, _ := url.Parse(s.server.URL)
+	return context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: &testRedirect{target: target}})
+}
+
+// served returns the requests served whose operation and object begin with prefix.
+func (s *testGCS) served(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	served := make([]string, 0)
+	for _, request := range s.requests {
+		if strings.HasPrefix(request, prefix) {
+			served = append(served, request)
+		}
+	}
+	return served
+}
+
+// temporary returns the names of the temporary objects left in the bucket.
+func (s *testGCS) temporary() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0)
+	for name := range s.objects {
+		if strings.HasPrefix(name, ".unpackker/") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s *testGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	escaped := r.URL.EscapedPath()
+	switch {
+	case escaped == "/token":
+		s.token(w, r)
+	case strings.HasPrefix(escaped, "/v1/projects/-/serviceAccounts/"):
+		s.iam(w, r, strings.TrimPrefix(escaped, "/v1/projects/-/serviceAccounts/"))
+	case strings.HasPrefix(escaped, "/upload/storage/v1/b/unpackker/o"):
+		if s.authorize(w, r, "upload", r.URL.Query().Get("name")) {
+			s.upload(w, r)
+		}
+	case strings.HasPrefix(escaped, "/storage/v1/b/unpackker/o"):
+		s.objectsAPI(w, r, strings.TrimPrefix(strings.TrimPrefix(escaped, "/storage/v1/b/unpackker/o"), "/"))
+	case strings.HasPrefix(r.URL.Path, "/unpackker/"):
+		name := strings.TrimPrefix(r.URL.Path, "/unpackker/")
+		if s.authorize(w, r, "read", name) {
+			s.read(w, r, name)
+		}
+	default:
+		s.error(w, http.StatusNotFound)
+	}
+}
+
+// authorize records the storage request and serves the error for it unless it is authorized with a token issued.
+func (s *testGCS) authorize(w http.ResponseWriter, r *http.Request, operation, name string) bool {
+	s.requests = append(s.requests, operation+" "+name)
+	s.bearer = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !s.tokens[s.bearer] {
+		s.error(w, http.StatusUnauthorized)
+		return false
+	}
+	if s.fail != nil {
+		if status := s.fail(operation, name); status != 0 {
+			s.error(w, status)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *testGCS) objectsAPI(w http.ResponseWriter, r *http.Request, escaped string) {
+	if len(escaped) == 0 {
+		if s.authorize(w, r, "list", r.URL.Query().Get("prefix")) {
+			s.list(w, r.URL.Query().Get("prefix"))
+		}
+		return
+	}
+	query := r.URL.Query()
+	if index := strings.Index(escaped, "/rewriteTo/b/unpackker/o/"); index != -1 {
+		source, _ := url.PathUnescape(escaped[:index])
+		name, _ := url.PathUnescape(escaped[index+len("/rewriteTo/b/unpackker/o/"):])
+		if !s.authorize(w, r, "rewrite", name) || !s.precondition(w, query, name) {
+			return
+		}
+		object, ok := s.objects[source]
+		if !ok {
+			s.error(w, http.StatusNotFound)
+			return
+		}
+		var destination testGCSResource
+		json.NewDecoder(r.Body).Decode(&destination)
+		s.put(name, object.content, destination.Metadata, query.Get("destinationKmsKeyName"))
+		s.json(w, map[string]interface{}{
+			"kind": "storage#rewriteResponse", "done": true, "resource": s.resource(name),
+			"totalBytesRewritten": strconv.Itoa(len(object.content)), "objectSize": strconv.Itoa(len(object.content)),
+		})
+		return
+	}
+	if strings.HasSuffix(escaped, "/compose") {
+		name, _ := url.PathUnescape(strings.TrimSuffix(escaped, "/compose"))
+		if !s.authorize(w, r, "compose", name) || !s.precondition(w, query, name) {
+			return
+		}
+		var compose struct {
+			Destination   testGCSResource `json:"destination"`
+			SourceObjects []struct {
+				Name string `json:"name"`
+			} `json:"sourceObjects"`
+		}
+		json.NewDecoder(r.Body).Decode(&compose)
+		content := make([]byte, 0)
+		for _, source := range compose.SourceObjects {
+			object, ok := s.objects[source.Name]
+			if !ok {
+				s.error(w, http.StatusNotFound)
+				return
+			}
+			content = append(content, object.content...)
+		}
+		s.put(name, content, compose.Destination.Metadata, "")
+		s.json(w, s.resource(name))
+		return
+	}
+
+	name, _ := url.PathUnescape(escaped)
+	operation := "attrs"
+	if r.Method == http.MethodDelete {
+		operation = "delete"
+	}
+	if !s.authorize(w, r, operation, name) {
+		return
+	}
+	if _, ok := s.objects[name]; !ok {
+		s.error(w, http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.json(w, s.resource(name))
+}
+
+// precondition serves the error when the object is present while it was asked to be written only if it does not exist.
+func (s *testGCS) precondition(w http.ResponseWriter, query url.Values, name string) bool {
+	if _, exists := s.objects[name]; exists && query.Get("ifGenerationMatch") == "0" {
+		s.error(w, http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// upload stores the object of multipart upload, whose first part is the object resource and second one its content.
+func (s *testGCS) upload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("uploadType") != "multipart" {
+		s.error(w, http.StatusNotImplemented)
+		return
+	}
+	name := query.Get("name")
+	if !s.precondition(w, query, name) {
+		return
+	}
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		s.error(w, http.StatusBadRequest)
+		return
+	}
+	parts := multipart.NewReader(r.Body, params["boundary"])
+	var resource testGCSResource
+	part, err := parts.NextPart()
+	if err == nil {
+		err = json.NewDecoder(part).Decode(&resource)
+	}
+	if err == nil {
+		part, err = parts.NextPart()
+	}
+	if err != nil {
+		s.error(w, http.StatusBadRequest)
+		return
+	}
+	content, _ := ioutil.ReadAll(part)
+	kmsKey := query.Get("kmsKeyName")
+	if len(kmsKey) == 0 {
+		kmsKey = resource.KMSKeyName
+	}
+	s.put(name, content, resource.Metadata, kmsKey)
+	s.json(w, s.resource(name))
+}
+
+func (s *testGCS) read(w http.ResponseWriter, r *http.Request, name string) {
+	object, ok := s.objects[name]
+	if !ok {
+		s.error(w, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("X-Goog-Generation", strconv.FormatInt(object.generation, 10))
+	content := object.content
+	if ranged := r.Header.Get("Range"); len(ranged) != 0 {
+		bounds := strings.SplitN(strings.TrimPrefix(ranged, "bytes="), "-", 2)
+		start, _ := strconv.Atoi(bounds[0])
+		end := len(content) - 1
+		if len(bounds[1]) != 0 {
+			end, _ = strconv.Atoi(bounds[1])
+		}
+		content = content[start : end+1]
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(object.content)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	}
+	w.Write(content)
+}
+
+func (s *testGCS) list(w http.ResponseWriter, prefix string) {
+	items := make([]*testGCSResource, 0)
+	for name := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			items = append(items, s.resource(name))
+		}
+	}
+	s.json(w, map[string]interface{}{"kind": "storage#objects", "items": items})
+}
+
+// token issues the access token of service account for its signed assertion, or the federated one for the subject token of workload.
+func (s *testGCS) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	token := "service-account"
+	switch r.PostForm.Get("grant_type") {
+	case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+		s.requests = append(s.requests, "token jwt-bearer")
+	case "urn:ietf:params:oauth:grant-type:token-exchange":
+		s.requests = append(s.requests, "token token-exchange")
+		if r.PostForm.Get("subject_token") != testSubjectToken {
+			s.error(w, http.StatusBadRequest)
+			return
+		}
+		token = "federated"
+	default:
+		s.error(w, http.StatusBadRequest)
+		return
+	}
+	s.tokens[token] = true
+	s.json(w, map[string]interface{}{"access_token": token, "token_type": "Bearer", "expires_in": 3600})
+}
+
+// iam generates the access token of service account or signs the blob as it, for the caller authorized with a token issued.
+func (s *testGCS) iam(w http.ResponseWriter, r *http.Request, escaped string) {
+	resource, _ := url.PathUnescape(escaped)
+	index := strings.LastIndex(resource, ":")
+	if index == -1 {
+		s.error(w, http.StatusNotFound)
+		return
+	}
+	serviceAccount, method := resource[:index], resource[index+1:]
+	var request struct {
+		Delegates []string `json:"delegates"`
+		Payload   string   `json:"payload"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	served := fmt.Sprintf("%s %s by %s", method, serviceAccount, bearer)
+	if len(request.Delegates) != 0 {
+		served += " through " + strings.Join(request.Delegates, ",")
+	}
+	s.requests = append(s.requests, served)
+	if !s.tokens[bearer] {
+		s.error(w, http.StatusUnauthorized)
+		return
+	}
+	if s.fail != nil {
+		if status := s.fail(method, serviceAccount); status != 0 {
+			s.error(w, status)
+			return
+		}
+	}
+	switch method {
+	case "generateAccessToken":
+		s.tokens["impersonated"] = true
+		s.json(w, map[string]string{"accessToken": "impersonated", "expireTime": time.Now().Add(time.Hour).UTC().Format(time.RFC3339)})
+	case "signBlob":
+		s.json(w, map[string]string{"keyId": "1", "signedBlob": base64.StdEncoding.EncodeToString([]byte("signed by " + serviceAccount))})
+	default:
+		s.error(w, http.StatusNotFound)
+	}
+}
+
+func (s *testGCS) put(name string, content []byte, metadata map[string]string, kmsKey string) {
+	s.generation++
+	s.objects[name] = &testGCSObject{content: content, metadata: metadata, kmsKey: kmsKey, generation: s.generation, updated: time.Now()}
+}
+
+func (s *testGCS) resource(name string) *testGCSResource {
+	object := s.objects[name]
+	return &testGCSResource{
+		Bucket: "unpackker", Name: name, Size: int64(len(object.content)), Generation: object.generation,
+		Updated: object.updated.UTC().Format(time.RFC3339Nano), Metadata: object.metadata, KMSKeyName: object.kmsKey,
+	}
+}
+
+func (s *testGCS) json(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *testGCS) error(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": %q}}`, status, http.StatusText(status))
+}
+
+// testRedirect sends the requests to target whichever host they were meant for.
+type testRedirect struct {
+	target *url.URL
+}
+
+func (r *testRedirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	redirected := req.Clone(req.Context())
+	redirected.URL.Scheme, redirected.URL.Host, redirected.Host = r.target.Scheme, r.target.Host, r.target.Host
+	return http.DefaultTransport.RoundTrip(redirected)
+}
+
+// TestGCSConformance runs against the bucket set in UNPACKKER_TEST_GCS, for instance of fake-gcs-server:
+// gs://unpackker/ci?endpoint=http://localhost:4443/storage/v1/ with STORAGE_EMULATOR_HOST set to localhost:4443.
+func TestGCSConformance(t *testing.T) {
+	backendtest.Run(t, emulatorStore(t, "UNPACKKER_TEST_GCS"))
+}
+
+func TestGCSConformanceWithStandIn(t *testing.T) {
+	gcs := newTestGCS(t)
+	defer gcs.close()
+	store, err := backend.Parse(gcs.uri("assets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendtest.Run(t, store)
+}
+
+func TestGCSCompositeUploadResumes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	gcs := newTestGCS(t)
+	defer gcs.close()
+	failed := false
+	gcs.fail = func(operation, name string) int {
+		if operation == "upload" && strings.HasSuffix(name, "/part-00001") && !failed {
+			failed = true
+			return http.StatusBadRequest
+		}
+		return 0
+	}
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 5<<19)
+	store := newTestStore(t, gcs.uri("assets"), "demo_0_1_0", assetPath)
+	store.PartSizeMB, store.Concurrency = 1, 1
+	progress := make([]backend.Progress, 0)
+	store.OnProgress = func(event backend.Progress) {
+		progress = append(progress, event)
+	}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err == nil {
+		t.Fatal("upload of asset succeeded even though its part failed")
+	}
+	if states, _ := filepath.Glob(assetPath + ".*.upload.state"); len(states) != 1 {
+		t.Fatalf("state of the failed upload was not retained: %v", states)
+	}
+
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded := gcs.served("upload .unpackker/uploads/assets/demo_0_1_0/part-"); len(uploaded) != 4 {
+		t.Errorf("expected the part uploaded by failed upload to not be uploaded again, got %v", uploaded)
+	}
+	if composed := gcs.served("compose "); !reflect.DeepEqual(composed, []string{"compose assets/demo_0_1_0"}) {
+		t.Errorf("expected parts to be composed into the asset at once, got %v", composed)
+	}
+	if temporary := gcs.temporary(); len(temporary) != 0 {
+		t.Errorf("temporary objects of the completed upload were left behind: %v", temporary)
+	}
+	if states, _ := filepath.Glob(assetPath + ".*.upload.state"); len(states) != 0 {
+		t.Errorf("state of the completed upload was left behind: %v", states)
+	}
+	if last := progress[len(progress)-1]; last.Transferred != last.Total {
+		t.Errorf("last progress reported %d of %d bytes", last.Transferred, last.Total)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+}
+
+func TestGCSEncryptsWithKMSKey(t *testing.T) {
+	for _, size := range []int{1 << 10, 5 << 19} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			gcs := newTestGCS(t)
+			defer gcs.close()
+
+			assetPath, content := newTestAsset(t, dir, "demo_0_1_0", size)
+			store := newTestStore(t, gcs.uri("assets"), "demo_0_1_0", assetPath)
+			store.PartSizeMB = 1
+			store.Encryption = &backend.Encryption{KMSKey: testKMSKey}
+			if err := store.InitBackend(); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.StoreAsset(); err != nil {
+				t.Fatal(err)
+			}
+			object := gcs.objects["assets/demo_0_1_0"]
+			if object.kmsKey != testKMSKey {
+				t.Errorf("asset was not encrypted with kms key, got %q", object.kmsKey)
+			}
+			if len(object.metadata[backend.MetaDataChecksum]) == 0 {
+				t.Errorf("metadata of asset was not stored along with it")
+			}
+			if composed := gcs.served("compose assets/"); len(composed) != 0 {
+				t.Errorf("parts were composed into the asset, which does not take the kms key")
+			}
+			if temporary := gcs.temporary(); len(temporary) != 0 {
+				t.Errorf("temporary objects were left behind: %v", temporary)
+			}
+			fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+		})
+	}
+}
+
+func TestGCSRejectsVersionStoredMeanwhile(t *testing.T) {
+	for _, size := range []int{1 << 10, 5 << 19} {
+		for _, kmsKey := range []string{"", testKMSKey} {
+			t.Run(fmt.Sprintf("%d %s", size, kmsKey), func(t *testing.T) {
+				dir := tempDir(t)
+				defer os.RemoveAll(dir)
+				gcs := newTestGCS(t)
+				defer gcs.close()
+				gcs.fail = func(operation, name string) int {
+					// Another run stores the same version after this one checked for it.
+					if name == "assets/demo_0_1_0" && operation != "attrs" && operation != "read" {
+						gcs.put(name, []byte("stored meanwhile"), nil, "")
+					}
+					return 0
+				}
+
+				assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", size)
+				store := newTestStore(t, gcs.uri("assets"), "demo_0_1_0", assetPath)
+				store.PartSizeMB = 1
+				if len(kmsKey) != 0 {
+					store.Encryption = &backend.Encryption{KMSKey: kmsKey}
+				}
+				if err := store.InitBackend(); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.StoreAsset(); !errors.Is(err, backend.ErrAlreadyExists) {
+					t.Fatalf("expected upload of version stored meanwhile to be rejected, got %v", err)
+				}
+				if content := gcs.objects["assets/demo_0_1_0"].content; string(content) != "stored meanwhile" {
+					t.Errorf("version stored meanwhile was overwritten")
+				}
+				if temporary := gcs.temporary(); len(temporary) != 0 {
+					t.Errorf("temporary objects of the rejected upload were left behind: %v", temporary)
+				}
+				if states, _ := filepath.Glob(assetPath + ".*.upload.state"); len(states) != 0 {
+					t.Errorf("state of the rejected upload was left behind: %v", states)
+				}
+			})
+		}
+	}
+}
+
+// writeTestWorkloadIdentity writes the configuration of workload identity federation exchanging the subject token in json
+// at tokenPath, which impersonates the deployer unless impersonate is false.
+func writeTestWorkloadIdentity(t *testing.T, gcs *testGCS, dir string, impersonate bool) string {
+	t.Helper()
+	config := map[string]interface{}{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/ci/providers/unpackker",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          gcs.server.URL + "/token",
+		"credential_source": map[string]interface{}{
+			"file":   filepath.Join(dir, "token.json"),
+			"format": map[string]string{"type": "json", "subject_token_field_name": "id_token"},
+		},
+	}
+	if impersonate {
+		config["service_account_impersonation_url"] = gcs.server.URL + "/v1/projects/-/serviceAccounts/" + testDeployer + ":generateAccessToken"
+	}
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "workload-identity.json")
+	if err := ioutil.WriteFile(configPath, encoded, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "token.json"), []byte(`{"id_token": "`+testSubjectToken+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestGCSCredentials(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	gcs := newTestGCS(t)
+	defer gcs.close()
+	impersonated := writeTestWorkloadIdentity(t, gcs, dir, true)
+	federatedDir := filepath.Join(dir, "federated")
+	if err := os.Mkdir(federatedDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	federated := writeTestWorkloadIdentity(t, gcs, federatedDir, false)
+	wrongToken := filepath.Join(dir, "wrong.json")
+	if err := ioutil.WriteFile(wrongToken, []byte(`{"id_token": "stolen"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		credsType   string
+		credsPath   string
+		credentials *backend.Credentials
+		// bearer is the token storage is expected to be authorized with, the credentials are expected to be rejected when empty.
+		bearer string
+		issued []string
+	}{
+		{"file", "file", gcs.keyPath, nil, "service-account", []string{"token jwt-bearer"}},
+		{"default", "default", "", nil, "service-account", []string{"token jwt-bearer"}},
+		{"impersonate", "impersonate", gcs.keyPath, &backend.Credentials{ServiceAccount: testDeployer, Delegates: []string{testDelegate}}, "impersonated",
+			[]string{"token jwt-bearer", "generateAccessToken " + testDeployer + " by service-account through projects/-/serviceAccounts/" + testDelegate}},
+		{"impersonate without service account", "impersonate", gcs.keyPath, nil, "", nil},
+		{"workloadidentity", "workloadidentity", impersonated, nil, "impersonated",
+			[]string{"token token-exchange", "generateAccessToken " + testDeployer + " by federated"}},
+		{"workloadidentity without impersonation", "workloadidentity", federated, &backend.Credentials{TokenPath: filepath.Join(dir, "token.json")}, "federated",
+			[]string{"token token-exchange"}},
+		{"workloadidentity with token rejected", "workloadidentity", federated, &backend.Credentials{TokenPath: wrongToken}, "", []string{"token token-exchange"}},
+		{"workloadidentity without configuration", "workloadidentity", "", nil, "", nil},
+		{"workloadidentity with service account key", "workloadidentity", gcs.keyPath, nil, "", nil},
+	}
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", gcs.keyPath)
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gcs.mu.Lock()
+			gcs.requests, gcs.tokens, gcs.bearer = nil, make(map[string]bool), ""
+			gcs.mu.Unlock()
+
+			store := newTestStore(t, gcs.uri("assets"), "demo_0_1_0", "")
+			store.CredentialType, store.CredentialPath, store.Credentials = test.credsType, test.credsPath, test.credentials
+			err := store.InitBackendWithContext(gcs.iamContext())
+			if len(test.bearer) == 0 {
+				var credErr *backend.CredentialError
+				if !errors.As(err, &credErr) {
+					t.Fatalf("expected credentials to be rejected, got %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if exists, err := store.Backend().Exists(context.Background(), "assets/demo_0_1_0"); err != nil || exists {
+					t.Fatalf("expected asset not to exist, got %v: %v", exists, err)
+				}
+				if gcs.bearer != test.bearer {
+					t.Errorf("expected storage to be authorized with %s token, got %q", test.bearer, gcs.bearer)
+				}
+			}
+			issued := make([]string, 0)
+			for _, request := range gcs.served("") {
+				if !strings.HasPrefix(request, "attrs ") {
+					issued = append(issued, request)
+				}
+			}
+			if len(test.issued) != 0 && !reflect.DeepEqual(issued, test.issued) {
+				t.Errorf("expected tokens to be issued by %v, got %v", test.issued, issued)
+			}
+		})
+	}
+}
+
+func TestGCSSignedURL(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	gcs := newTestGCS(t)
+	defer gcs.close()
+	impersonated := writeTestWorkloadIdentity(t, gcs, dir, true)
+	federatedDir := filepath.Join(dir, "federated")
+	if err := os.Mkdir(federatedDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	federated := writeTestWorkloadIdentity(t, gcs, federatedDir, false)
+
+	tests := []struct {
+		name        string
+		credsType   string
+		credsPath   string
+		credentials *backend.Credentials
+		// signer is the service account the URL is expected to be signed as, through IAM unless it is the one of key.
+		signer string
+		signed string
+	}{
+		{"file", "file", gcs.keyPath, nil, testServiceAccount, ""},
+		{"impersonate", "impersonate", gcs.keyPath, &backend.Credentials{ServiceAccount: testDeployer, Delegates: []string{testDelegate}}, testDeployer,
+			"signBlob " + testDeployer + " by service-account through projects/-/serviceAccounts/" + testDelegate},
+		{"workloadidentity", "workloadidentity", impersonated, nil, testDeployer, "signBlob " + testDeployer + " by federated"},
+		{"workloadidentity without impersonation", "workloadidentity", federated, nil, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestStore(t, gcs.uri("assets"), "demo_0_1_0", "")
+			store.CredentialType, store.CredentialPath, store.Credentials = test.credsType, test.credsPath, test.credentials
+			ctx := gcs.iamContext()
+			if err := store.InitBackendWithContext(ctx); err != nil {
+				t.Fatal(err)
+			}
+			gcs.mu.Lock()
+			gcs.requests = nil
+			gcs.mu.Unlock()
+
+			signed, err := store.Backend().(backend.URLSigner).SignedURL(ctx, "assets/demo_0_1_0", time.Hour)
+			if len(test.signer) == 0 {
+				if err == nil || !strings.Contains(err.Error(), "signed only by the service account impersonated") {
+					t.Fatalf("expected URL not to be signed without service account impersonated, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := url.Parse(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := parsed.Query()
+			if parsed.Host != "storage.googleapis.com" || parsed.Path != "/unpackker/assets/demo_0_1_0" {
+				t.Errorf("URL was not signed for the asset, got %s", signed)
+			}
+			if !strings.HasPrefix(query.Get("X-Goog-Credential"), test.signer+"/") {
+				t.Errorf("expected URL to be signed as %s, got %s", test.signer, query.Get("X-Goog-Credential"))
+			}
+			served := gcs.served("signBlob ")
+			if len(test.signed) == 0 {
+				if len(served) != 0 || len(query.Get("X-Goog-Signature")) != 512 {
+					t.Errorf("expected URL to be signed with the key, got signature %s through %v", query.Get("X-Goog-Signature"), served)
+				}
+				return
+			}
+			if !reflect.DeepEqual(served, []string{test.signed}) {
+				t.Errorf("expected URL to be signed through IAM with %s, got %v", test.signed, served)
+			}
+			if signature := query.Get("X-Goog-Signature"); signature != hex.EncodeToString([]byte("signed by "+test.signer)) {
+				t.Errorf("URL does not carry the signature of IAM, got %s", signature)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// httpMetaHeaderPrefix is the prefix of headers with which the metadata of asset is sent to artifact server.
+// Servers such as Nexus and Artifactory do not return them, hence metadata is stored as sidecar object as well.
+const httpMetaHeaderPrefix = "X-Unpackker-Meta-"
+
+// httpBackend stores the asset in generic artifact servers (Nexus, Artifactory raw repositories etc.) with PUT and fetches with GET.
+// Store.Bucket is the base URL of repository under which the assets are placed.
+type httpBackend struct {
+	baseURL  *url.URL
+	headers  map[string]string
+	username string
+	password string
+	token    string
+	client   *http.Client
+}
+
+// httpAccount holds the credentials of the artifact server read from credential file of type basic.
+type httpAccount struct {
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+}
+
+func newHTTPBackend() Backend {
+	return &httpBackend{client: http.DefaultClient}
+}
+
+// Init validates the base URL and loads the credentials of artifact server.
+func (c *httpBackend) Init(ctx context.Context, store *Store) error {
+	baseURL, err := url.Parse(strings.TrimSuffix(store.Bucket, "/"))
+	if err != nil {
+		return fmt.Errorf("invalid base URL %s for http backend: %v", store.Bucket, err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return fmt.Errorf("base URL of http backend should begin with http:// or https://, found %s", store.Bucket)
+	}
+	c.baseURL = baseURL
+	c.headers = store.Headers
+	return c.getClient(store.CredentialPath, store.CredentialType)
+}
+
+func (c *httpBackend) getClient(credsPath, credstype string) error {
+	switch credstype {
+	case "basic":
+		content, err := ioutil.ReadFile(credsPath)
+		if err != nil {
+			return err
+		}
+		account := new(httpAccount)
+		if err := yaml.Unmarshal(content, account); err != nil {
+			return fmt.Errorf("unable to decode http credential file %s: %v", credsPath, err)
+		}
+		c.username = account.Username
+		c.password = account.Password
+		return nil
+	case "bearer":
+		content, err := ioutil.ReadFile(credsPath)
+		if err != nil {
+			return err
+		}
+		c.token = strings.TrimSpace(string(content))
+		return nil
+	case "default":
+		c.token = os.Getenv("UNPACKKER_HTTP_TOKEN")
+		c.username = os.Getenv("UNPACKKER_HTTP_USERNAME")
+		c.password = os.Getenv("UNPACKKER_HTTP_PASSWORD")
+		return nil
+	}
+	return fmt.Errorf("unsupported http client initialization")
+}
+
+// Exists checks for the asset in artifact server with HEAD.
+func (c *httpBackend) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, resp.Body.Close()
+}
+
+// Put uploads the asset to artifact server with PUT, metadata is sent as headers and is stored as sidecar object.
+// Sidecar of the asset created is stored before the asset and is rolled back if storing the asset fails, so that the asset
+// is never present without its checksum. It is retained when the asset PUT fails transiently, as the asset could still have
+// been stored, and the one found on retrying the same asset with the same metadata is taken over instead of being reported as conflict.
+// Creating the asset only is requested with If-None-Match, servers which ignore it would overwrite the asset.
+// Asset replacing the one present is stored first and its sidecar is replaced after, as is done by fs backend.
+func (c *httpBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	asset, size, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/octet-stream")
+	for name, value := range meta {
+		header.Set(httpMetaHeaderPrefix+name, value)
+	}
+
+	if !CreateOnly(ctx) {
+		content, err := metaDataContent(meta)
+		if err != nil {
+			return err
+		}
+		resp, err := c.do(ctx, http.MethodPut, key, header, progressOf(ctx).reader(asset), size)
+		if err != nil {
+			return err
+		}
+		if err := resp.Body.Close(); err != nil {
+			return err
+		}
+		return c.putFile(ctx, key+fsMetaDataSuffix, content, false)
+	}
+
+	rollback, retained, err := c.createMetaData(ctx, key, meta)
+	if err != nil {
+		return err
+	}
+	header.Set("If-None-Match", "*")
+	resp, err := c.do(ctx, http.MethodPut, key, header, progressOf(ctx).reader(asset), size)
+	if err != nil {
+		// Asset present on retry could be the one stored by the earlier attempt, whose sidecar was retained.
+		if !errors.Is(classify(c, err), ErrTransient) && !(retained && errors.Is(err, ErrAlreadyExists)) {
+			rollback()
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Get downloads the asset from artifact server with GET.
+func (c *httpBackend) Get(ctx context.Context, key, path string) error {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	return writeAsset(path, resp.Body)
+}
+
+// GetRange reads the part of the asset with Range header, errRangeUnsupported is returned if server ignores it.
+func (c *httpBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := make(http.Header)
+	header.Set("Range", byteRange(offset, length))
+
+	resp, err := c.do(ctx, http.MethodGet, key, header, nil, 0)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, errRangeUnsupported
+	}
+	return resp.Body, nil
+}
+
+// List is not supported, as generic artifact servers do not share a common API for listing.
+func (c *httpBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	return nil, fmt.Errorf("listing assets is not supported by the http backend")
+}
+
+// Delete removes the asset along with its metadata from artifact server with DELETE.
+func (c *httpBackend) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return err
+	}
+	if resp, err = c.do(ctx, http.MethodDelete, key+fsMetaDataSuffix, nil, nil, 0); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Stat returns the attributes of the asset from the response headers of HEAD, along with the metadata read from its sidecar object.
+// Metadata is read from the headers for the assets which do not have the sidecar.
+func (c *httpBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	resp, err := c.do(ctx, http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return nil, err
+	}
+
+	meta, err := c.readMetaData(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = make(map[string]string)
+		for name, values := range resp.Header {
+			if strings.HasPrefix(name, httpMetaHeaderPrefix) && len(values) != 0 {
+				meta[strings.ToLower(strings.TrimPrefix(name, httpMetaHeaderPrefix))] = values[0]
+			}
+		}
+	}
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	modified, _ := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
+	return &Object{
+		Key:      key,
+		Size:     size,
+		Modified: modified,
+		MetaData: meta,
+		ETag:     resp.Header.Get("ETag"),
+	}, nil
+}
+
+// createMetaData stores the metadata of the asset as its sidecar object only if it is not present and returns the function which rolls it back.
+// Retained reports that the sidecar present held the same metadata, as retained by the attempt which failed transiently.
+func (c *httpBackend) createMetaData(ctx context.Context, key string, meta map[string]string) (rollback func(), retained bool, err error) {
+	content, err := metaDataContent(meta)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sidecar := key + fsMetaDataSuffix
+	rollback = func() { c.deleteFile(ctx, sidecar) }
+	if err := c.putFile(ctx, sidecar, content, true); err != nil {
+		if !errors.Is(err, ErrAlreadyExists) {
+			return nil, false, err
+		}
+		if present, err := c.getFile(ctx, sidecar); err == nil && bytes.Equal(present, content) {
+			return rollback, true, nil
+		}
+		exists, _ := c.Exists(ctx, key)
+		return nil, false, sidecarExistsError(key, sidecar, exists)
+	}
+	return rollback, false, nil
+}
+
+// readMetaData reads the metadata of the asset from its sidecar object, nil is returned if the asset has no sidecar.
+func (c *httpBackend) readMetaData(ctx context.Context, key string) (map[string]string, error) {
+	content, err := c.getFile(ctx, key+fsMetaDataSuffix)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	meta := make(map[string]string)
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, fmt.Errorf("unable to decode metadata of asset %s: %v", key, err)
+	}
+	return meta, nil
+}
+
+func (c *httpBackend) getFile(ctx context.Context, key string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *httpBackend) putFile(ctx context.Context, key string, content []byte, createOnly bool) error {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	if createOnly {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := c.do(ctx, http.MethodPut, key, header, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// deleteFile deletes the object while rolling back, it is attempted even if ctx was cancelled.
+func (c *httpBackend) deleteFile(ctx context.Context, key string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if resp, err := c.do(ctx, http.MethodDelete, key, nil, nil, 0); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// do sends the request to the URL of asset, ErrNotFound is returned when server responds with 404.
+func (c *httpBackend) do(ctx context.Context, method, key string, header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	assetURL := *c.baseURL
+	assetURL.Path = path.Join(c.baseURL.Path, key)
+
+	req, err := http.NewRequest(method, assetURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = length
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if len(c.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if len(c.username) != 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode, message: fmt.Sprintf("%s %s responded with status %s", method, assetURL.String(), resp.Status)}
+	}
+	return resp, nil
+}
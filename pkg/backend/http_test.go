@@ -0,0 +1,250 @@
+package backend_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+// testArtifactServer is the in-memory raw repository of artifact servers such as Nexus, which stores the content PUT
+// without the headers sent along with it. Requests are authorized with basic auth when username is set.
+type testArtifactServer struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	modified map[string]time.Time
+	server   *httptest.Server
+	username string
+	password string
+	// ignoreRange makes the server respond with the whole content to the range requests.
+	ignoreRange bool
+	// requests are the requests served, named by method and path along with the range requested if any.
+	requests []string
+	// fail is consulted for every request, status returned for it is served instead when it is set.
+	fail func(r *http.Request) int
+}
+
+func newTestArtifactServer() *testArtifactServer {
+	server := &testArtifactServer{files: make(map[string][]byte), modified: make(map[string]time.Time)}
+	server.server = httptest.NewServer(server)
+	return server
+}
+
+func (s *testArtifactServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+r.Header.Get("Range")))
+	if username, password, _ := r.BasicAuth(); username != s.username || password != s.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.fail != nil {
+		if status := s.fail(r); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+	}
+
+	content, exists := s.files[r.URL.Path]
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		s.files[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		s.modified[r.URL.Path] = time.Now()
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		if s.ignoreRange {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, r.URL.Path, s.modified[r.URL.Path], bytes.NewReader(content))
+	case http.MethodDelete:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.files, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// served returns the requests served whose name begins with prefix.
+func (s *testArtifactServer) served(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	served := make([]string, 0)
+	for _, request := range s.requests {
+		if strings.HasPrefix(request, prefix) {
+			served = append(served, request)
+		}
+	}
+	return served
+}
+
+func TestHTTPStoresMetaDataAsSidecar(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.username, server.password = "unpackker", "secret"
+	os.Setenv("UNPACKKER_HTTP_USERNAME", server.username)
+	os.Setenv("UNPACKKER_HTTP_PASSWORD", server.password)
+	defer os.Unsetenv("UNPACKKER_HTTP_USERNAME")
+	defer os.Unsetenv("UNPACKKER_HTTP_PASSWORD")
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/repository/raw/assets", "demo_0_1_0", assetPath)
+	store.MetaData = map[string]string{backend.MetaDataVersion: "0.1.0"}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := store.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.MetaData[backend.MetaDataVersion] != "0.1.0" || len(object.MetaData[backend.MetaDataChecksum]) == 0 {
+		t.Errorf("metadata of asset was not read back from its sidecar, got %v", object.MetaData)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+
+	if err := store.Backend().Delete(context.Background(), "demo_0_1_0"); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.files) != 0 {
+		t.Errorf("asset was not deleted along with its sidecar, left %d files", len(server.files))
+	}
+}
+
+func TestHTTPRollsBackSidecarOfFailedUpload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/demo_0_1_0") {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); !errors.Is(err, backend.ErrPermissionDenied) {
+		t.Fatalf("expected upload to be denied, got %v", err)
+	}
+	if len(server.files) != 0 {
+		t.Errorf("sidecar of asset which was not stored was left behind")
+	}
+}
+
+func TestHTTPReplacesSidecarAfterAsset(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.files["/assets/demo_0_1_0"] = []byte("previous")
+	server.files["/assets/demo_0_1_0.metadata.json"] = []byte(`{"version":"0.0.9"}`)
+	server.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPut && r.URL.Path == "/assets/demo_0_1_0" {
+			return http.StatusForbidden
+		}
+		return 0
+	}
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.SkipRemoteCheck = true
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); !errors.Is(err, backend.ErrPermissionDenied) {
+		t.Fatalf("expected overwrite to be denied, got %v", err)
+	}
+	if sidecar := server.files["/assets/demo_0_1_0.metadata.json"]; string(sidecar) != `{"version":"0.0.9"}` {
+		t.Errorf("sidecar of asset was replaced by the overwrite which failed, got %s", sidecar)
+	}
+
+	server.fail, server.requests = nil, nil
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	if puts := server.served("PUT"); len(puts) != 2 || puts[0] != "PUT /assets/demo_0_1_0" {
+		t.Errorf("expected the asset to be replaced before its sidecar, got %v", puts)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+}
+
+func TestHTTPRejectsVersionStoredMeanwhile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.fail = func(r *http.Request) int {
+		// Another run stores the same version after this one checked for it.
+		if r.Method == http.MethodPut && len(server.files) == 0 {
+			server.files["/assets/demo_0_1_0"] = []byte("stored meanwhile")
+			server.files["/assets/demo_0_1_0.metadata.json"] = []byte("{}")
+		}
+		return 0
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); !errors.Is(err, backend.ErrAlreadyExists) {
+		t.Fatalf("expected upload of version stored meanwhile to be rejected, got %v", err)
+	}
+	if content := server.files["/assets/demo_0_1_0"]; string(content) != "stored meanwhile" {
+		t.Errorf("version stored meanwhile was overwritten")
+	}
+}
+
+func TestHTTPFetchesWholeAssetWhenRangeIsIgnored(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.ignoreRange = true
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 3<<20)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.PartSizeMB = 1
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+	if whole := server.served("GET /assets/demo_0_1_0"); len(whole) == 0 || whole[len(whole)-1] != "GET /assets/demo_0_1_0" {
+		t.Errorf("asset was not fetched as a whole once range was ignored, requests were %v", whole)
+	}
+}
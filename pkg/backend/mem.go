@@ -0,0 +1,189 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+var (
+	memMu      sync.Mutex
+	memBuckets = make(map[string]*memBucket)
+)
+
+// memBackend stores the asset in the memory of the process, it lets the code using pkg/packer or pkg/unpacker be tested without a real bucket.
+// Store.Bucket names the bucket, assets stored in it are visible to every Store of the process with the same bucket until it is cleared with backendtest.ClearMem.
+type memBackend struct {
+	bucket *memBucket
+}
+
+type memBucket struct {
+	mu         sync.RWMutex
+	objects    map[string]*memObject
+	generation int64
+}
+
+type memObject struct {
+	content    []byte
+	meta       map[string]string
+	modified   time.Time
+	generation int64
+}
+
+func newMemBackend() Backend {
+	return &memBackend{}
+}
+
+// Init attaches the backend to its bucket, creating the bucket if it is not present.
+func (c *memBackend) Init(ctx context.Context, store *Store) error {
+	memMu.Lock()
+	defer memMu.Unlock()
+
+	bucket, ok := memBuckets[store.Bucket]
+	if !ok {
+		bucket = &memBucket{objects: make(map[string]*memObject)}
+		memBuckets[store.Bucket] = bucket
+	}
+	c.bucket = bucket
+	return nil
+}
+
+// Exists checks for the asset in the bucket.
+func (c *memBackend) Exists(ctx context.Context, key string) (bool, error) {
+	c.bucket.mu.RLock()
+	defer c.bucket.mu.RUnlock()
+
+	_, ok := c.bucket.objects[key]
+	return ok, nil
+}
+
+// Put reads the asset into the bucket along with a copy of its metadata, asset is visible under its key only once it is read completely.
+func (c *memBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	asset, _, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	content, err := ioutil.ReadAll(progressOf(ctx).reader(helper.ContextReader(ctx, asset)))
+	if err != nil {
+		return err
+	}
+
+	c.bucket.mu.Lock()
+	defer c.bucket.mu.Unlock()
+	if _, ok := c.bucket.objects[key]; ok && CreateOnly(ctx) {
+		return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+	}
+	c.bucket.generation++
+	c.bucket.objects[key] = &memObject{
+		content:    content,
+		meta:       copyMetaData(meta),
+		modified:   time.Now(),
+		generation: c.bucket.generation,
+	}
+	return nil
+}
+
+// Get writes the asset from the bucket onto the specified location.
+func (c *memBackend) Get(ctx context.Context, key, path string) error {
+	object, err := c.object(key)
+	if err != nil {
+		return err
+	}
+	return writeAsset(path, helper.ContextReader(ctx, bytes.NewReader(object.content)))
+}
+
+// GetRange reads the part of the asset in the bucket.
+func (c *memBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	object, err := c.object(key)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(object.content))
+	if offset < 0 || offset > size {
+		return nil, fmt.Errorf("range starting at %d is beyond the size %d of %s", offset, size, key)
+	}
+	end := offset + length
+	if end > size {
+		end = size
+	}
+	return ioutil.NopCloser(helper.ContextReader(ctx, bytes.NewReader(object.content[offset:end]))), nil
+}
+
+// List returns all the assets of the bucket whose key begins with prefix, sorted by their keys.
+func (c *memBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	c.bucket.mu.RLock()
+	defer c.bucket.mu.RUnlock()
+
+	objects := make([]*Object, 0)
+	for key, object := range c.bucket.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, object.attributes(key))
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// Delete removes the asset from the bucket.
+func (c *memBackend) Delete(ctx context.Context, key string) error {
+	c.bucket.mu.Lock()
+	defer c.bucket.mu.Unlock()
+
+	if _, ok := c.bucket.objects[key]; !ok {
+		return ErrNotFound
+	}
+	delete(c.bucket.objects, key)
+	return nil
+}
+
+// Stat returns the attributes of the asset, its ETag is the generation of bucket at which it was stored.
+func (c *memBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	object, err := c.object(key)
+	if err != nil {
+		return nil, err
+	}
+	return object.attributes(key), nil
+}
+
+func (c *memBackend) object(key string) (*memObject, error) {
+	c.bucket.mu.RLock()
+	defer c.bucket.mu.RUnlock()
+
+	object, ok := c.bucket.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return object, nil
+}
+
+func (o *memObject) attributes(key string) *Object {
+	return &Object{
+		Key:      key,
+		Size:     int64(len(o.content)),
+		Modified: o.modified,
+		MetaData: copyMetaData(o.meta),
+		ETag:     strconv.FormatInt(o.generation, 10),
+	}
+}
+
+// copyMetaData returns the copy of metadata, so that the one held by mem backend is not changed by its callers.
+func copyMetaData(meta map[string]string) map[string]string {
+	copied := make(map[string]string, len(meta))
+	for key, value := range meta {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,17 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestMemConformance(t *testing.T) {
+	defer backendtest.ClearMem(t, "conformance")
+	store, err := backend.Parse("mem://conformance/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendtest.Run(t, store)
+}
@@ -0,0 +1,784 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// OCIArtifactType is the media type with which the packed asset is pushed as OCI artifact.
+	OCIArtifactType = "application/vnd.unpackker.asset.v1"
+	// OCIConfigType is the media type of config blob of the packed asset.
+	OCIConfigType      = "application/vnd.unpackker.config.v1+json"
+	ociManifestType    = "application/vnd.oci.image.manifest.v1+json"
+	ociAnnotationTitle = "org.opencontainers.image.title"
+	ociAnnotationTime  = "org.opencontainers.image.created"
+	ociAnnotationTag   = "vnd.unpackker.tag"
+	dockerHubRegistry  = "registry-1.docker.io"
+	dockerHubAuthKey   = "https://index.docker.io/v1/"
+)
+
+var ociInvalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// ociBackend pushes the packed asset to container registries as OCI artifact.
+// Store.Bucket is the address of the registry, Folder of the asset forms the repository
+// and the asset name, which carries its version, is used as tag. Tags of the asset are held as tags of the repository Folder,
+// as repository names could not hold Folder/.tags.
+type ociBackend struct {
+	registry   *url.URL
+	username   string
+	password   string
+	token      string
+	bearer     map[string]string
+	client     *http.Client
+	configPath string
+}
+
+// ociDescriptor describes the content addressed by the manifest.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is the image manifest as per OCI image specification, with artifactType set to OCIArtifactType.
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// dockerConfig is the subset of docker config.json from which credentials of registry are read.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+func newOCIBackend() Backend {
+	return &ociBackend{client: http.DefaultClient, bearer: make(map[string]string)}
+}
+
+// Init parses the address of registry and loads its credentials from docker config.
+func (c *ociBackend) Init(ctx context.Context, store *Store) error {
+	address := strings.TrimSuffix(strings.TrimPrefix(store.Bucket, "oci://"), "/")
+	if len(address) == 0 {
+		return fmt.Errorf("address of the registry has to be set with 'bucket' for oci backend")
+	}
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		scheme := "https://"
+		if strings.HasPrefix(address, "localhost") || strings.HasPrefix(address, "127.0.0.1") {
+			scheme = "http://"
+		}
+		address = scheme + address
+	}
+	registry, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid registry address %s: %v", store.Bucket, err)
+	}
+	if registry.Host == "docker.io" {
+		registry.Host = dockerHubRegistry
+	}
+	c.registry = registry
+	return c.getClient(store.CredentialPath, store.CredentialType)
+}
+
+func (c *ociBackend) getClient(credsPath, credstype string) error {
+	switch credstype {
+	case "file":
+		c.configPath = credsPath
+	case "default":
+		configDir := os.Getenv("DOCKER_CONFIG")
+		if len(configDir) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+			configDir = filepath.Join(home, ".docker")
+		}
+		c.configPath = filepath.Join(configDir, "config.json")
+		if _, err := os.Stat(c.configPath); os.IsNotExist(err) {
+			// Registry would be accessed anonymously, as there is no docker config.
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported oci client initialization")
+	}
+	return c.loadCredentials()
+}
+
+// loadCredentials reads the credentials of registry from docker config, either from auths or from credential helpers.
+func (c *ociBackend) loadCredentials() error {
+	content, err := ioutil.ReadFile(c.configPath)
+	if err != nil {
+		return err
+	}
+	config := new(dockerConfig)
+	if err := json.Unmarshal(content, config); err != nil {
+		return fmt.Errorf("unable to decode docker config %s: %v", c.configPath, err)
+	}
+
+	host := c.registry.Host
+	authKey := host
+	if host == dockerHubRegistry {
+		authKey = dockerHubAuthKey
+	}
+
+	helper := config.CredsStore
+	if credHelper, ok := config.CredHelpers[host]; ok {
+		helper = credHelper
+	}
+	for key, auth := range config.Auths {
+		if key != authKey && strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://") != host {
+			continue
+		}
+		if len(auth.IdentityToken) != 0 {
+			c.token = auth.IdentityToken
+		}
+		if len(auth.Auth) != 0 {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return fmt.Errorf("invalid auth of registry %s in docker config: %v", key, err)
+			}
+			credentials := strings.SplitN(string(decoded), ":", 2)
+			if len(credentials) == 2 {
+				c.username, c.password = credentials[0], credentials[1]
+			}
+			return nil
+		}
+	}
+
+	if len(helper) != 0 {
+		return c.loadHelperCredentials(helper, authKey)
+	}
+	return nil
+}
+
+// loadHelperCredentials fetches the credentials of registry from the docker credential helper.
+func (c *ociBackend) loadHelperCredentials(helper, serverURL string) error {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	output, err := cmd.Output()
+	if err != nil {
+		// Credential helpers fail when there are no credentials for the registry, registry would be accessed anonymously.
+		return nil
+	}
+
+	credentials := struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}{}
+	if err := json.Unmarshal(output, &credentials); err != nil {
+		return fmt.Errorf("unable to decode credentials from docker-credential-%s: %v", helper, err)
+	}
+	if credentials.Username == "<token>" {
+		c.token = credentials.Secret
+		return nil
+	}
+	c.username, c.password = credentials.Username, credentials.Secret
+	return nil
+}
+
+// Exists checks for the manifest of the asset in the registry.
+func (c *ociBackend) Exists(ctx context.Context, key string) (bool, error) {
+	repository, reference := c.reference(key)
+	resp, err := c.do(ctx, http.MethodHead, c.manifestURL(repository, reference), repository, ociHeader("Accept", ociManifestType), nil, 0)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// Put pushes the asset as the layer of OCI artifact, metadata is set as annotations of the manifest.
+// Registries do not support conditional push of manifest, hence concurrent pushes of the same tag are not detected.
+func (c *ociBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	repository, reference := c.reference(key)
+
+	asset, size, err := openAsset(path)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, asset); err != nil {
+		return err
+	}
+	layer := ociDescriptor{
+		MediaType:   OCIArtifactType,
+		Digest:      "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		Size:        size,
+		Annotations: map[string]string{ociAnnotationTitle: filepath.Base(key)},
+	}
+	if err := c.pushBlob(ctx, repository, layer, progressOf(ctx).readSeeker(asset)); err != nil {
+		return err
+	}
+
+	configContent := []byte("{}")
+	config := ociDescriptor{MediaType: OCIConfigType, Digest: ociDigest(configContent), Size: int64(len(configContent))}
+	if err := c.pushBlob(ctx, repository, config, bytes.NewReader(configContent)); err != nil {
+		return err
+	}
+
+	annotations := map[string]string{ociAnnotationTime: time.Now().UTC().Format(time.RFC3339)}
+	for name, value := range meta {
+		annotations[name] = value
+	}
+	manifest, err := json.Marshal(&ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestType,
+		ArtifactType:  OCIArtifactType,
+		Config:        config,
+		Layers:        []ociDescriptor{layer},
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, c.manifestURL(repository, reference), repository,
+		ociHeader("Content-Type", ociManifestType), bytes.NewReader(manifest), int64(len(manifest)))
+	if err != nil {
+		return fmt.Errorf("unable to push manifest %s:%s: %w", repository, reference, err)
+	}
+	return resp.Body.Close()
+}
+
+// Get pulls the asset by tag or digest from the registry and verifies its digest.
+func (c *ociBackend) Get(ctx context.Context, key, path string) error {
+	repository, _ := c.reference(key)
+	manifest, err := c.getManifest(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return err
+	}
+	layer, err := c.assetLayer(manifest)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, c.blobURL(repository, layer.Digest), repository, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	hash := sha256.New()
+	if err := writeAsset(path, io.TeeReader(resp.Body, hash)); err != nil {
+		return err
+	}
+	if digest := "sha256:" + hex.EncodeToString(hash.Sum(nil)); digest != layer.Digest {
+		os.Remove(path)
+		return fmt.Errorf("digest of the pulled asset %s does not match the manifest %s", digest, layer.Digest)
+	}
+	return nil
+}
+
+// List lists the assets of the repository formed by prefix. Every asset is listed once under the tag named after it,
+// the other tags pointing at its manifest are left out.
+func (c *ociBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	repository := strings.ToLower(strings.Trim(prefix, "/"))
+	tags, err := c.tags(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*Object, 0, len(tags))
+	for _, tag := range tags {
+		manifest, err := c.getManifest(ctx, repository+"/"+tag)
+		if err != nil {
+			return nil, err
+		}
+		layer, err := c.assetLayer(manifest)
+		if err != nil {
+			return nil, err
+		}
+		if title := layer.Annotations[ociAnnotationTitle]; ociInvalidTagChars.ReplaceAllString(title, "_") != tag {
+			continue
+		}
+		objects = append(objects, c.object(repository+"/"+tag, manifest, layer))
+	}
+	return objects, nil
+}
+
+// Delete removes the asset from the registry. Manifest is deleted only when no other tag points at it, as deleting it
+// deletes all of its tags, else just the tag of the asset is deleted.
+func (c *ociBackend) Delete(ctx context.Context, key string) error {
+	repository, reference := c.reference(key)
+	digest, err := c.manifestDigest(ctx, repository, reference)
+	if err != nil {
+		return err
+	}
+
+	tags, err := c.tags(ctx, repository)
+	if err != nil {
+		return err
+	}
+	shared := make([]string, 0)
+	for _, tag := range tags {
+		if tag == reference {
+			continue
+		}
+		tagDigest, err := c.manifestDigest(ctx, repository, tag)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if tagDigest == digest {
+			shared = append(shared, tag)
+		}
+	}
+	if len(shared) == 0 {
+		reference = digest
+	}
+
+	resp, err := c.do(ctx, http.MethodDelete, c.manifestURL(repository, reference), repository, nil, nil, 0)
+	if err != nil {
+		if len(shared) != 0 {
+			return fmt.Errorf("unable to delete tag of %s, manifest is retained as tags %s point at it as well: %w", key, strings.Join(shared, ", "), err)
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Stat returns the attributes of the asset from its manifest, annotations of the manifest are returned as metadata.
+func (c *ociBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	manifest, err := c.getManifest(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := c.assetLayer(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.object(key, manifest, layer), nil
+}
+
+// PutTag points the tag at the asset by pushing the manifest of the asset as the tag of repository formed by key,
+// along with the tag as its annotation. Blobs of the asset are mounted into the repository if it is not the one of the asset.
+func (c *ociBackend) PutTag(ctx context.Context, key string, tag *Tag) error {
+	repository, reference := c.reference(key)
+	if _, err := c.GetTag(ctx, key); errors.Is(err, ErrNotFound) {
+		// Manifest under the name of tag which is not a tag is an asset, it is not overwritten.
+		exists, err := c.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("asset %s is present in the repository under the name of tag %s: %w", key, tag.Name, ErrAlreadyExists)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	manifest, err := c.getManifest(ctx, tag.Key)
+	if err != nil {
+		return err
+	}
+	from, _ := c.reference(tag.Key)
+	for _, blob := range append([]ociDescriptor{manifest.Config}, manifest.Layers...) {
+		if err := c.mountBlob(ctx, repository, from, blob); err != nil {
+			return err
+		}
+	}
+
+	content, err := json.Marshal(tag)
+	if err != nil {
+		return err
+	}
+	if manifest.Annotations == nil {
+		manifest.Annotations = make(map[string]string)
+	}
+	manifest.Annotations[ociAnnotationTag] = string(content)
+	tagManifest, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, c.manifestURL(repository, reference), repository,
+		ociHeader("Content-Type", ociManifestType), bytes.NewReader(tagManifest), int64(len(tagManifest)))
+	if err != nil {
+		return fmt.Errorf("unable to push manifest %s:%s: %w", repository, reference, err)
+	}
+	return resp.Body.Close()
+}
+
+// GetTag reads the tag from the annotation of its manifest, the tags of repository which are not pushed by PutTag are not found.
+func (c *ociBackend) GetTag(ctx context.Context, key string) (*Tag, error) {
+	manifest, err := c.getManifest(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	content, ok := manifest.Annotations[ociAnnotationTag]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a tag: %w", key, ErrNotFound)
+	}
+	tag := new(Tag)
+	if err := json.Unmarshal([]byte(content), tag); err != nil {
+		return nil, fmt.Errorf("tag %s is corrupted: %v", key, err)
+	}
+	return tag, nil
+}
+
+// ListTags lists the tags pushed by PutTag to the repository formed by prefix.
+func (c *ociBackend) ListTags(ctx context.Context, prefix string) ([]*Tag, error) {
+	repository := strings.ToLower(strings.Trim(prefix, "/"))
+	references, err := c.tags(ctx, repository)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]*Tag, 0)
+	for _, reference := range references {
+		tag, err := c.GetTag(ctx, repository+"/"+reference)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// DeleteTag deletes the tag pushed by PutTag, the asset it points at is retained as it is referred by a manifest of its own.
+func (c *ociBackend) DeleteTag(ctx context.Context, key string) error {
+	if _, err := c.GetTag(ctx, key); err != nil {
+		return err
+	}
+	return c.Delete(ctx, key)
+}
+
+// object returns the attributes of the asset from its manifest, annotations of the manifest are returned as metadata.
+func (c *ociBackend) object(key string, manifest *ociManifest, layer *ociDescriptor) *Object {
+	meta := make(map[string]string)
+	for name, value := range manifest.Annotations {
+		if name != ociAnnotationTime {
+			meta[name] = value
+		}
+	}
+	modified, _ := time.Parse(time.RFC3339, manifest.Annotations[ociAnnotationTime])
+	return &Object{
+		Key:      key,
+		Size:     layer.Size,
+		Modified: modified,
+		MetaData: meta,
+		ETag:     layer.Digest,
+	}
+}
+
+// tags returns the tags of the repository sorted by name, none if the repository does not exist.
+func (c *ociBackend) tags(ctx context.Context, repository string) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.registryURL("/v2/"+repository+"/tags/list"), repository, nil, nil, 0)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tags := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("unable to decode tags of repository %s: %v", repository, err)
+	}
+	sort.Strings(tags.Tags)
+	return tags.Tags, nil
+}
+
+// manifestDigest returns the digest of the manifest referred by tag or digest.
+func (c *ociBackend) manifestDigest(ctx context.Context, repository, reference string) (string, error) {
+	resp, err := c.do(ctx, http.MethodHead, c.manifestURL(repository, reference), repository, ociHeader("Accept", ociManifestType), nil, 0)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if len(digest) == 0 {
+		return "", fmt.Errorf("registry did not return the digest of %s:%s", repository, reference)
+	}
+	return digest, nil
+}
+
+func (c *ociBackend) getManifest(ctx context.Context, key string) (*ociManifest, error) {
+	repository, reference := c.reference(key)
+	resp, err := c.do(ctx, http.MethodGet, c.manifestURL(repository, reference), repository, ociHeader("Accept", ociManifestType), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	manifest := new(ociManifest)
+	if err := json.NewDecoder(resp.Body).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("unable to decode manifest of %s: %v", key, err)
+	}
+	return manifest, nil
+}
+
+func (c *ociBackend) assetLayer(manifest *ociManifest) (*ociDescriptor, error) {
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == OCIArtifactType {
+			return &layer, nil
+		}
+	}
+	return nil, fmt.Errorf("manifest does not hold any layer of type %s, it was not pushed by unpackker", OCIArtifactType)
+}
+
+// pushBlob uploads the blob monolithically, unless it is already present in the repository.
+func (c *ociBackend) pushBlob(ctx context.Context, repository string, blob ociDescriptor, content io.ReadSeeker) error {
+	resp, err := c.do(ctx, http.MethodHead, c.blobURL(repository, blob.Digest), repository, nil, nil, 0)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, c.registryURL("/v2/"+repository+"/blobs/uploads/"), repository, nil, nil, 0)
+	if err != nil {
+		return fmt.Errorf("unable to initiate upload of blob %s: %w", blob.Digest, err)
+	}
+	resp.Body.Close()
+	return c.uploadBlob(ctx, repository, resp.Header.Get("Location"), blob, content)
+}
+
+// mountBlob makes the blob of repository from available in repository, it is mounted across the repositories
+// and is copied through a temporary file when registry does not mount it.
+func (c *ociBackend) mountBlob(ctx context.Context, repository, from string, blob ociDescriptor) error {
+	if repository == from {
+		return nil
+	}
+	mountURL := c.registryURL("/v2/" + repository + "/blobs/uploads/")
+	mountURL.RawQuery = url.Values{"mount": {blob.Digest}, "from": {from}}.Encode()
+	resp, err := c.do(ctx, http.MethodPost, mountURL, repository, nil, nil, 0)
+	if err != nil {
+		return fmt.Errorf("unable to mount blob %s from %s: %w", blob.Digest, from, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated {
+		return nil
+	}
+
+	// Registry opened an upload session as it could not mount the blob.
+	session := resp.Header.Get("Location")
+	resp, err = c.do(ctx, http.MethodGet, c.blobURL(from, blob.Digest), from, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.TempFile("", "unpackker-blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(content.Name())
+	defer content.Close()
+	if _, err := io.Copy(content, resp.Body); err != nil {
+		return err
+	}
+	return c.uploadBlob(ctx, repository, session, blob, content)
+}
+
+// uploadBlob uploads the content of blob monolithically to the upload session at location.
+func (c *ociBackend) uploadBlob(ctx context.Context, repository, session string, blob ociDescriptor, content io.ReadSeeker) error {
+	location, err := c.registry.Parse(session)
+	if err != nil {
+		return fmt.Errorf("registry returned invalid upload location: %v", err)
+	}
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPut, location, repository, ociHeader("Content-Type", "application/octet-stream"), content, blob.Size)
+	if err != nil {
+		return fmt.Errorf("unable to upload blob %s: %w", blob.Digest, err)
+	}
+	return resp.Body.Close()
+}
+
+// do sends the request to registry, it authenticates with the registry as challenged and retries the request once.
+func (c *ociBackend) do(ctx context.Context, method string, reqURL *url.URL, repository string,
+	header http.Header, body io.ReadSeeker, length int64) (*http.Response, error) {
+	resp, err := c.send(ctx, method, reqURL, repository, header, body, length)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		if err := c.authenticate(ctx, resp.Header.Get("WWW-Authenticate"), repository); err != nil {
+			return nil, err
+		}
+		if body != nil {
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		if resp, err = c.send(ctx, method, reqURL, repository, header, body, length); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &statusError{
+			code:    resp.StatusCode,
+			message: fmt.Sprintf("%s %s responded with status %s: %s", method, reqURL.Path, resp.Status, strings.TrimSpace(string(message))),
+		}
+	}
+	return resp, nil
+}
+
+func (c *ociBackend) send(ctx context.Context, method string, reqURL *url.URL, repository string,
+	header http.Header, body io.Reader, length int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, reqURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = length
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if token, ok := c.bearer[repository]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if len(c.username) != 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.client.Do(req)
+}
+
+// authenticate fetches the bearer token from the realm challenged by registry with scope of the repository.
+func (c *ociBackend) authenticate(ctx context.Context, challenge, repository string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		if len(c.username) == 0 {
+			return fmt.Errorf("registry %s requires authentication, but no credentials found in docker config", c.registry.Host)
+		}
+		return fmt.Errorf("registry %s rejected the credentials found in docker config", c.registry.Host)
+	}
+
+	params := make(map[string]string)
+	for _, match := range regexp.MustCompile(`(\w+)="([^"]*)"`).FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return fmt.Errorf("registry %s sent invalid authentication challenge %s", c.registry.Host, challenge)
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull,push", repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if len(c.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if len(c.username) != 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch token for repository %s from %s: %s", repository, realm.Host, resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("unable to decode token response of %s: %v", realm.Host, err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	c.bearer[repository] = token.Token
+	return nil
+}
+
+// reference splits the key into repository and reference, last element of key could either be a tag or a digest.
+func (c *ociBackend) reference(key string) (string, string) {
+	repository, reference := strings.ToLower(path.Dir(key)), path.Base(key)
+	if strings.HasPrefix(reference, "sha256:") {
+		return repository, reference
+	}
+	return repository, ociInvalidTagChars.ReplaceAllString(reference, "_")
+}
+
+func (c *ociBackend) registryURL(path string) *url.URL {
+	registryURL := *c.registry
+	registryURL.Path = path
+	return &registryURL
+}
+
+func (c *ociBackend) manifestURL(repository, reference string) *url.URL {
+	return c.registryURL(fmt.Sprintf("/v2/%s/manifests/%s", repository, reference))
+}
+
+func (c *ociBackend) blobURL(repository, digest string) *url.URL {
+	return c.registryURL(fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
+}
+
+func ociHeader(name, value string) http.Header {
+	header := make(http.Header)
+	header.Set(name, value)
+	return header
+}
+
+func ociDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,317 @@
+package backend_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+var (
+	// ociRepositoryName is the grammar of repository names as per OCI distribution specification.
+	ociRepositoryName = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	ociRoute          = regexp.MustCompile(`^/v2/(.+)/(blobs/uploads/[^/]*|blobs/[^/]+|manifests/[^/]+|tags/list)$`)
+)
+
+// testRegistry is the in-memory container registry serving the subset of OCI distribution API used by the oci backend.
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]map[string][]byte
+	tags      map[string]map[string]string
+	uploads   int
+	server    *httptest.Server
+	// refuseMount makes the registry open an upload session for the blob to be mounted, as registries do without access to the source.
+	refuseMount bool
+}
+
+func newTestRegistry() *testRegistry {
+	registry := &testRegistry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string]map[string][]byte),
+		tags:      make(map[string]map[string]string),
+	}
+	registry.server = httptest.NewServer(registry)
+	return registry
+}
+
+// address returns the address of registry, oci backend talks plain http to the registries on 127.0.0.1.
+func (r *testRegistry) address() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	match := ociRoute.FindStringSubmatch(req.URL.Path)
+	if match == nil {
+		http.NotFound(w, req)
+		return
+	}
+	repository, route := match[1], match[2]
+	if !ociRepositoryName.MatchString(repository) {
+		http.Error(w, `{"errors":[{"code":"NAME_INVALID"}]}`, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(route, "blobs/uploads/"):
+		r.serveUpload(w, req, repository)
+	case strings.HasPrefix(route, "blobs/"):
+		blob, ok := r.blobs[strings.TrimPrefix(route, "blobs/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		if req.Method == http.MethodGet {
+			w.Write(blob)
+		}
+	case strings.HasPrefix(route, "manifests/"):
+		r.serveManifest(w, req, repository, strings.TrimPrefix(route, "manifests/"))
+	default:
+		tags := make([]string, 0)
+		for tag := range r.tags[repository] {
+			tags = append(tags, tag)
+		}
+		if len(tags) == 0 {
+			http.NotFound(w, req)
+			return
+		}
+		sort.Strings(tags)
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags})
+	}
+}
+
+func (r *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repository string) {
+	switch req.Method {
+	case http.MethodPost:
+		if digest := req.URL.Query().Get("mount"); len(digest) != 0 && !r.refuseMount {
+			if _, ok := r.blobs[digest]; ok {
+				w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest))
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		r.uploads++
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d", repository, r.uploads))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		content, _ := ioutil.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if testDigest(content) != digest {
+			http.Error(w, `{"errors":[{"code":"DIGEST_INVALID"}]}`, http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = content
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repository, reference string) {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		digest = r.tags[repository][reference]
+	}
+	manifest, ok := r.manifests[repository][digest]
+
+	switch req.Method {
+	case http.MethodPut:
+		content, _ := ioutil.ReadAll(req.Body)
+		digest = testDigest(content)
+		if r.manifests[repository] == nil {
+			r.manifests[repository], r.tags[repository] = make(map[string][]byte), make(map[string]string)
+		}
+		r.manifests[repository][digest] = content
+		if !strings.HasPrefix(reference, "sha256:") {
+			r.tags[repository][reference] = digest
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest)
+		if req.Method == http.MethodGet {
+			w.Write(manifest)
+		}
+	case http.MethodDelete:
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		if digest != reference {
+			delete(r.tags[repository], reference)
+		} else {
+			delete(r.manifests[repository], digest)
+			for tag, tagDigest := range r.tags[repository] {
+				if tagDigest == digest {
+					delete(r.tags[repository], tag)
+				}
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// tag points the tag at the manifest already referred by reference, as tools like crane tag or oras tag do.
+func (r *testRegistry) tag(repository, reference, tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tags[repository][tag] = r.tags[repository][reference]
+}
+
+func testDigest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestOCIListsEveryVersionOnce(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	registry := newTestRegistry()
+	defer registry.server.Close()
+	address := registry.address()
+
+	for _, version := range []string{"0.1.0", "0.2.0"} {
+		name := "demo_" + strings.Replace(version, ".", "_", -1)
+		assetPath, _ := newTestAsset(t, dir, name, 1<<10)
+		store := newTestStore(t, "oci://"+address+"/assets/demo", name, assetPath)
+		store.MetaData = map[string]string{backend.MetaDataVersion: version}
+		if err := store.InitBackend(); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.StoreAsset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := newTestStore(t, "oci://"+address+"/assets", "demo", "")
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected 2 versions to be listed, got %d: %v", len(objects), objects)
+	}
+}
+
+func TestOCIPruneRetainsTheOnlyCopy(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	registry := newTestRegistry()
+	defer registry.server.Close()
+	address := registry.address()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, "oci://"+address+"/assets/demo", "demo_0_1_0", assetPath)
+	store.MetaData = map[string]string{backend.MetaDataVersion: "0.1.0"}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	lister := newTestStore(t, "oci://"+address+"/assets", "demo", "")
+	if err := lister.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := lister.Prune(&backend.Retention{KeepLast: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 0 {
+		t.Fatalf("the only version of asset was pruned: %v", pruned)
+	}
+	fetchTestAsset(t, store, dir+"/fetched", content)
+}
+
+func TestOCIDeleteRetainsManifestOfOtherTags(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	registry := newTestRegistry()
+	defer registry.server.Close()
+	address := registry.address()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, "oci://"+address+"/assets/demo", "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	registry.tag("assets/demo", "demo_0_1_0", "stable")
+
+	ctx := context.Background()
+	if err := store.Backend().Delete(ctx, "assets/demo/demo_0_1_0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Backend().Stat(ctx, "assets/demo/demo_0_1_0"); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("expected deleted tag to be not found, got %v", err)
+	}
+
+	stable := newTestStore(t, "oci://"+address+"/assets/demo", "stable", "")
+	if err := stable.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	stable.TargetPath = dir + "/fetched"
+	if err := stable.FetchAsset(); err != nil {
+		t.Fatalf("manifest of the other tag was deleted along with the asset: %v", err)
+	}
+	fetched, err := ioutil.ReadFile(dir + "/fetched/stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fetched) != string(content) {
+		t.Errorf("asset fetched by the other tag does not match the one stored")
+	}
+}
+
+func TestOCITagsAsRegistryTags(t *testing.T) {
+	registry := newTestRegistry()
+	defer registry.server.Close()
+	testTags(t, "oci://"+registry.address()+"/assets/demo")
+	registry.refuseMount = true
+	testTags(t, "oci://"+registry.address()+"/assets/copied")
+
+	if _, ok := registry.tags["assets/demo"]["prod-current"]; !ok {
+		t.Errorf("tag prod-current was not pushed as tag of repository assets/demo")
+	}
+	lister := newTestStore(t, "oci://"+registry.address()+"/assets", "demo", "")
+	if err := lister.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := lister.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "assets/demo/demo_0_1_0" {
+		t.Errorf("expected only asset demo_0_1_0 to be listed without its tags, got %d objects", len(objects))
+	}
+}
@@ -0,0 +1,165 @@
+package backend
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval is the minimum interval between two progress events of an upload.
+const progressInterval = time.Second
+
+// Progress is the event emitted to Store.OnProgress while the asset is being stored.
+type Progress struct {
+	// Key of the asset being stored.
+	Key string
+	// Transferred is the number of bytes stored so far, including the ones stored by the interrupted upload which was resumed.
+	Transferred int64
+	// Total is the size of the asset in bytes.
+	Total int64
+	// Rate is the number of bytes stored per second by the current upload.
+	Rate float64
+	// ETA is the estimated time to store rest of the asset.
+	ETA time.Duration
+}
+
+// progressTracker accumulates the bytes stored by the backend and emits progress events at most once every progressInterval.
+// Backends get it from the context passed to Put, all of its methods are safe to be called on nil tracker.
+type progressTracker struct {
+	mu          sync.Mutex
+	key         string
+	total       int64
+	transferred int64
+	resumed     int64
+	start       time.Time
+	last        time.Time
+	callback    func(Progress)
+}
+
+type progressKey struct{}
+
+func newProgressTracker(key string, total int64, callback func(Progress)) *progressTracker {
+	return &progressTracker{key: key, total: total, start: time.Now(), callback: callback}
+}
+
+// withProgress returns the context carrying the tracker to the backend.
+func withProgress(ctx context.Context, tracker *progressTracker) context.Context {
+	if tracker == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, tracker)
+}
+
+// progressOf returns the tracker carried by the context, nil if there is none.
+func progressOf(ctx context.Context) *progressTracker {
+	tracker, _ := ctx.Value(progressKey{}).(*progressTracker)
+	return tracker
+}
+
+// resume records the bytes stored by the interrupted upload, they are not accounted while computing the rate.
+func (t *progressTracker) resume(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.resumed += n
+	t.mu.Unlock()
+	t.add(n)
+}
+
+// restart discards the bytes accounted by the attempt which failed, as the next attempt stores them again.
+// Backends resuming the upload account the bytes already stored with resume.
+func (t *progressTracker) restart() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transferred, t.resumed, t.start = 0, 0, time.Now()
+}
+
+// add accounts n bytes as stored and emits the event if it is due.
+func (t *progressTracker) add(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.transferred += n
+	now := time.Now()
+	if now.Sub(t.last) < progressInterval {
+		return
+	}
+	t.last = now
+	t.callback(t.progress(now))
+}
+
+// finish emits the event of the asset stored completely.
+func (t *progressTracker) finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transferred = t.total
+	t.callback(t.progress(time.Now()))
+}
+
+func (t *progressTracker) progress(now time.Time) Progress {
+	event := Progress{Key: t.key, Transferred: t.transferred, Total: t.total}
+	if event.Transferred > event.Total {
+		event.Transferred = event.Total
+	}
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		event.Rate = float64(t.transferred-t.resumed) / elapsed
+	}
+	if event.Rate > 0 {
+		event.ETA = time.Duration(float64(event.Total-event.Transferred) / event.Rate * float64(time.Second))
+	}
+	return event
+}
+
+// reader returns the reader which accounts the bytes read from r as stored.
+func (t *progressTracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{reader: r, tracker: t}
+}
+
+// readSeeker is same as reader, except that the bytes read again after seeking back are not accounted twice.
+// It is used with the clients which rewind the body to retry the request.
+func (t *progressTracker) readSeeker(r io.ReadSeeker) io.ReadSeeker {
+	if t == nil {
+		return r
+	}
+	return &progressReader{reader: r, seeker: r, tracker: t}
+}
+
+type progressReader struct {
+	reader   io.Reader
+	seeker   io.Seeker
+	tracker  *progressTracker
+	position int64
+	counted  int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.position += int64(n)
+	if r.position > r.counted {
+		r.tracker.add(r.position - r.counted)
+		r.counted = r.position
+	}
+	return n, err
+}
+
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	position, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.position = position
+	}
+	return position, err
+}
@@ -0,0 +1,66 @@
+package backend_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+func TestProgressRestartsWithRetriedUpload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	failed := false
+	server.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPut && r.URL.Path == "/assets/demo_0_1_0" && !failed {
+			failed = true
+			ioutil.ReadAll(r.Body)
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 4<<20)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 2, BackoffMS: 1, Jitter: -1}
+	events := make([]backend.Progress, 0)
+	store.OnProgress = func(progress backend.Progress) {
+		events = append(events, progress)
+	}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) > 3 {
+		t.Errorf("expected progress to be reported at most once a second and once stored, got %d events", len(events))
+	}
+	if last := events[len(events)-1]; last.Transferred != last.Total || last.Total != 4<<20 {
+		t.Errorf("expected the last event to report the asset stored completely, got %+v", last)
+	}
+}
+
+func TestGCSCompositeSizeWithinComponentLimit(t *testing.T) {
+	tests := []struct {
+		partSize, size, want int64
+	}{
+		{16 << 20, 1 << 30, 16 << 20},
+		{16 << 20, 16 << 30, 16 << 20},
+		{16 << 20, 16<<30 + 1, 16<<20 + 1},
+		{1 << 20, 5 << 30, 5 << 20},
+	}
+	for _, test := range tests {
+		partSize := backend.GCSCompositeSize(test.partSize, test.size)
+		if partSize != test.want {
+			t.Errorf("expected part size %d for asset of %d bytes, got %d", test.want, test.size, partSize)
+		}
+		if parts := (test.size + partSize - 1) / partSize; parts > 1024 {
+			t.Errorf("asset of %d bytes would be composed of %d parts", test.size, parts)
+		}
+	}
+}
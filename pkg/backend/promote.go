@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Promote copies the stored asset as is into the namespace of the environment, so that it need not be packed again.
+// Metadata of the promoted asset records the environment along with who promoted it and when.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) Promote(environment, promotedBy string) (*Object, error) {
+	return b.PromoteWithContext(context.Background(), environment, promotedBy)
+}
+
+// PromoteWithContext is Promote which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) PromoteWithContext(ctx context.Context, environment, promotedBy string) (*Object, error) {
+	if b.backend == nil {
+		return nil, fmt.Errorf("unable to promote asset, backend was not initialized")
+	}
+	if len(environment) == 0 {
+		return nil, fmt.Errorf("environment to which the asset has to be promoted is not set")
+	}
+	if environment == b.Environment {
+		return nil, fmt.Errorf("asset %s is already under environment %s", b.key(), environment)
+	}
+
+	source, err := b.backend.Stat(ctx, b.key())
+	if err != nil {
+		return nil, fmt.Errorf("unable to find asset %s to promote: %w", b.key(), err)
+	}
+
+	target := path.Join(b.Folder, environment, b.Name)
+	exists, err := b.backend.Exists(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if exists && !b.SkipRemoteCheck {
+		return nil, fmt.Errorf("asset was already promoted to environment %s as %s", environment, target)
+	}
+
+	tempDir, err := ioutil.TempDir("", "unpackker-promote-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	assetPath := filepath.Join(tempDir, b.Name)
+	if err := b.backend.Get(ctx, b.key(), assetPath); err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	for key, value := range source.MetaData {
+		meta[key] = value
+	}
+	meta[MetaDataPromotedFrom] = source.MetaData[MetaDataEnvironment]
+	meta[MetaDataEnvironment] = environment
+	meta[MetaDataPromotedBy] = promotedBy
+	meta[MetaDataPromotedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	if !b.SkipRemoteCheck {
+		ctx = WithCreateOnly(ctx)
+	}
+	if err := b.backend.Put(ctx, target, assetPath, meta); err != nil {
+		if errors.Is(err, ErrAlreadyExists) {
+			return nil, fmt.Errorf("asset was promoted to environment %s as %s by another run meanwhile: %w", environment, target, err)
+		}
+		return nil, err
+	}
+	return b.backend.Stat(ctx, target)
+}
@@ -0,0 +1,85 @@
+package backend_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestPromoteRecordsEnvironment(t *testing.T) {
+	defer backendtest.ClearMem(t, "promote")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, "mem://promote/assets/demo", "demo_0_1_0", assetPath)
+	store.MetaData = map[string]string{backend.MetaDataVersion: "0.1.0", backend.MetaDataEnvironment: "development", "team": "platform"}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	source, err := store.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Promote("", "ci"); err == nil {
+		t.Errorf("expected promoting without environment to fail")
+	}
+	started := time.Now().UTC().Truncate(time.Second)
+	promoted, err := store.Promote("production", "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Key != "assets/demo/production/demo_0_1_0" {
+		t.Errorf("expected asset to be promoted under the namespace of environment, got %s", promoted.Key)
+	}
+	want := map[string]string{
+		backend.MetaDataEnvironment:  "production",
+		backend.MetaDataPromotedFrom: "development",
+		backend.MetaDataPromotedBy:   "ci",
+		backend.MetaDataVersion:      "0.1.0",
+		backend.MetaDataChecksum:     source.MetaData[backend.MetaDataChecksum],
+		"team":                       "platform",
+	}
+	for key, value := range want {
+		if promoted.MetaData[key] != value {
+			t.Errorf("expected metadata %s of promoted asset to be %q, got %q", key, value, promoted.MetaData[key])
+		}
+	}
+	if promotedAt, err := time.Parse(time.RFC3339, promoted.MetaData[backend.MetaDataPromotedAt]); err != nil || promotedAt.Before(started) {
+		t.Errorf("time of promotion was not recorded, got %q", promoted.MetaData[backend.MetaDataPromotedAt])
+	}
+
+	fetcher := newTestStore(t, "mem://promote/assets/demo", "demo_0_1_0", "")
+	fetcher.Environment = "production"
+	if err := fetcher.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, fetcher, filepath.Join(dir, "fetched"), content)
+
+	if _, err := fetcher.Promote("production", "ci"); err == nil || !strings.Contains(err.Error(), "already under environment") {
+		t.Errorf("expected promoting to the environment asset is under to fail, got %v", err)
+	}
+	if _, err := store.Promote("production", "release"); err == nil || !strings.Contains(err.Error(), "already promoted") {
+		t.Fatalf("expected promoting again to the same environment to be rejected, got %v", err)
+	}
+	if object, _ := fetcher.Stat(); object.MetaData[backend.MetaDataPromotedBy] != "ci" {
+		t.Errorf("asset promoted earlier was overwritten by the promotion rejected")
+	}
+
+	store.SkipRemoteCheck = true
+	if promoted, err = store.Promote("production", "release"); err != nil {
+		t.Fatal(err)
+	}
+	if promoted.MetaData[backend.MetaDataPromotedBy] != "release" {
+		t.Errorf("expected promotion with SkipRemoteCheck to replace the asset promoted earlier, got %v", promoted.MetaData)
+	}
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by the backends when the requested object is not present.
+	ErrNotFound = errors.New("object not found in the backend")
+	// ErrAlreadyExists is returned by the backends when the object to be created with WithCreateOnly is already present.
+	ErrAlreadyExists = errors.New("object already exists in the backend")
+)
+
+// Backend is implemented by every store to which unpackker can push the packed asset or fetch it from.
+// Implementations are registered against a scheme using Register and Store dispatches all its operations to them.
+// The ones holding connections, such as sftp, implement io.Closer as well which is invoked by Store.Close.
+type Backend interface {
+	// Init prepares the backend with the configuration passed through Store, it is invoked by Store.InitBackend.
+	Init(ctx context.Context, store *Store) error
+	// Exists reports whether the object identified by key is present in the backend.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Put uploads the file at path as the object identified by key along with its metadata.
+	// Object should become visible to the readers only once it is completely written.
+	// When CreateOnly(ctx) is true it has to fail with ErrAlreadyExists if the object is present,
+	// backends supporting conditional writes check it along with the write so that concurrent uploads do not overwrite each other.
+	Put(ctx context.Context, key, path string, meta map[string]string) error
+	// Get downloads the object identified by key on to path.
+	Get(ctx context.Context, key, path string) error
+	// List returns all objects whose key begins with prefix.
+	List(ctx context.Context, prefix string) ([]*Object, error)
+	// Delete removes the object identified by key, ErrNotFound is returned if it does not exist.
+	Delete(ctx context.Context, key string) error
+	// Stat returns the attributes of the object identified by key, ErrNotFound is returned if it does not exist.
+	Stat(ctx context.Context, key string) (*Object, error)
+}
+
+type createOnlyKey struct{}
+
+// WithCreateOnly returns the context asking Put to create the object only if it is not present.
+func WithCreateOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, createOnlyKey{}, true)
+}
+
+// CreateOnly reports whether Put was asked to create the object only if it is not present.
+func CreateOnly(ctx context.Context) bool {
+	createOnly, _ := ctx.Value(createOnlyKey{}).(bool)
+	return createOnly
+}
+
+// Object holds the attributes of an asset stored in the backend.
+type Object struct {
+	// Key of the object in the backend, it would be Folder/Name of the asset.
+	Key string `json:"key" yaml:"key"`
+	// Size of the object in bytes.
+	Size int64 `json:"size" yaml:"size"`
+	// Modified is the time at which the object was last uploaded.
+	Modified time.Time `json:"modified" yaml:"modified"`
+	// MetaData that was stored along with the object.
+	MetaData map[string]string `json:"metadata" yaml:"metadata"`
+	// ETag identifies the revision of the object, it is the generation incase of gcp and the digest of asset layer incase of oci.
+	// It is empty for the backends which do not track revisions, such as fs and sftp.
+	ETag string `json:"etag,omitempty" yaml:"etag,omitempty"`
+}
+
+// Factory returns a new instance of the Backend.
+type Factory func() Backend
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("gs", newGCSBackend)
+	Register("s3", newS3Backend)
+	Register("azblob", newAzureBackend)
+	Register("file", newFSBackend)
+	Register("http", newHTTPBackend)
+	Register("https", newHTTPBackend)
+	Register("oci", newOCIBackend)
+	Register("sftp", newSFTPBackend)
+	Register("mem", newMemBackend)
+}
+
+// Register makes a backend available under the scheme, so that it can be used by setting Store.Cloud to the scheme.
+// The builtin clouds gcp, aws, azure and fs are registered under gs, s3, azblob and file, http under http and https.
+// Container registries are registered under oci and plain servers over SSH under sftp.
+// Assets kept in the memory of the process, which helps in testing the code storing or fetching them, are registered under mem.
+// Register panics if it is invoked twice with the same scheme or with a nil factory.
+func Register(scheme string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("backend: Register factory is nil for scheme " + scheme)
+	}
+	if _, dup := registry[scheme]; dup {
+		panic("backend: Register called twice for scheme " + scheme)
+	}
+	registry[scheme] = factory
+}
+
+// Schemes returns the sorted list of registered backend schemes.
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	schemes := make([]string, 0, len(registry))
+	for scheme := range registry {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// getBackend returns a new instance of backend registered for the cloud, cloud could either be name of builtin cloud or scheme.
+func getBackend(cloud string) (Backend, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	factory, ok := registry[schemeOf(cloud)]
+	if !ok {
+		return nil, fmt.Errorf("at the moment unpackker does not support backend for the cloud %s configured", cloud)
+	}
+	return factory(), nil
+}
+
+// schemeOf maps the builtin cloud to its scheme, any other cloud is considered to be scheme itself.
+func schemeOf(cloud string) string {
+	if prefix, ok := bucketPrefix[cloud]; ok {
+		return strings.TrimSuffix(prefix, "://")
+	}
+	return cloud
+}
@@ -0,0 +1,133 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// MetaDataProtected is the default metadata key, versions having it set to true are never pruned.
+	MetaDataProtected  = "protected"
+	unknownEnvironment = "unknown"
+)
+
+// Retention holds the policies based on which the stored versions of the asset are pruned.
+type Retention struct {
+	// KeepLast is the number of latest versions retained per environment, versions beyond it are pruned. 0 retains all.
+	KeepLast int `json:"keeplast" yaml:"keeplast"`
+	// MaxAgeDays is the age in days after which versions packed under MaxAgeEnvironments are pruned. 0 disables it.
+	MaxAgeDays int `json:"maxagedays" yaml:"maxagedays"`
+	// MaxAgeEnvironments are the environments to which MaxAgeDays applies, defaults to development.
+	MaxAgeEnvironments []string `json:"maxageenvironments" yaml:"maxageenvironments"`
+	// ProtectedKey is the metadata key, versions having it set to true are never pruned. Defaults to protected.
+	ProtectedKey string `json:"protectedkey" yaml:"protectedkey"`
+}
+
+// Prune deletes the versions of the asset under Folder/Name which are not retained by the policy and returns them.
+// Versions which the tags of the asset point at are retained. Nothing is deleted if dryRun is set, it just returns the versions which would be deleted.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) Prune(policy *Retention, dryRun bool) ([]*Object, error) {
+	return b.PruneWithContext(context.Background(), policy, dryRun)
+}
+
+// PruneWithContext is Prune which is abandoned once ctx is done, the versions deleted until then stay deleted.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) PruneWithContext(ctx context.Context, policy *Retention, dryRun bool) ([]*Object, error) {
+	if policy == nil {
+		return nil, fmt.Errorf("retention policy is not configured, nothing to prune")
+	}
+
+	objects, err := b.ListWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tagStore := *b
+	tagStore.Folder, tagStore.Environment = path.Join(b.Folder, b.Name), ""
+	tags, err := tagStore.TagsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tags of the asset, which retain the versions they point at: %w", err)
+	}
+
+	expired := policy.Expired(objects, tags, time.Now())
+	if dryRun {
+		return expired, nil
+	}
+
+	for _, object := range expired {
+		if err := b.backend.Delete(ctx, object.Key); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("unable to delete %s: %v", object.Key, err)
+		}
+	}
+	return expired, nil
+}
+
+// Expired returns the objects which are not retained by the policy as of now, the ones which any of tags point at are always retained.
+func (r *Retention) Expired(objects []*Object, tags []*Tag, now time.Time) []*Object {
+	r.setDefaults()
+
+	tagged := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tagged[tag.Key] = true
+	}
+	environments := make(map[string][]*Object)
+	for _, object := range objects {
+		if r.protected(object) || tagged[object.Key] {
+			continue
+		}
+		environment := object.MetaData[MetaDataEnvironment]
+		if len(environment) == 0 {
+			environment = unknownEnvironment
+		}
+		environments[environment] = append(environments[environment], object)
+	}
+
+	expired := make([]*Object, 0)
+	for environment, versions := range environments {
+		sort.SliceStable(versions, func(i, j int) bool {
+			return versions[i].Modified.After(versions[j].Modified)
+		})
+		for index, version := range versions {
+			if r.KeepLast > 0 && index >= r.KeepLast {
+				expired = append(expired, version)
+				continue
+			}
+			if r.MaxAgeDays > 0 && r.appliesMaxAge(environment) && now.Sub(version.Modified) > time.Duration(r.MaxAgeDays)*24*time.Hour {
+				expired = append(expired, version)
+			}
+		}
+	}
+
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].Modified.Before(expired[j].Modified)
+	})
+	return expired
+}
+
+func (r *Retention) setDefaults() {
+	if len(r.MaxAgeEnvironments) == 0 {
+		r.MaxAgeEnvironments = []string{"development"}
+	}
+	if len(r.ProtectedKey) == 0 {
+		r.ProtectedKey = MetaDataProtected
+	}
+}
+
+func (r *Retention) protected(object *Object) bool {
+	protected, err := strconv.ParseBool(object.MetaData[r.ProtectedKey])
+	return err == nil && protected
+}
+
+func (r *Retention) appliesMaxAge(environment string) bool {
+	for _, env := range r.MaxAgeEnvironments {
+		if env == environment {
+			return true
+		}
+	}
+	return false
+}
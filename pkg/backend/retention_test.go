@@ -0,0 +1,125 @@
+package backend_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	object := func(key, environment string, age int, protected bool) *backend.Object {
+		meta := map[string]string{backend.MetaDataEnvironment: environment}
+		if protected {
+			meta[backend.MetaDataProtected] = "true"
+		}
+		return &backend.Object{Key: key, Modified: now.AddDate(0, 0, -age), MetaData: meta}
+	}
+	objects := []*backend.Object{
+		object("production/demo_0_1_0", "production", 90, false),
+		object("production/demo_0_2_0", "production", 60, true),
+		object("production/demo_0_3_0", "production", 50, false),
+		object("production/demo_0_4_0", "production", 40, false),
+		object("production/demo_0_5_0", "production", 5, false),
+		object("development/demo_0_6_0", "development", 45, false),
+		object("development/demo_0_7_0", "development", 2, false),
+		object("demo_0_8_0", "", 100, false),
+	}
+
+	tests := []struct {
+		name   string
+		policy backend.Retention
+		tags   []*backend.Tag
+		want   []string
+	}{
+		{"retains all by default", backend.Retention{}, nil, []string{}},
+		{"keeps last versions per environment", backend.Retention{KeepLast: 2}, nil,
+			[]string{"production/demo_0_1_0", "production/demo_0_3_0"}},
+		{"prunes versions of development beyond max age", backend.Retention{MaxAgeDays: 30}, nil,
+			[]string{"development/demo_0_6_0"}},
+		{"applies max age to the environments set", backend.Retention{MaxAgeDays: 30, MaxAgeEnvironments: []string{"production"}}, nil,
+			[]string{"production/demo_0_1_0", "production/demo_0_3_0", "production/demo_0_4_0"}},
+		{"combines the policies", backend.Retention{KeepLast: 1, MaxAgeDays: 1}, nil,
+			[]string{"production/demo_0_1_0", "production/demo_0_3_0", "development/demo_0_6_0", "production/demo_0_4_0", "development/demo_0_7_0"}},
+		{"honours protected key set", backend.Retention{KeepLast: 1, ProtectedKey: "pinned"}, nil,
+			[]string{"production/demo_0_1_0", "production/demo_0_2_0", "production/demo_0_3_0", "development/demo_0_6_0", "production/demo_0_4_0"}},
+		{"retains versions tagged", backend.Retention{KeepLast: 1}, []*backend.Tag{{Name: "stable", Key: "production/demo_0_3_0"}},
+			[]string{"production/demo_0_1_0", "development/demo_0_6_0", "production/demo_0_4_0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := test.policy
+			keys := make([]string, 0)
+			for _, object := range policy.Expired(objects, test.tags, now) {
+				keys = append(keys, object.Key)
+			}
+			if !reflect.DeepEqual(keys, test.want) {
+				t.Errorf("expected %v to be expired, got %v", test.want, keys)
+			}
+		})
+	}
+}
+
+func TestPruneRetainsTaggedAndLastVersions(t *testing.T) {
+	defer backendtest.ClearMem(t, "retention")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	stores := make([]*backend.Store, 0)
+	contents := make([][]byte, 0)
+	for index, name := range []string{"demo_0_1_0", "demo_0_2_0", "demo_0_3_0"} {
+		assetPath, content := newTestAsset(t, dir, name, (index+1)<<10)
+		store := newTestStore(t, "mem://retention/assets/demo", name, assetPath)
+		if err := store.InitBackend(); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.StoreAsset(); err != nil {
+			t.Fatal(err)
+		}
+		stores, contents = append(stores, store), append(contents, content)
+	}
+	if _, err := stores[0].SetTag("stable", "ci"); err != nil {
+		t.Fatal(err)
+	}
+
+	lister := newTestStore(t, "mem://retention/assets", "demo", "")
+	if err := lister.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	policy := &backend.Retention{KeepLast: 1}
+	pruned, err := lister.Prune(policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Key != "assets/demo/demo_0_2_0" {
+		t.Fatalf("expected only the version neither tagged nor last to be pruned, got %d versions", len(pruned))
+	}
+	if objects, _ := lister.List(); len(objects) != 3 {
+		t.Errorf("dry run deleted versions, %d are left", len(objects))
+	}
+
+	if _, err := lister.Prune(policy, false); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := lister.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Key != "assets/demo/demo_0_1_0" || objects[1].Key != "assets/demo/demo_0_3_0" {
+		t.Errorf("expected the tagged and the last version to be retained, got %d versions", len(objects))
+	}
+
+	resolver := newTestStore(t, "mem://retention/assets/demo", "demo", "")
+	if err := resolver.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.Resolve("stable"); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, resolver, filepath.Join(dir, "fetched"), contents[0])
+}
@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+)
+
+const (
+	defaultMaxAttempts  = 3
+	defaultBackoffMS    = 500
+	defaultMaxBackoffMS = 30000
+	defaultJitter       = 0.5
+)
+
+// Retry is the policy with which the operations of backend failing with ErrTransient are retried,
+// the backoff between the attempts is doubled every time until it reaches MaxBackoffMS.
+type Retry struct {
+	// MaxAttempts is the number of times an operation is attempted including the first one, defaults to 3. Set it to 1 to not retry.
+	MaxAttempts int `json:"maxattempts" yaml:"maxattempts"`
+	// BackoffMS is the time in milliseconds waited before the first retry, defaults to 500.
+	BackoffMS int `json:"backoffms" yaml:"backoffms"`
+	// MaxBackoffMS is the longest time in milliseconds waited between two attempts, defaults to 30000.
+	MaxBackoffMS int `json:"maxbackoffms" yaml:"maxbackoffms"`
+	// Jitter is the fraction of backoff that is randomized, so that the clients failing together do not retry together.
+	// It defaults to 0.5 and could be at most 1, set it to a negative value to wait for the exact backoff.
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+}
+
+func (r *Retry) maxAttempts() int {
+	if r == nil || r.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+// backoff returns the time to wait before the attempt following the one that failed.
+func (r *Retry) backoff(attempt int) time.Duration {
+	base, limit, jitter := defaultBackoffMS, defaultMaxBackoffMS, defaultJitter
+	if r != nil {
+		if r.BackoffMS > 0 {
+			base = r.BackoffMS
+		}
+		if r.MaxBackoffMS > 0 {
+			limit = r.MaxBackoffMS
+		}
+		if r.Jitter != 0 {
+			jitter = r.Jitter
+		}
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	wait := time.Duration(limit) * time.Millisecond
+	if shift := uint(attempt - 1); shift < 32 && time.Duration(base)<<shift < time.Duration(limit) {
+		wait = time.Duration(base) << shift * time.Millisecond
+	}
+	return wait - time.Duration(jitter*rand.Float64()*float64(wait))
+}
+
+// do invokes op until it succeeds, fails with the error which is not transient or runs out of attempts.
+// Error of op is classified with the classifier of backend, see classify.
+func (r *Retry) do(ctx context.Context, backend Backend, op func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := classify(backend, op(ctx))
+		if err == nil || !errors.Is(err, ErrTransient) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= r.maxAttempts() {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := r.backoff(attempt)
+		fmt.Println(ui.Warn(fmt.Sprintf("Retrying in %s as backend failed transiently: %v\n", wait.Round(time.Millisecond), err)))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// retryBackend retries the operations of Backend failing with transient errors as per the policy, and classifies their errors.
+type retryBackend struct {
+	Backend
+	policy *Retry
+}
+
+func (r *retryBackend) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := r.policy.do(ctx, r.Backend, func(ctx context.Context) error {
+		var err error
+		exists, err = r.Backend.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+// Put stores the object again on retry, backends storing it in parts resume from the parts already stored.
+// The attempt which failed transiently could still have stored the object, hence the object found present on retrying
+// with create only is taken to be the one stored by it when its checksum matches the one being stored.
+func (r *retryBackend) Put(ctx context.Context, key, path string, meta map[string]string) error {
+	failed := false
+	return r.policy.do(ctx, r.Backend, func(ctx context.Context) error {
+		progressOf(ctx).restart()
+		err := r.Backend.Put(ctx, key, path, meta)
+		if failed && CreateOnly(ctx) && errors.Is(classify(r.Backend, err), ErrAlreadyExists) && r.storedBy(ctx, key, meta) {
+			return nil
+		}
+		failed = failed || errors.Is(classify(r.Backend, err), ErrTransient)
+		return err
+	})
+}
+
+// storedBy reports whether the object stored under key has the checksum of meta.
+func (r *retryBackend) storedBy(ctx context.Context, key string, meta map[string]string) bool {
+	checksum := meta[MetaDataChecksum]
+	if len(checksum) == 0 {
+		return false
+	}
+	object, err := r.Backend.Stat(ctx, key)
+	return err == nil && object.MetaData[MetaDataChecksum] == checksum
+}
+
+// Get removes the file partially written by the failed attempt before retrying.
+func (r *retryBackend) Get(ctx context.Context, key, path string) error {
+	attempted := false
+	return r.policy.do(ctx, r.Backend, func(ctx context.Context) error {
+		if attempted {
+			os.Remove(path)
+		}
+		attempted = true
+		return r.Backend.Get(ctx, key, path)
+	})
+}
+
+func (r *retryBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	var objects []*Object
+	err := r.policy.do(ctx, r.Backend, func(ctx context.Context) error {
+		var err error
+		objects, err = r.Backend.List(ctx, prefix)
+		return err
+	})
+	return objects, err
+}
+
+func (r *retryBackend) Delete(ctx context.Context, key string) error {
+	return r.policy.do(ctx, r.Backend, func(ctx context.Context) error {
+		return r.Backend.Delete(ctx, key)
+	})
+}
+
+func (r *retryBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	var object *Object
+	err := r.policy.do(ctx, r.Backend, func(ctx context.Context) error {
+		var err error
+		object, err = r.Backend.Stat(ctx, key)
+		return err
+	})
+	return object, err
+}
+
+// provider returns the backend of the provider, whose operations are not retried.
+func (b *Store) provider() Backend {
+	if retrying, ok := b.backend.(*retryBackend); ok {
+		return retrying.Backend
+	}
+	return b.backend
+}
@@ -0,0 +1,201 @@
+package backend_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+)
+
+func TestRetryClassifiesErrorResponses(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 3, BackoffMS: 1, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status   int
+		class    error
+		attempts int
+	}{
+		{http.StatusBadRequest, nil, 1},
+		{http.StatusUnauthorized, backend.ErrPermissionDenied, 1},
+		{http.StatusForbidden, backend.ErrPermissionDenied, 1},
+		{http.StatusNotFound, backend.ErrNotFound, 1},
+		{http.StatusRequestTimeout, backend.ErrTransient, 3},
+		{http.StatusTooManyRequests, backend.ErrTransient, 3},
+		{http.StatusInternalServerError, backend.ErrTransient, 3},
+		{http.StatusNotImplemented, nil, 1},
+		{http.StatusServiceUnavailable, backend.ErrTransient, 3},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server.fail = func(r *http.Request) int {
+				if r.Method == http.MethodHead {
+					return test.status
+				}
+				return 0
+			}
+			server.requests = nil
+			_, err := store.Stat()
+			if err == nil {
+				t.Fatal("expected stat to fail")
+			}
+			for _, class := range []error{backend.ErrPermissionDenied, backend.ErrNotFound, backend.ErrTransient} {
+				if errors.Is(err, class) != (class == test.class) {
+					t.Errorf("expected error to be classified as %v, got %v", test.class, err)
+				}
+			}
+			if attempts := len(server.served("HEAD")); attempts != test.attempts {
+				t.Errorf("expected %d attempts, got %d", test.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPut {
+			return http.StatusBadGateway
+		}
+		return 0
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 2, BackoffMS: 1, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	err := store.StoreAsset()
+	if !errors.Is(err, backend.ErrTransient) || !strings.Contains(err.Error(), "giving up after 2 attempts") {
+		t.Fatalf("expected store to give up after 2 attempts, got %v", err)
+	}
+	if puts := len(server.served("PUT /assets/demo_0_1_0.metadata.json")); puts != 2 {
+		t.Errorf("expected 2 attempts, got %d", puts)
+	}
+}
+
+func TestRetryStopsOnCancel(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+	server.fail = func(r *http.Request) int {
+		if r.Method == http.MethodPut {
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+
+	assetPath, _ := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.Retry = &backend.Retry{MaxAttempts: 5, BackoffMS: 60000, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := store.StoreAssetWithContext(ctx); err == nil {
+		t.Fatal("expected store to fail")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("backoff was waited for even after cancellation, store returned after %s", elapsed)
+	}
+}
+
+func TestRetryFetchesOnlyTheFailedPart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	server := newTestArtifactServer()
+	defer server.server.Close()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 3<<20)
+	store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+	store.PartSizeMB, store.Concurrency = 1, 1
+	store.Retry = &backend.Retry{MaxAttempts: 2, BackoffMS: 1, Jitter: -1}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	failed := false
+	server.fail = func(r *http.Request) int {
+		if r.Header.Get("Range") == testPartRange && !failed {
+			failed = true
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+	server.requests = nil
+	fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+	if parts := server.served("GET /assets/demo_0_1_0 bytes=0-"); len(parts) != 1 {
+		t.Errorf("expected the part fetched before the failure not to be fetched again, got %v", parts)
+	}
+	if parts := server.served("GET /assets/demo_0_1_0 " + testPartRange); len(parts) != 2 {
+		t.Errorf("expected the failed part to be fetched again, got %v", parts)
+	}
+}
+
+func TestRetryTakesOverAssetStoredByFailedAttempt(t *testing.T) {
+	for _, landed := range []bool{true, false} {
+		dir := tempDir(t)
+		defer os.RemoveAll(dir)
+		server := newTestArtifactServer()
+		defer server.server.Close()
+		failed := false
+		server.fail = func(r *http.Request) int {
+			if r.Method != http.MethodPut || r.URL.Path != "/assets/demo_0_1_0" || failed {
+				return 0
+			}
+			// The asset is stored, yet the response of server is lost.
+			failed = true
+			if landed {
+				server.files[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+				server.modified[r.URL.Path] = time.Now()
+			}
+			return http.StatusBadGateway
+		}
+
+		assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+		store := newTestStore(t, server.server.URL+"/assets", "demo_0_1_0", assetPath)
+		store.Retry = &backend.Retry{MaxAttempts: 2, BackoffMS: 1, Jitter: -1}
+		if err := store.InitBackend(); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.StoreAsset(); err != nil {
+			t.Fatalf("asset stored by the attempt which failed was reported as conflict: %v", err)
+		}
+		object, err := store.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(object.MetaData[backend.MetaDataChecksum]) == 0 {
+			t.Errorf("sidecar of asset was rolled back by the attempt which failed")
+		}
+		fetchTestAsset(t, store, filepath.Join(dir, "fetched"), content)
+	}
+}
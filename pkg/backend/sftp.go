@@ -0,0 +1,499 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const sftpDefaultPort = "22"
+
+// sftpBackend stores the asset on plain servers over SFTP.
+// Store.Endpoint is the address of the server as [user@]host[:port], Store.Bucket the remote base directory.
+type sftpBackend struct {
+	root   string
+	client *sftp.Client
+	conn   *ssh.Client
+	// agent is the connection to ssh-agent, which is needed only until the keys it holds sign the handshake.
+	agent net.Conn
+}
+
+func newSFTPBackend() Backend {
+	return &sftpBackend{}
+}
+
+// Init establishes the ssh connection to the server with either key file or ssh-agent and opens SFTP session over it.
+// Connection to ssh-agent is closed once the connection is established, the ones to the server by Close.
+func (c *sftpBackend) Init(ctx context.Context, store *Store) error {
+	if len(store.Endpoint) == 0 {
+		return fmt.Errorf("address of the server has to be set with 'endpoint' for sftp backend")
+	}
+	c.root = path.Clean("/" + strings.TrimPrefix(store.Bucket, "sftp://"))
+
+	username, address := c.splitEndpoint(store.Endpoint)
+	auth, err := c.getAuth(store.CredentialPath, store.CredentialType)
+	if err != nil {
+		return err
+	}
+	defer c.closeAgent()
+	hostKeyCallback, err := c.getHostKeyCallback()
+	if err != nil {
+		return err
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	// Neither ssh handshake nor opening the session take ctx, they are abandoned by closing the connection once ctx is done.
+	stop := closeOnDone(ctx, conn)
+	err = c.open(conn, address, &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	})
+	if cancelled := stop(); cancelled != nil {
+		if err == nil {
+			c.Close()
+		}
+		return fmt.Errorf("unable to establish ssh connection to %s: %w", address, cancelled)
+	}
+	return err
+}
+
+// open establishes the ssh connection over conn and opens SFTP session over it, conn is closed if either of them fail.
+func (c *sftpBackend) open(conn net.Conn, address string, config *ssh.ClientConfig) error {
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("unable to establish ssh connection to %s: %w", address, err)
+	}
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return fmt.Errorf("unable to start sftp session on %s: %w", address, err)
+	}
+	c.client, c.conn = client, sshClient
+	return nil
+}
+
+// closeOnDone closes conn once ctx is done until the function returned is called, which returns the error of ctx if it was done.
+func closeOnDone(ctx context.Context, conn net.Conn) func() error {
+	stopped, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stopped:
+		}
+	}()
+	return func() error {
+		close(stopped)
+		<-exited
+		return ctx.Err()
+	}
+}
+
+// Close ends the SFTP session and closes the ssh connection over which it was opened.
+func (c *sftpBackend) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	c.client.Close()
+	err := c.conn.Close()
+	c.client, c.conn = nil, nil
+	return err
+}
+
+// splitEndpoint splits endpoint into user and address, user defaults to the current user and port to 22.
+func (c *sftpBackend) splitEndpoint(endpoint string) (string, string) {
+	endpoint = strings.TrimPrefix(endpoint, "sftp://")
+	username := ""
+	if index := strings.LastIndex(endpoint, "@"); index != -1 {
+		username, endpoint = endpoint[:index], endpoint[index+1:]
+	}
+	if len(username) == 0 {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		}
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(endpoint, sftpDefaultPort)
+	}
+	return username, endpoint
+}
+
+// getAuth returns the ssh auth method, key type reads the private key from CredentialPath and agent uses ssh-agent.
+// With default type, ssh-agent is used when SSH_AUTH_SOCK is set else the default keys under ~/.ssh are tried.
+func (c *sftpBackend) getAuth(credsPath, credstype string) (ssh.AuthMethod, error) {
+	switch credstype {
+	case "key", "file":
+		return c.keyAuth(credsPath)
+	case "agent":
+		return c.agentAuth()
+	case "default":
+		if len(os.Getenv("SSH_AUTH_SOCK")) != 0 {
+			return c.agentAuth()
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if keyPath := filepath.Join(home, ".ssh", key); helper.Statfile(keyPath) {
+				return c.keyAuth(keyPath)
+			}
+		}
+		return nil, fmt.Errorf("neither SSH_AUTH_SOCK is set nor default keys found under ~/.ssh for sftp backend")
+	}
+	return nil, fmt.Errorf("unsupported sftp client initialization")
+}
+
+func (c *sftpBackend) keyAuth(keyPath string) (ssh.AuthMethod, error) {
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer ssh.Signer
+	if passphrase := os.Getenv("UNPACKKER_SSH_PASSPHRASE"); len(passphrase) != 0 {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key %s: %v", keyPath, err)
+	}
+	return ssh.PublicKeys(signer), nil
+}
+
+func (c *sftpBackend) agentAuth() (ssh.AuthMethod, error) {
+	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ssh-agent: %v", err)
+	}
+	c.agent = conn
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+func (c *sftpBackend) closeAgent() {
+	if c.agent != nil {
+		c.agent.Close()
+		c.agent = nil
+	}
+}
+
+// getHostKeyCallback verifies the host key of server against known_hosts, which could be set with UNPACKKER_SSH_KNOWN_HOSTS.
+func (c *sftpBackend) getHostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHosts := os.Getenv("UNPACKKER_SSH_KNOWN_HOSTS")
+	if len(knownHosts) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	callback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load known hosts from %s: %v", knownHosts, err)
+	}
+	return callback, nil
+}
+
+// Exists checks for the asset under the remote base directory.
+func (c *sftpBackend) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := c.Stat(ctx, key); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Put uploads the asset to a temporary file and renames it once upload is complete. Metadata of the asset created is written
+// as sidecar file before that and is rolled back if renaming fails, so that the asset is never visible without its checksum.
+// Asset replacing the one present is renamed first and its sidecar is replaced after, as is done by fs backend.
+func (c *sftpBackend) Put(ctx context.Context, key, assetPath string, meta map[string]string) error {
+	asset, _, err := openAsset(assetPath)
+	if err != nil {
+		return err
+	}
+	defer asset.Close()
+
+	remotePath := c.path(key)
+	if err := c.client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return err
+	}
+
+	// Every upload writes to its own partial file, which is moved to the asset only once it is completely written.
+	partPath := c.partPath(remotePath)
+	remote, err := c.client.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer c.client.Remove(partPath)
+	if _, err := remote.ReadFrom(progressOf(ctx).reader(helper.ContextReader(ctx, asset))); err != nil {
+		remote.Close()
+		return err
+	}
+	if err := remote.Close(); err != nil {
+		return err
+	}
+
+	if !CreateOnly(ctx) {
+		content, err := metaDataContent(meta)
+		if err != nil {
+			return err
+		}
+		if err := c.replace(partPath, remotePath); err != nil {
+			return err
+		}
+		return c.replaceFile(remotePath+fsMetaDataSuffix, content)
+	}
+
+	rollback, err := c.createMetaData(key, meta)
+	if err != nil {
+		return err
+	}
+	if err := c.create(partPath, remotePath); err != nil {
+		rollback()
+		if c.exists(remotePath) {
+			return fmt.Errorf("%s: %w", key, ErrAlreadyExists)
+		}
+		return err
+	}
+	return nil
+}
+
+// replace moves the partial file to the asset, replacing the one present.
+func (c *sftpBackend) replace(partPath, remotePath string) error {
+	if err := c.client.PosixRename(partPath, remotePath); err != nil {
+		// Servers without posix-rename extension do not rename over the existing file.
+		if c.exists(remotePath) {
+			if err := c.client.Remove(remotePath); err != nil {
+				return err
+			}
+		}
+		return c.client.Rename(partPath, remotePath)
+	}
+	return nil
+}
+
+func (c *sftpBackend) partPath(remotePath string) string {
+	return fmt.Sprintf("%s.%d.part", remotePath, time.Now().UnixNano())
+}
+
+// create moves the partial file to the asset only if it is not present, by linking it with hardlink extension
+// or else by renaming it, as SFTP does not rename over the existing file.
+func (c *sftpBackend) create(partPath, remotePath string) error {
+	if err := c.client.Link(partPath, remotePath); err == nil || c.exists(remotePath) {
+		return err
+	}
+	return c.client.Rename(partPath, remotePath)
+}
+
+func (c *sftpBackend) exists(remotePath string) bool {
+	_, err := c.client.Stat(remotePath)
+	return err == nil
+}
+
+// ClassifyError classifies the status errors of SFTP server, the lost connection is not transient as the session is not established again.
+func (c *sftpBackend) ClassifyError(err error) error {
+	var status *sftp.StatusError
+	if errors.As(err, &status) {
+		switch status.FxCode() {
+		case sftp.ErrSSHFxPermissionDenied:
+			return ErrPermissionDenied
+		case sftp.ErrSSHFxNoSuchFile:
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// Get downloads the asset from the remote base directory onto the specified location.
+func (c *sftpBackend) Get(ctx context.Context, key, path string) error {
+	remote, err := c.client.Open(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return err
+	}
+	defer remote.Close()
+
+	return writeAsset(path, helper.ContextReader(ctx, remote))
+}
+
+// GetRange reads the part of the asset from the remote base directory.
+func (c *sftpBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	remote, err := c.client.Open(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	if _, err := remote.Seek(offset, io.SeekStart); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: helper.ContextReader(ctx, io.LimitReader(remote, length)), Closer: remote}, nil
+}
+
+// List walks through the remote base directory and returns the assets whose key begins with prefix.
+func (c *sftpBackend) List(ctx context.Context, prefix string) ([]*Object, error) {
+	objects := make([]*Object, 0)
+	walker := c.client.Walk(c.root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if walker.Stat().IsDir() || strings.HasSuffix(walker.Path(), fsMetaDataSuffix) || strings.HasSuffix(walker.Path(), ".part") {
+			continue
+		}
+
+		key := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), c.root), "/")
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		object, err := c.Stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// Delete removes the asset along with its metadata from the remote base directory.
+func (c *sftpBackend) Delete(ctx context.Context, key string) error {
+	if err := c.client.Remove(c.path(key)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := c.client.Remove(c.path(key) + fsMetaDataSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat returns the attributes of the asset along with the metadata read from its sidecar file.
+func (c *sftpBackend) Stat(ctx context.Context, key string) (*Object, error) {
+	info, err := c.client.Stat(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	meta, err := c.readMetaData(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Key:      key,
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+		MetaData: meta,
+	}, nil
+}
+
+func (c *sftpBackend) path(key string) string {
+	return path.Join(c.root, key)
+}
+
+// createMetaData writes the metadata of the asset to its sidecar file only if it is not present and returns the function which rolls it back.
+func (c *sftpBackend) createMetaData(key string, meta map[string]string) (func(), error) {
+	content, err := metaDataContent(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	sidecar := c.path(key) + fsMetaDataSuffix
+	partPath, err := c.writePart(sidecar, content)
+	if err != nil {
+		return nil, err
+	}
+	defer c.client.Remove(partPath)
+	if err := c.create(partPath, sidecar); err != nil {
+		if c.exists(sidecar) {
+			return nil, sidecarExistsError(key, sidecar, c.exists(c.path(key)))
+		}
+		return nil, err
+	}
+	return func() { c.client.Remove(sidecar) }, nil
+}
+
+// replaceFile writes the content to a partial file and moves it to remotePath, replacing the one present.
+func (c *sftpBackend) replaceFile(remotePath string, content []byte) error {
+	partPath, err := c.writePart(remotePath, content)
+	if err != nil {
+		return err
+	}
+	defer c.client.Remove(partPath)
+	return c.replace(partPath, remotePath)
+}
+
+// writePart writes the content to a partial file of remotePath and returns its path.
+func (c *sftpBackend) writePart(remotePath string, content []byte) (string, error) {
+	partPath := c.partPath(remotePath)
+	remote, err := c.client.Create(partPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := remote.Write(content); err != nil {
+		remote.Close()
+		c.client.Remove(partPath)
+		return "", err
+	}
+	if err := remote.Close(); err != nil {
+		c.client.Remove(partPath)
+		return "", err
+	}
+	return partPath, nil
+}
+
+func (c *sftpBackend) readMetaData(key string) (map[string]string, error) {
+	meta := make(map[string]string)
+	remote, err := c.client.Open(c.path(key) + fsMetaDataSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, err
+	}
+	defer remote.Close()
+
+	if err := json.NewDecoder(remote).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("unable to decode metadata of asset %s: %v", key, err)
+	}
+	return meta, nil
+}
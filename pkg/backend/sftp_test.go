@@ -0,0 +1,311 @@
+package backend_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSFTP is the in-process SSH server serving the SFTP subsystem over the local filesystem, to the client holding its key.
+// The host key of server is written to known_hosts under dir, which UNPACKKER_SSH_KNOWN_HOSTS is pointed at.
+type testSFTP struct {
+	dir      string
+	listener net.Listener
+	key      *ecdsa.PrivateKey
+	keyPath  string
+	// connections is the number of ssh connections open.
+	connections int32
+}
+
+func newTestSFTP(t *testing.T) *testSFTP {
+	t.Helper()
+	server := &testSFTP{dir: tempDir(t)}
+	hostKey, err := newTestSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ssh.NewSignerFromKey(server.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := x509.MarshalECPrivateKey(server.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.keyPath = filepath.Join(server.dir, "id_ecdsa")
+	if err := ioutil.WriteFile(server.keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encoded}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "unpackker" && string(key.Marshal()) == string(clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	config.AddHostKey(hostKey)
+	if server.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	knownHosts := filepath.Join(server.dir, "known_hosts")
+	line := knownhosts.Line([]string{server.listener.Addr().String()}, hostKey.PublicKey())
+	if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("UNPACKKER_SSH_KNOWN_HOSTS", knownHosts)
+
+	go func() {
+		for {
+			conn, err := server.listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func newTestSigner() (ssh.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+func (s *testSFTP) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	atomic.AddInt32(&s.connections, 1)
+	defer atomic.AddInt32(&s.connections, -1)
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channel is supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func(requests <-chan *ssh.Request) {
+			for req := range requests {
+				// Payload of subsystem request is the length prefixed name of subsystem.
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+			}
+		}(requests)
+		go func() {
+			defer channel.Close()
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+		}()
+	}
+}
+
+// uri returns the backend URI of folder under the directory of server, with the key of client as credential.
+func (s *testSFTP) uri(folder string) string {
+	return "sftp://unpackker@" + s.listener.Addr().String() + filepath.Join(s.dir, folder) + "?credstype=key&credspath=" + s.keyPath
+}
+
+// eventually reports whether condition holds within a few seconds, as the connections are closed asynchronously.
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testSFTP) close() {
+	s.listener.Close()
+	os.RemoveAll(s.dir)
+	os.Unsetenv("UNPACKKER_SSH_KNOWN_HOSTS")
+}
+
+func TestSFTPConformance(t *testing.T) {
+	server := newTestSFTP(t)
+	defer server.close()
+	store, err := backend.Parse(server.uri("assets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backendtest.Run(t, store)
+}
+
+func TestSFTPAuthenticatesWithAgent(t *testing.T) {
+	server := newTestSFTP(t)
+	defer server.close()
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: server.key}); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(server.dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var agents int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&agents, 1)
+			go func() {
+				defer atomic.AddInt32(&agents, -1)
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	os.Setenv("SSH_AUTH_SOCK", socket)
+	defer os.Unsetenv("SSH_AUTH_SOCK")
+
+	assetPath, content := newTestAsset(t, server.dir, "demo_0_1_0", 1<<10)
+	uri := strings.Split(server.uri("assets"), "?")[0] + "?credstype=agent"
+	store := newTestStore(t, uri, "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return atomic.LoadInt32(&agents) == 0 }) {
+		t.Errorf("connection to ssh-agent was left open after the handshake")
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	fetchTestAsset(t, store, filepath.Join(server.dir, "fetched"), content)
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return atomic.LoadInt32(&server.connections) == 0 }) {
+		t.Errorf("ssh connection to the server was left open after the store was closed")
+	}
+	if err := store.StoreAsset(); err == nil {
+		t.Errorf("expected the store closed to require initializing its backend again")
+	}
+}
+
+func TestSFTPHandshakeStopsOnCancel(t *testing.T) {
+	server := newTestSFTP(t)
+	defer server.close()
+	// The server accepts the connection but never speaks, the handshake would wait for it forever.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		if conn, err := silent.Accept(); err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+
+	uri := strings.Replace(server.uri("assets"), server.listener.Addr().String(), silent.Addr().String(), 1)
+	store := newTestStore(t, uri, "demo_0_1_0", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := store.InitBackendWithContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the handshake to be abandoned once ctx is done, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("handshake was waited for even after cancellation, init returned after %s", elapsed)
+	}
+}
+
+func TestSFTPRejectsVersionStoredMeanwhile(t *testing.T) {
+	server := newTestSFTP(t)
+	defer server.close()
+
+	assetPath, _ := newTestAsset(t, server.dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.uri("assets"), "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	// Another run has stored the same version, yet not its sidecar, after this one checked for it.
+	remotePath := filepath.Join(server.dir, "assets", "demo_0_1_0")
+	if err := os.MkdirAll(filepath.Dir(remotePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(remotePath, []byte("stored meanwhile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := backend.WithCreateOnly(context.Background())
+	if err := store.Backend().Put(ctx, "demo_0_1_0", assetPath, nil); !errors.Is(err, backend.ErrAlreadyExists) {
+		t.Fatalf("expected upload of version stored meanwhile to be rejected, got %v", err)
+	}
+	if content, _ := ioutil.ReadFile(remotePath); string(content) != "stored meanwhile" {
+		t.Errorf("version stored meanwhile was overwritten")
+	}
+	if _, err := os.Stat(remotePath + ".metadata.json"); !os.IsNotExist(err) {
+		t.Errorf("sidecar of asset which was not stored was left behind")
+	}
+	if parts, _ := filepath.Glob(remotePath + ".*.part"); len(parts) != 0 {
+		t.Errorf("partial files of upload were left behind: %v", parts)
+	}
+}
+
+func TestSFTPKeepsSidecarOfFailedOverwrite(t *testing.T) {
+	server := newTestSFTP(t)
+	defer server.close()
+
+	assetPath, _ := newTestAsset(t, server.dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, server.uri("assets"), "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	// The asset is a directory that is not empty, which neither renaming nor removing replaces.
+	remotePath := filepath.Join(server.dir, "assets", "demo_0_1_0")
+	if err := os.MkdirAll(filepath.Join(remotePath, "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(remotePath+".metadata.json", []byte(`{"version":"0.0.9"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Backend().Put(context.Background(), "demo_0_1_0", assetPath, map[string]string{backend.MetaDataVersion: "0.1.0"}); err == nil {
+		t.Fatal("expected overwriting the asset to fail")
+	}
+	if sidecar, _ := ioutil.ReadFile(remotePath + ".metadata.json"); string(sidecar) != `{"version":"0.0.9"}` {
+		t.Errorf("sidecar of asset was replaced by the overwrite which failed, got %s", sidecar)
+	}
+}
@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+const (
+	// DefaultSignedURLExpiry is the time for which the signed URL is valid when no expiry is specified.
+	DefaultSignedURLExpiry = time.Hour
+	// MaxSignedURLExpiry is the longest time for which the signed URL could be valid, as limited by gcp and aws.
+	MaxSignedURLExpiry = 7 * 24 * time.Hour
+)
+
+// URLSigner is implemented by the backends which could sign the URL of an object, granting read access to it without credentials.
+// SignedURL uses it to share the asset with the consumers who have no access to the backend.
+type URLSigner interface {
+	// SignedURL returns the URL from which the object identified by key could be fetched with GET until expiry elapses.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// SignedURL returns the time-limited URL from which the asset could be fetched without credentials of the backend, supported by gcp, aws and azure.
+// Expiry defaults to DefaultSignedURLExpiry and could be at most MaxSignedURLExpiry. Checksum of the asset, and its encryption scheme
+// if it was encrypted on client side, are carried in the fragment of the URL, which is never sent to the server and is verified by FetchURL.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) SignedURL(expiry time.Duration) (string, error) {
+	return b.SignedURLWithContext(context.Background(), expiry)
+}
+
+// SignedURLWithContext is SignedURL which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) SignedURLWithContext(ctx context.Context, expiry time.Duration) (string, error) {
+	if b.backend == nil {
+		return "", fmt.Errorf("unable to sign URL of asset, backend was not initialized")
+	}
+	if expiry <= 0 {
+		expiry = DefaultSignedURLExpiry
+	}
+	if expiry > MaxSignedURLExpiry {
+		return "", fmt.Errorf("signed URL could be valid for at most %s, not %s", MaxSignedURLExpiry, expiry)
+	}
+	signer, ok := b.provider().(URLSigner)
+	if !ok {
+		return "", fmt.Errorf("backend %s does not support signed URLs, supported clouds are gcp, aws and azure", b.Cloud)
+	}
+
+	object, err := b.backend.Stat(ctx, b.key())
+	if err != nil {
+		return "", fmt.Errorf("unable to find asset %s to share: %w", b.key(), err)
+	}
+	signedURL, err := signer.SignedURL(ctx, b.key(), expiry)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign URL of asset %s: %v", b.key(), err)
+	}
+
+	fragment := url.Values{}
+	if checksum := object.MetaData[MetaDataChecksum]; len(checksum) != 0 {
+		fragment.Set(MetaDataChecksum, checksum)
+	}
+	if scheme := object.MetaData[MetaDataEncryption]; len(scheme) != 0 {
+		fragment.Set(MetaDataEncryption, scheme)
+	}
+	if len(fragment) == 0 {
+		return signedURL, nil
+	}
+	return signedURL + "#" + fragment.Encode(), nil
+}
+
+// FetchURL fetches the asset shared with SignedURL onto TargetPath, the credentials of the backend are not needed.
+// Name of the asset defaults to the last element of the URL path. Asset is verified against the checksum carried in the fragment of URL
+// before it is placed under TargetPath, and the asset encrypted on client side is decrypted with the keys of Encryption.
+func (b *Store) FetchURL(signedURL string) error {
+	return b.FetchURLWithContext(context.Background(), signedURL)
+}
+
+// FetchURLWithContext is FetchURL which is abandoned once ctx is done, the partial file of the fetch is removed as on any failure.
+func (b *Store) FetchURLWithContext(ctx context.Context, signedURL string) error {
+	assetURL, err := url.Parse(signedURL)
+	if err != nil {
+		return fmt.Errorf("invalid signed URL: %v", err)
+	}
+	if assetURL.Scheme != "https" {
+		return fmt.Errorf("signed URL has to be an https URL, not %s", assetURL.Scheme)
+	}
+	fragment, err := url.ParseQuery(assetURL.Fragment)
+	if err != nil {
+		return fmt.Errorf("invalid fragment of signed URL: %v", err)
+	}
+	assetURL.Fragment = ""
+
+	if len(b.Name) == 0 {
+		b.Name = path.Base(assetURL.Path)
+	}
+	b.TargetPath = b.getTargetPath()
+	if helper.Statfile(b.TargetPath) {
+		return fmt.Errorf("asset already fetched in the specified path: %s", b.TargetPath)
+	}
+
+	partPath := b.TargetPath + partSuffix
+	if err := downloadURL(ctx, assetURL.String(), partPath); err != nil {
+		os.Remove(partPath)
+		return err
+	}
+	if checksum := fragment.Get(MetaDataChecksum); len(checksum) != 0 {
+		if err := verifyChecksum(partPath, checksum); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+	} else {
+		fmt.Println(ui.Warn("Signed URL does not carry the checksum of the asset, skipping verification\n"))
+	}
+	if fragment.Get(MetaDataEncryption) == envelopeScheme {
+		defer os.Remove(partPath)
+		return b.Encryption.decryptFile(partPath, b.TargetPath)
+	}
+	return os.Rename(partPath, b.TargetPath)
+}
+
+// downloadURL fetches the content of the URL onto target.
+func downloadURL(ctx context.Context, assetURL, target string) error {
+	req, err := http.NewRequest(http.MethodGet, assetURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to fetch asset from signed URL: %v", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("signed URL was rejected with status %s, it has either expired or is invalid", resp.Status)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("asset shared with signed URL: %w", ErrNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unable to fetch asset from signed URL, server responded with status %s", resp.Status)
+	}
+
+	asset, err := helper.CreateFile(target)
+	if err != nil {
+		return err
+	}
+	if err := asset.Truncate(0); err != nil {
+		asset.Close()
+		return err
+	}
+	if _, err := io.Copy(asset, resp.Body); err != nil {
+		asset.Close()
+		return fmt.Errorf("unable to fetch asset from signed URL: %v", err)
+	}
+	return asset.Close()
+}
@@ -0,0 +1,84 @@
+package backend_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+func TestSignedURLFetchedAndVerified(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s3 := newTestS3()
+	defer s3.server.Close()
+
+	assetPath, content := newTestAsset(t, dir, "demo_0_1_0", 1<<10)
+	store := newTestStore(t, s3.uri("assets"), "demo_0_1_0", assetPath)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := store.SignedURL(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := store.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedURL, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fragment, _ := url.ParseQuery(signedURL.Fragment); fragment.Get(backend.MetaDataChecksum) != object.MetaData[backend.MetaDataChecksum] {
+		t.Fatalf("checksum of asset is not carried in the fragment of signed URL %s", signed)
+	}
+
+	// The stand-in of S3 is served over http, the URL signed by it is rejected as is and fetched from the one served over https.
+	fetcher := backend.New()
+	fetcher.TargetPath = filepath.Join(dir, "plain")
+	if err := fetcher.FetchURL(signed); err == nil || !strings.Contains(err.Error(), "https") {
+		t.Errorf("expected signed URL served over http to be rejected, got %v", err)
+	}
+	served := content
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != signedURL.Path || len(r.URL.Query().Get("X-Amz-Signature")) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write(served)
+	}))
+	defer server.Close()
+	defer trustTestServer(server)()
+	secure, _ := url.Parse(server.URL)
+	signedURL.Scheme, signedURL.Host = secure.Scheme, secure.Host
+
+	fetcher = backend.New()
+	fetcher.TargetPath = filepath.Join(dir, "fetched")
+	if err := fetcher.FetchURL(signedURL.String()); err != nil {
+		t.Fatalf("unable to fetch asset from signed URL: %v", err)
+	}
+	fetched, err := helper.FileChecksum(filepath.Join(dir, "fetched", "demo_0_1_0"))
+	if err != nil || fetched != object.MetaData[backend.MetaDataChecksum] {
+		t.Errorf("asset fetched from signed URL does not match the one stored: %v", err)
+	}
+
+	served = []byte("tampered")
+	fetcher = backend.New()
+	fetcher.TargetPath = filepath.Join(dir, "tampered")
+	if err := fetcher.FetchURL(signedURL.String()); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected asset not matching the checksum of signed URL to be rejected, got %v", err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "tampered", "*")); len(entries) != 0 {
+		t.Errorf("asset rejected was left behind: %v", entries)
+	}
+}
@@ -0,0 +1,313 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const (
+	// tagsDir is the directory under Folder in which the tags of the asset are stored.
+	tagsDir = ".tags"
+	// MetaDataTaggedVersion is the metadata key under which the version pointed by the tag is stored.
+	MetaDataTaggedVersion = "taggedversion"
+)
+
+// tagName is the pattern the name of tag has to match, so that it could be used as is in the key of every backend.
+var tagName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Tag is a movable name such as latest or stable, which points at a version of the asset stored in the backend.
+// Tags are stored as small objects under Folder/.tags, hence moving one does not touch the asset it points at.
+// Backends implementing Tagger, such as oci, hold them natively instead.
+type Tag struct {
+	Name string `json:"name" yaml:"name"`
+	// Version of the asset the tag points at.
+	Version string `json:"version" yaml:"version"`
+	// Environment namespace in which the asset resides, empty for the assets that are stored by generate.
+	Environment string `json:"environment" yaml:"environment"`
+	// Key of the asset in the backend.
+	Key      string    `json:"key" yaml:"key"`
+	TaggedAt time.Time `json:"taggedat" yaml:"taggedat"`
+	TaggedBy string    `json:"taggedby" yaml:"taggedby"`
+}
+
+// Tagger is implemented by the backends which hold the tags natively, such as registries of oci which could neither store
+// the tags as objects under Folder/.tags nor list them there. Tags are identified by the key Folder/name in these backends.
+type Tagger interface {
+	// PutTag points the tag identified by key at the object tag.Key, moving it if it was pointing at another object.
+	PutTag(ctx context.Context, key string, tag *Tag) error
+	// GetTag returns the tag identified by key, ErrNotFound is returned if there is no such tag.
+	GetTag(ctx context.Context, key string) (*Tag, error)
+	// ListTags returns all the tags whose key begins with prefix.
+	ListTags(ctx context.Context, prefix string) ([]*Tag, error)
+	// DeleteTag removes the tag identified by key, the object it points at is retained. ErrNotFound is returned if there is no such tag.
+	DeleteTag(ctx context.Context, key string) error
+}
+
+// SetTag points the tag at the asset, moving it if it was pointing at another version.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) SetTag(name, taggedBy string) (*Tag, error) {
+	return b.SetTagWithContext(context.Background(), name, taggedBy)
+}
+
+// SetTagWithContext is SetTag which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) SetTagWithContext(ctx context.Context, name, taggedBy string) (*Tag, error) {
+	if b.backend == nil {
+		return nil, fmt.Errorf("unable to tag asset, backend was not initialized")
+	}
+	if !tagName.MatchString(name) {
+		return nil, fmt.Errorf("invalid tag %q, it has to be at most 128 letters, digits, '.', '_' and '-' beginning with a letter or digit", name)
+	}
+
+	object, err := b.backend.Stat(ctx, b.key())
+	if err != nil {
+		return nil, fmt.Errorf("unable to find asset %s to tag: %w", b.key(), err)
+	}
+
+	tag := &Tag{
+		Name:        name,
+		Version:     object.MetaData[MetaDataVersion],
+		Environment: b.Environment,
+		Key:         b.key(),
+		TaggedAt:    time.Now().UTC(),
+		TaggedBy:    taggedBy,
+	}
+	if tagger, ok := b.provider().(Tagger); ok {
+		err := b.Retry.do(ctx, b.provider(), func(ctx context.Context) error {
+			return tagger.PutTag(ctx, b.tagKey(name), tag)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to store tag %s: %w", name, err)
+		}
+		return tag, nil
+	}
+
+	content, err := json.Marshal(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := ioutil.TempDir("", "unpackker-tag-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tagPath := filepath.Join(tempDir, name)
+	if err := ioutil.WriteFile(tagPath, content, 0644); err != nil {
+		return nil, err
+	}
+	if err := b.backend.Put(ctx, b.tagKey(name), tagPath, map[string]string{MetaDataTaggedVersion: tag.Version}); err != nil {
+		return nil, fmt.Errorf("unable to store tag %s: %w", name, err)
+	}
+	return tag, nil
+}
+
+// GetTag returns the tag of the asset stored under Folder, error wraps ErrNotFound if there is no such tag.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) GetTag(name string) (*Tag, error) {
+	return b.GetTagWithContext(context.Background(), name)
+}
+
+// GetTagWithContext is GetTag which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) GetTagWithContext(ctx context.Context, name string) (*Tag, error) {
+	if b.backend == nil {
+		return nil, fmt.Errorf("unable to read tag, backend was not initialized")
+	}
+	if !tagName.MatchString(name) {
+		return nil, fmt.Errorf("tag %s: %w", name, ErrNotFound)
+	}
+	if tagger, ok := b.provider().(Tagger); ok {
+		var tag *Tag
+		err := b.Retry.do(ctx, b.provider(), func(ctx context.Context) error {
+			var err error
+			tag, err = tagger.GetTag(ctx, b.tagKey(name))
+			return err
+		})
+		return tag, err
+	}
+
+	if _, err := b.backend.Stat(ctx, b.tagKey(name)); err != nil {
+		return nil, err
+	}
+
+	tempDir, err := ioutil.TempDir("", "unpackker-tag-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	tagPath := filepath.Join(tempDir, name)
+	if err := b.backend.Get(ctx, b.tagKey(name), tagPath); err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(tagPath)
+	if err != nil {
+		return nil, err
+	}
+	tag := new(Tag)
+	if err := json.Unmarshal(content, tag); err != nil {
+		return nil, fmt.Errorf("tag %s is corrupted: %v", name, err)
+	}
+	return tag, nil
+}
+
+// Tags returns all the tags of the asset stored under Folder, sorted by name.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) Tags() ([]*Tag, error) {
+	return b.TagsWithContext(context.Background())
+}
+
+// TagsWithContext is Tags which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) TagsWithContext(ctx context.Context) ([]*Tag, error) {
+	if b.backend == nil {
+		return nil, fmt.Errorf("unable to list tags, backend was not initialized")
+	}
+
+	tags := make([]*Tag, 0)
+	if tagger, ok := b.provider().(Tagger); ok {
+		err := b.Retry.do(ctx, b.provider(), func(ctx context.Context) error {
+			var err error
+			tags, err = tagger.ListTags(ctx, b.tagKey("")+"/")
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		objects, err := b.backend.List(ctx, b.tagKey("")+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			tag, err := b.GetTagWithContext(ctx, path.Base(object.Key))
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, tag)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// DeleteTag deletes the tag of the asset stored under Folder, the asset it points at is retained.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) DeleteTag(name string) error {
+	return b.DeleteTagWithContext(context.Background(), name)
+}
+
+// DeleteTagWithContext is DeleteTag which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) DeleteTagWithContext(ctx context.Context, name string) error {
+	if b.backend == nil {
+		return fmt.Errorf("unable to delete tag, backend was not initialized")
+	}
+
+	var err error
+	if tagger, ok := b.provider().(Tagger); ok {
+		err = b.Retry.do(ctx, b.provider(), func(ctx context.Context) error {
+			return tagger.DeleteTag(ctx, b.tagKey(name))
+		})
+	} else {
+		err = b.backend.Delete(ctx, b.tagKey(name))
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("tag %s: %w", name, ErrNotFound)
+		}
+		return err
+	}
+	return nil
+}
+
+// Resolve points Name and Environment of the Store at the asset referred by reference, which is either a tag stored under Folder
+// or a semver constraint such as ^1.2 or 1.4.x. For the constraint, highest version of the asset under Folder/Environment
+// that satisfies it is picked. When Cache is offline, reference is resolved to the asset it was resolved to when backend was last reached.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) Resolve(reference string) error {
+	return b.ResolveWithContext(context.Background(), reference)
+}
+
+// ResolveWithContext is Resolve which is abandoned once ctx is done.
+// Make sure that InitBackend is invoked before calling this.
+func (b *Store) ResolveWithContext(ctx context.Context, reference string) error {
+	ref := cacheRefKey(b.String(), path.Join(b.Folder, b.Environment), reference)
+	if b.Cache.offline() {
+		return b.resolveCached(ref, reference)
+	}
+	if b.backend == nil {
+		return fmt.Errorf("unable to resolve %s, backend was not initialized", reference)
+	}
+
+	tag, err := b.GetTagWithContext(ctx, reference)
+	if err == nil {
+		b.Environment = tag.Environment
+		b.Name = path.Base(tag.Key)
+		b.cacheRef(ref)
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	constraint, cerr := semver.NewConstraint(reference)
+	if cerr != nil {
+		return fmt.Errorf("%s is neither a tag of the asset under %s nor a semver constraint: %v", reference, b.String(), cerr)
+	}
+
+	dir := path.Join(b.Folder, b.Environment)
+	objects, err := b.backend.List(ctx, dir+"/")
+	if err != nil {
+		return fmt.Errorf("unable to list versions of the asset to resolve %s: %w", reference, err)
+	}
+	var picked *Object
+	var pickedVersion *semver.Version
+	for _, object := range objects {
+		if path.Dir(object.Key) != dir {
+			continue
+		}
+		version, err := semver.NewVersion(object.MetaData[MetaDataVersion])
+		if err != nil || !constraint.Check(version) {
+			continue
+		}
+		if picked == nil || version.GreaterThan(pickedVersion) || (version.Equal(pickedVersion) && object.Modified.After(picked.Modified)) {
+			picked, pickedVersion = object, version
+		}
+	}
+	if picked == nil {
+		return fmt.Errorf("no version of the asset under %s satisfies %s: %w", dir, reference, ErrNotFound)
+	}
+	b.Name = path.Base(picked.Key)
+	b.cacheRef(ref)
+	return nil
+}
+
+// tagKey returns the key of the tag in the backend, which is Folder/name for the backends implementing Tagger.
+func (b *Store) tagKey(name string) string {
+	if _, ok := b.provider().(Tagger); ok {
+		return path.Join(b.Folder, name)
+	}
+	return path.Join(b.Folder, tagsDir, name)
+}
+
+// isTagKey reports whether the key belongs to a tag rather than an asset.
+func isTagKey(key string) bool {
+	return strings.Contains("/"+key, "/"+tagsDir+"/")
+}
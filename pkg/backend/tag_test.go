@@ -0,0 +1,79 @@
+package backend_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestTagsStoredAsObjects(t *testing.T) {
+	defer backendtest.ClearMem(t, "tags")
+	testTags(t, "mem://tags/assets/demo")
+}
+
+// testTags tags the assets stored to the backend of uri, with the one promoted to production, and resolves them back through their tags.
+func testTags(t *testing.T, uri string) {
+	t.Helper()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	stores := make(map[string]*backend.Store)
+	contents := make(map[string][]byte)
+	for index, asset := range []struct{ name, environment string }{{"demo_0_1_0", ""}, {"demo_0_2_0", "production"}} {
+		assetPath, content := newTestAsset(t, dir, asset.name, (index+1)<<10)
+		store := newTestStore(t, uri, asset.name, assetPath)
+		store.Environment = asset.environment
+		if err := store.InitBackend(); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.StoreAsset(); err != nil {
+			t.Fatal(err)
+		}
+		stores[asset.name], contents[asset.name] = store, content
+	}
+	if _, err := stores["demo_0_1_0"].SetTag("latest", "ci"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores["demo_0_2_0"].SetTag("prod-current", "ci"); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := newTestStore(t, uri, "demo", "")
+	if err := resolver.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.Resolve("prod-current"); err != nil {
+		t.Fatal(err)
+	}
+	if resolver.Name != "demo_0_2_0" || resolver.Environment != "production" {
+		t.Errorf("prod-current was resolved to %s under environment %q", resolver.Name, resolver.Environment)
+	}
+	fetchTestAsset(t, resolver, filepath.Join(dir, "fetched"), contents["demo_0_2_0"])
+
+	tags, err := resolver.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"latest", "prod-current"}) {
+		t.Errorf("expected tags latest and prod-current, got %v", names)
+	}
+
+	if err := resolver.DeleteTag("latest"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.GetTag("latest"); !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("expected deleted tag to be not found, got %v", err)
+	}
+	if _, err := stores["demo_0_1_0"].Stat(); err != nil {
+		t.Errorf("asset the deleted tag pointed at was not retained: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// uploadStateSuffix is the suffix of the file saved next to the asset, which records the parts stored by an upload.
+const uploadStateSuffix = ".upload.state"
+
+// uploadState is saved next to the asset while it is stored in parts, so that an interrupted upload stores only the parts yet to be stored.
+// It is matched with the asset by its checksum, as the asset is built again by every generate.
+// Each bucket has its own state file, as the same asset could be stored to several backends at once.
+type uploadState struct {
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	PartSize int64  `json:"partsize"`
+	// UploadID of the multipart upload, set only by the backends which track the upload on their end.
+	UploadID string `json:"uploadid,omitempty"`
+	// Parts maps the number of part stored to its ETag or to the name of temporary object holding it.
+	Parts map[int]string `json:"parts"`
+}
+
+// uploadStatePath returns the path of the file recording the upload of the asset to the bucket.
+func uploadStatePath(assetPath, scheme, bucket string) string {
+	return assetPath + "." + scheme + "." + bucket + uploadStateSuffix
+}
+
+// loadUploadState returns the state of the earlier upload if it was storing the same asset, else a fresh one.
+// Assets without checksum in their metadata are always stored afresh.
+func loadUploadState(statePath, key string, size int64, meta map[string]string, partSize int64) *uploadState {
+	checksum := meta[MetaDataChecksum]
+	state := new(uploadState)
+	if content, err := ioutil.ReadFile(statePath); err == nil && json.Unmarshal(content, state) == nil && len(checksum) != 0 {
+		if state.Key == key && state.Size == size && state.Checksum == checksum && state.PartSize == partSize && state.Parts != nil {
+			return state
+		}
+	}
+	return &uploadState{
+		Key:      key,
+		Size:     size,
+		Checksum: checksum,
+		PartSize: partSize,
+		Parts:    make(map[int]string),
+	}
+}
+
+func (s *uploadState) save(statePath string) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(statePath, content, 0644)
+}
+
+func removeUploadState(statePath string) {
+	os.Remove(statePath)
+}
+
+// partCount returns the number of parts of size partSize the object of given size is split into.
+func partCount(size, partSize int64) int {
+	return int((size + partSize - 1) / partSize)
+}
+
+// partRange returns the offset and length of the part, parts are numbered from 0.
+func partRange(part int, size, partSize int64) (int64, int64) {
+	offset := int64(part) * partSize
+	length := partSize
+	if offset+length > size {
+		length = size - offset
+	}
+	return offset, length
+}
+
+// runParts invokes fn for each of the parts with at most concurrency of them running at once.
+// It stops handing out the parts on first error and returns it.
+func runParts(ctx context.Context, concurrency int, parts []int, fn func(ctx context.Context, part int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan int)
+	errs := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range queue {
+				if err := fn(ctx, part); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		for _, part := range parts {
+			select {
+			case queue <- part:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// uriParameters are the query parameters of backend URI and the fields of Store they set.
+	uriParameters = map[string]func(b *Store, value string){
+		"region":    func(b *Store, value string) { b.Region = value },
+		"endpoint":  func(b *Store, value string) { b.Endpoint = value },
+		"credstype": func(b *Store, value string) { b.CredentialType = value },
+		"credspath": func(b *Store, value string) { b.CredentialPath = value },
+		"profile":   func(b *Store, value string) { b.ownCredentials().Profile = value },
+		"rolearn":   func(b *Store, value string) { b.ownCredentials().RoleARN = value },
+	}
+	// bucketNames are the rules of bucket names of the clouds, which are validated while parsing the backend URI.
+	bucketNames = map[string]struct {
+		pattern *regexp.Regexp
+		rule    string
+	}{
+		"gs":     {regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,61}[a-z0-9]$`), "it has to be 3-63 characters of lowercase letters, digits, '-', '_' and '.', beginning and ending with a letter or digit"},
+		"s3":     {regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`), "it has to be 3-63 characters of lowercase letters, digits, '-' and '.', beginning and ending with a letter or digit"},
+		"azblob": {regexp.MustCompile(`^[a-z0-9](-?[a-z0-9])+$`), "container has to be 3-63 characters of lowercase letters, digits and single '-', beginning and ending with a letter or digit"},
+	}
+)
+
+// URIError is returned when the backend URI is invalid, Part names the part of URI which is at fault along with its Value.
+type URIError struct {
+	URI    string
+	Part   string
+	Value  string
+	Reason string
+}
+
+func (e *URIError) Error() string {
+	return fmt.Sprintf("invalid %s %q in backend %s: %s", e.Part, e.Value, e.URI, e.Reason)
+}
+
+// Parse returns the Store of the backend URI, which is of the form scheme://bucket/folder?parameter=value.
+// Schemes gs, s3, azblob and file select the clouds gcp, aws, azure and fs, any other registered scheme selects itself.
+// Incase of file the path is the root directory of the asset store, incase of http and https the URI is the base URL
+// of the repository and incase of sftp the host is the endpoint and path the remote base directory.
+// Folder must not have '.' or '..' segments, empty ones are dropped.
+// Parameters region, endpoint, credstype and credspath set the respective fields of Store, profile and rolearn set them of Credentials.
+func Parse(uri string) (*Store, error) {
+	store := New()
+	if err := store.SetURI(uri); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// SetURI sets the cloud, bucket and folder of Store along with the parameters from the backend URI, see Parse for its syntax.
+// Folder configured otherwise is retained when URI does not have one.
+func (b *Store) SetURI(uri string) error {
+	index := strings.Index(uri, "://")
+	if index <= 0 {
+		return &URIError{URI: uri, Part: "backend", Value: uri, Reason: "it has to be of the form scheme://bucket/folder"}
+	}
+	scheme, rest := uri[:index], uri[index+len("://"):]
+	if !isRegistered(scheme) {
+		return &URIError{URI: uri, Part: "scheme", Value: scheme, Reason: "supported schemes are: " + strings.Join(Schemes(), ", ")}
+	}
+
+	location, rawQuery := rest, ""
+	if index := strings.Index(rest, "?"); index != -1 {
+		location, rawQuery = rest[:index], rest[index+1:]
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return &URIError{URI: uri, Part: "query", Value: rawQuery, Reason: err.Error()}
+	}
+
+	parsed := *b
+	parsed.Cloud = cloudOf(scheme)
+	switch scheme {
+	case "file":
+		if len(location) == 0 {
+			return &URIError{URI: uri, Part: "path", Value: location, Reason: "root directory of the asset store is missing"}
+		}
+		parsed.Bucket = location
+	case "http", "https":
+		parsed.Bucket = scheme + "://" + location
+	default:
+		bucket, folder := location, ""
+		if index := strings.Index(location, "/"); index != -1 {
+			bucket, folder = location[:index], strings.Trim(location[index+1:], "/")
+		}
+		for _, segment := range strings.Split(folder, "/") {
+			if segment == "." || segment == ".." {
+				return &URIError{URI: uri, Part: "folder", Value: folder, Reason: "it must not have '.' or '..' segments"}
+			}
+		}
+		if len(folder) != 0 {
+			folder = path.Clean(folder)
+		}
+		if len(bucket) == 0 {
+			return &URIError{URI: uri, Part: "bucket", Value: bucket, Reason: "bucket is missing"}
+		}
+		if name, ok := bucketNames[scheme]; ok && (len(bucket) < 3 || len(bucket) > 63 || !name.pattern.MatchString(bucket)) {
+			return &URIError{URI: uri, Part: "bucket", Value: bucket, Reason: name.rule}
+		}
+		if scheme == "sftp" {
+			parsed.Endpoint, parsed.Bucket = bucket, "/"+folder
+			break
+		}
+		parsed.Bucket = bucket
+		if len(folder) != 0 {
+			parsed.Folder = folder
+		}
+	}
+
+	names := make([]string, 0, len(uriParameters))
+	for name := range uriParameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for name, values := range query {
+		set, ok := uriParameters[name]
+		if !ok {
+			return &URIError{URI: uri, Part: "parameter", Value: name, Reason: "supported parameters are: " + strings.Join(names, ", ")}
+		}
+		set(&parsed, values[len(values)-1])
+	}
+
+	parsed.URI = uri
+	parsed.appliedURI = uri
+	*b = parsed
+	return nil
+}
+
+// UnmarshalYAML lets the backend be configured either as URI or as mapping of its fields.
+func (b *Store) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var uri string
+	if err := unmarshal(&uri); err == nil {
+		return b.SetURI(uri)
+	}
+
+	type store Store
+	if err := unmarshal((*store)(b)); err != nil {
+		return err
+	}
+	return b.applyURI()
+}
+
+// UnmarshalJSON lets the backend be configured either as URI or as object of its fields.
+func (b *Store) UnmarshalJSON(data []byte) error {
+	var uri string
+	if err := json.Unmarshal(data, &uri); err == nil {
+		return b.SetURI(uri)
+	}
+
+	type store Store
+	if err := json.Unmarshal(data, (*store)(b)); err != nil {
+		return err
+	}
+	return b.applyURI()
+}
+
+// applyURI sets the fields from URI unless it was already applied, so that the fields changed after applying it are retained.
+func (b *Store) applyURI() error {
+	if len(b.URI) == 0 || b.URI == b.appliedURI {
+		return nil
+	}
+	return b.SetURI(b.URI)
+}
+
+// cloudOf maps the scheme to its builtin cloud, any other scheme is considered to be cloud itself.
+func cloudOf(scheme string) string {
+	for cloud, prefix := range bucketPrefix {
+		if strings.TrimSuffix(prefix, "://") == scheme {
+			return cloud
+		}
+	}
+	return scheme
+}
+
+func isRegistered(scheme string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	_, ok := registry[scheme]
+	return ok
+}
@@ -0,0 +1,179 @@
+package backend_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"gopkg.in/yaml.v2"
+)
+
+// testLocation holds the fields of Store which are set by the backend URI.
+type testLocation struct {
+	Cloud, Bucket, Folder, Endpoint, Region, CredentialType, CredentialPath, Profile, RoleARN string
+}
+
+func locationOf(store *backend.Store) testLocation {
+	location := testLocation{
+		Cloud: store.Cloud, Bucket: store.Bucket, Folder: store.Folder, Endpoint: store.Endpoint,
+		Region: store.Region, CredentialType: store.CredentialType, CredentialPath: store.CredentialPath,
+	}
+	if store.Credentials != nil {
+		location.Profile, location.RoleARN = store.Credentials.Profile, store.Credentials.RoleARN
+	}
+	return location
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want testLocation
+	}{
+		{"gs://unpackker/assets/demo", testLocation{Cloud: "gcp", Bucket: "unpackker", Folder: "assets/demo"}},
+		{"s3://unpackker.assets/ci", testLocation{Cloud: "aws", Bucket: "unpackker.assets", Folder: "ci"}},
+		{"azblob://unpackker-assets/ci", testLocation{Cloud: "azure", Bucket: "unpackker-assets", Folder: "ci"}},
+		{"file:///var/lib/unpackker", testLocation{Cloud: "fs", Bucket: "/var/lib/unpackker"}},
+		{"http://artifacts.example.com/repository/assets", testLocation{Cloud: "http", Bucket: "http://artifacts.example.com/repository/assets"}},
+		{"https://artifacts.example.com/repository/assets", testLocation{Cloud: "https", Bucket: "https://artifacts.example.com/repository/assets"}},
+		{"oci://registry.example.com:5000/assets", testLocation{Cloud: "oci", Bucket: "registry.example.com:5000", Folder: "assets"}},
+		{"sftp://deploy@files.example.com:2222/srv/assets", testLocation{Cloud: "sftp", Bucket: "/srv/assets", Endpoint: "deploy@files.example.com:2222"}},
+		{"mem://unpackker/assets", testLocation{Cloud: "mem", Bucket: "unpackker", Folder: "assets"}},
+		{"gs://unpackker", testLocation{Cloud: "gcp", Bucket: "unpackker"}},
+		{"gs://unpackker//assets//demo/", testLocation{Cloud: "gcp", Bucket: "unpackker", Folder: "assets/demo"}},
+		{"gs://unpackker/assets..old", testLocation{Cloud: "gcp", Bucket: "unpackker", Folder: "assets..old"}},
+		{"s3://unpackker/ci?region=eu-west-1&endpoint=http://minio:9000&credstype=assumerole&credspath=/etc/aws&profile=ci&rolearn=arn:aws:iam::1:role/ci",
+			testLocation{Cloud: "aws", Bucket: "unpackker", Folder: "ci", Endpoint: "http://minio:9000", Region: "eu-west-1",
+				CredentialType: "assumerole", CredentialPath: "/etc/aws", Profile: "ci", RoleARN: "arn:aws:iam::1:role/ci"}},
+		{"gs://unpackker?region=eu&region=us", testLocation{Cloud: "gcp", Bucket: "unpackker", Region: "us"}},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			store, err := backend.Parse(test.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := locationOf(store); got != test.want {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+			if store.URI != test.uri {
+				t.Errorf("expected URI to be retained, got %s", store.URI)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		part string
+	}{
+		{"unpackker/assets", "backend"},
+		{"://unpackker", "backend"},
+		{"ftp://unpackker/assets", "scheme"},
+		{"gs:///assets", "bucket"},
+		{"sftp://", "bucket"},
+		{"gs://Unpackker", "bucket"},
+		{"gs://up", "bucket"},
+		{"gs://-unpackker", "bucket"},
+		{"s3://unpackker_assets", "bucket"},
+		{"s3://unpackker-", "bucket"},
+		{"azblob://unpackker--assets", "bucket"},
+		{"azblob://unpackker.assets", "bucket"},
+		{"file://", "path"},
+		{"gs://unpackker/a/../b", "folder"},
+		{"s3://unpackker/..", "folder"},
+		{"sftp://files.example.com/srv/../etc", "folder"},
+		{"gs://unpackker/./assets", "folder"},
+		{"gs://unpackker?colour=red", "parameter"},
+		{"gs://unpackker?region=%zz", "query"},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			_, err := backend.Parse(test.uri)
+			var uriErr *backend.URIError
+			if !errors.As(err, &uriErr) {
+				t.Fatalf("expected URI to be rejected, got %v", err)
+			}
+			if uriErr.Part != test.part {
+				t.Errorf("expected %s of URI to be at fault, got %v", test.part, err)
+			}
+		})
+	}
+}
+
+func TestSetURIRetainsFolder(t *testing.T) {
+	store := backend.New()
+	store.Folder = "assets"
+	if err := store.SetURI("gs://unpackker"); err != nil {
+		t.Fatal(err)
+	}
+	if store.Folder != "assets" {
+		t.Errorf("folder configured was not retained by URI without one, got %q", store.Folder)
+	}
+	if err := store.SetURI("gs://unpackker/ci"); err != nil {
+		t.Fatal(err)
+	}
+	if store.Folder != "ci" {
+		t.Errorf("folder of URI was not set, got %q", store.Folder)
+	}
+}
+
+func TestUnmarshalBackend(t *testing.T) {
+	type config struct {
+		Backend backend.Store `json:"backend" yaml:"backend"`
+	}
+	unmarshalers := map[string]func(data string, config *config) error{
+		"yaml": func(data string, config *config) error { return yaml.Unmarshal([]byte(data), config) },
+		"json": func(data string, config *config) error { return json.Unmarshal([]byte(data), config) },
+	}
+	tests := []struct {
+		name string
+		yaml string
+		json string
+		want testLocation
+	}{
+		{"uri", "backend: s3://unpackker/ci?region=eu-west-1&profile=ci",
+			`{"backend": "s3://unpackker/ci?region=eu-west-1&profile=ci"}`,
+			testLocation{Cloud: "aws", Bucket: "unpackker", Folder: "ci", Region: "eu-west-1", Profile: "ci"}},
+		{"mapping of uri", "backend:\n  uri: gs://unpackker\n  folder: assets\n  credstype: file\n",
+			`{"backend": {"uri": "gs://unpackker", "folder": "assets", "credstype": "file"}}`,
+			testLocation{Cloud: "gcp", Bucket: "unpackker", Folder: "assets", CredentialType: "file"}},
+		{"mapping of fields", "backend:\n  cloud: azure\n  bucket: unpackker\n  folder: ci\n",
+			`{"backend": {"cloud": "azure", "bucket": "unpackker", "folder": "ci"}}`,
+			testLocation{Cloud: "azure", Bucket: "unpackker", Folder: "ci"}},
+	}
+	for _, test := range tests {
+		for format, unmarshal := range unmarshalers {
+			t.Run(test.name+" in "+format, func(t *testing.T) {
+				data := test.yaml
+				if format == "json" {
+					data = test.json
+				}
+				var got config
+				if err := unmarshal(data, &got); err != nil {
+					t.Fatal(err)
+				}
+				if location := locationOf(&got.Backend); location != test.want {
+					t.Errorf("expected %+v, got %+v", test.want, location)
+				}
+			})
+		}
+	}
+
+	invalid := []struct {
+		format, data string
+	}{
+		{"yaml", "backend: gs://unpackker/a/../b"},
+		{"json", `{"backend": "gs://unpackker/a/../b"}`},
+		{"yaml", "backend:\n  uri: gs://Unpackker\n"},
+		{"json", `{"backend": {"uri": "gs://Unpackker"}}`},
+	}
+	for _, test := range invalid {
+		var got config
+		var uriErr *backend.URIError
+		if err := unmarshalers[test.format](test.data, &got); !errors.As(err, &uriErr) {
+			t.Errorf("expected invalid URI of %s to be rejected, got %v", test.data, err)
+		}
+	}
+}
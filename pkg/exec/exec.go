@@ -2,6 +2,7 @@
 package unexec
 
 import (
+	"context"
 	"io"
 	"os/exec"
 )
@@ -28,6 +29,19 @@ func (e *ExecCmd) GetCmdExec() (*exec.Cmd, error) {
 	return shellCmd, nil
 }
 
+// GetCmdExecContext gets the constructed shell command like GetCmdExec, which is killed once ctx is done.
+func (e *ExecCmd) GetCmdExecContext(ctx context.Context) (*exec.Cmd, error) {
+	cmd, err := e.getExecutable()
+	if err != nil {
+		return nil, err
+	}
+	shellCmd := exec.CommandContext(ctx, cmd)
+	shellCmd.Args = e.Args
+	shellCmd.Stdout = e.Writer
+	shellCmd.Stderr = e.Writer
+	return shellCmd, nil
+}
+
 func (e *ExecCmd) getExecutable() (string, error) {
 	goExecPath, err := exec.LookPath(e.Command)
 
@@ -22,10 +22,14 @@ type GenInput struct {
 	Environment string `json:"environment" yaml:"environment"`
 	// AssetVersion refers to version of asset which has to eb packed.
 	AssetVersion string `json:"assetversion" yaml:"assetversion"`
+	// MetaData of the asset, it is embedded in the client stub along with its name, version and environment.
+	MetaData map[string]string `json:"metadata" yaml:"metadata"`
 	// TemplateRaw consists of go-templates which are required for generation of client stub.
 	TemplateRaw UnpackkerTemplate
 	// AutoGenMessage will be configured by unpackker and cannot be overwritten.
 	AutoGenMessage string
+	// EncodedInfo is the StubInfo embedded in the client stub, it will be configured by unpackker and cannot be overwritten.
+	EncodedInfo string
 	// writer         io.Writer
 	template string
 }
@@ -129,6 +133,7 @@ func registerFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVarP(&genin.assetName, "name", "n", "{{ .Package }}", "name of the asset that needs to be unpacked")
 	cmd.PersistentFlags().StringVarP(&genin.path, "path", "p", ".", "path where the asset has to be unpacked")
 	cmd.PersistentFlags().BoolVarP(&genin.silent, "silent", "s", false, "silence the output to get more speccific output")
+	cmd.PersistentFlags().StringVarP(&genin.env, "environment", "e", "", "environment to which the asset was promoted, defaults to the one under which it was packed")
 }
 func registerVersionFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().BoolVarP(&genin.silent, "silent", "s", false, "silence the output to get more speccific output")
@@ -140,9 +145,11 @@ package {{ .Package }}
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/nikhilsbhat/neuron/cli/ui"
 	"github.com/nikhilsbhat/terragen/decode"
@@ -154,6 +161,8 @@ var (
 	genin        genInput
 	assetVersion = "{{ .AssetVersion }}"
 	env          = "{{ .Environment }}"
+	// stubInfo is read by 'unpackker inspect' from this binary without running it, hence it should not be altered.
+	stubInfo = "UNPACKKER-STUB-INFO:{{ .EncodedInfo }}:UNPACKKER-STUB-INFO"
 )
 
 type confcmds struct {
@@ -199,12 +208,20 @@ func getPackkerCmd() *cobra.Command {
 		RunE:  genin.versionConfig,
 	}
 
+	var infoCmd = &cobra.Command{
+		Use:   "info",
+		Short: "Command to print the information of asset that is bundled along with this binary",
+		RunE:  genin.infoConfig,
+	}
+
 	genCmd.Hidden = true
 	versionCmd.Hidden = true
+	infoCmd.Hidden = true
 	registerFlags(genCmd)
 	registerVersionFlags(versionCmd)
 	packkerCmd.AddCommand(genCmd)
 	packkerCmd.AddCommand(versionCmd)
+	packkerCmd.AddCommand(infoCmd)
 	return packkerCmd
 }
 
@@ -225,13 +242,25 @@ func (i *genInput) versionConfig(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func (i *genInput) infoConfig(cmd *cobra.Command, args []string) error {
+	encoded := strings.TrimSuffix(strings.TrimPrefix(stubInfo, "UNPACKKER-STUB-INFO:"), ":UNPACKKER-STUB-INFO")
+	info, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(info))
+	return nil
+}
+
 func (i *genInput) generate(cmd *cobra.Command, args []string) {
 
 	if len(i.env) == 0 {
 		i.env = env
 	}
 
-	if i.env == "development" {
+	if i.env != env {
+		fmt.Println(ui.Info(fmt.Sprintf("Asset packed under %s environment was promoted to %s environment\n", env, i.env)))
+	} else if i.env == "development" {
 		fmt.Println(ui.Warn(fmt.Sprintf("==============================================================\nAsset is packed under %s environment\nPack it under production by enabling 'env' flag in unpackker\n==============================================================\n", i.env)))
 	}
 
@@ -314,6 +343,11 @@ func (i *GenInput) Generate() (string, error) {
 	i.Path = path
 	i.template = fmt.Sprintf("unpackker-client-stub-%s", i.Package)
 	i.AutoGenMessage = autoGenMessage
+	encodedInfo, err := i.encodeStubInfo()
+	if err != nil {
+		return "", err
+	}
+	i.EncodedInfo = encodedInfo
 	if i.clinetStubExists() {
 		return "", fmt.Errorf("looks like clinet stub %s was created earlier in the location %s", i.template, i.Path)
 	}
@@ -0,0 +1,134 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/version"
+)
+
+const (
+	// stubInfoBegin and stubInfoEnd enclose the StubInfo embedded in the client stub.
+	stubInfoBegin = "UNPACKKER-STUB-INFO:"
+	stubInfoEnd   = ":UNPACKKER-STUB-INFO"
+	// maxStubInfoSize is the maximum size of the encoded StubInfo, anything larger found between the markers is ignored.
+	maxStubInfoSize = 1 << 20
+	// stubScanChunk is the size of chunks in which client stub is scanned for StubInfo.
+	stubScanChunk = 4 << 20
+	// stubFlagEnvironment is the flag of generate command with which the client stub is told the environment to which asset was promoted.
+	stubFlagEnvironment = "environment"
+)
+
+// StubInfo is the information of asset embedded in its client stub while packing,
+// so that it could be read by ReadStubInfo without running the stub.
+type StubInfo struct {
+	// Name of the asset.
+	Name string `json:"name" yaml:"name"`
+	// Version of the asset.
+	Version string `json:"version" yaml:"version"`
+	// Environment under which the asset was packed.
+	Environment string `json:"environment" yaml:"environment"`
+	// MetaData of the asset.
+	MetaData map[string]string `json:"metadata" yaml:"metadata"`
+	// PackedAt is the time at which the client stub was generated.
+	PackedAt time.Time `json:"packedat" yaml:"packedat"`
+	// PackedWith is the version of unpackker which generated the client stub.
+	PackedWith string `json:"packedwith" yaml:"packedwith"`
+	// Flags are the flags of generate command accepted by the client stub apart from path, stubs generated by older versions
+	// of unpackker do not accept them.
+	Flags []string `json:"flags" yaml:"flags"`
+}
+
+// HasFlag tells whether generate command of the client stub accepts the flag.
+func (i *StubInfo) HasFlag(flag string) bool {
+	for _, accepted := range i.Flags {
+		if accepted == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeStubInfo returns the StubInfo of the asset encoded as unpadded base64url,
+// which is left as is by the templates and does not collide with the markers.
+func (i *GenInput) encodeStubInfo() (string, error) {
+	info, err := json.Marshal(&StubInfo{
+		Name:        i.Package,
+		Version:     i.AssetVersion,
+		Environment: i.Environment,
+		MetaData:    i.MetaData,
+		PackedAt:    time.Now().UTC(),
+		PackedWith:  version.GetVersion(),
+		Flags:       []string{stubFlagEnvironment},
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(info), nil
+}
+
+// ReadStubInfo reads the StubInfo embedded in the client stub, the stub is scanned for it and is never executed.
+func ReadStubInfo(stubPath string) (*StubInfo, error) {
+	stub, err := os.Open(stubPath)
+	if err != nil {
+		return nil, err
+	}
+	defer stub.Close()
+
+	var window []byte
+	chunk := make([]byte, stubScanChunk)
+	for {
+		n, err := io.ReadFull(stub, chunk)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return nil, err
+		}
+		window = append(window, chunk[:n]...)
+
+		for {
+			index := bytes.Index(window, []byte(stubInfoBegin))
+			if index == -1 {
+				// Tail is retained as the marker could be split across the chunks.
+				if keep := len(stubInfoBegin) - 1; len(window) > keep {
+					window = append([]byte(nil), window[len(window)-keep:]...)
+				}
+				break
+			}
+			window = window[index:]
+			encoded := window[len(stubInfoBegin):]
+			end := bytes.Index(encoded, []byte(stubInfoEnd))
+			if end == -1 && !eof && len(encoded) < maxStubInfoSize {
+				// Rest of the info is yet to be read.
+				break
+			}
+			if end != -1 {
+				if info, err := decodeStubInfo(encoded[:end]); err == nil {
+					return info, nil
+				}
+			}
+			window = window[1:]
+		}
+
+		if eof {
+			return nil, fmt.Errorf("unable to find asset information in %s, it is either not a client stub or was generated by older version of unpackker", stubPath)
+		}
+	}
+}
+
+func decodeStubInfo(encoded []byte) (*StubInfo, error) {
+	raw := make([]byte, base64.RawURLEncoding.DecodedLen(len(encoded)))
+	n, err := base64.RawURLEncoding.Decode(raw, encoded)
+	if err != nil {
+		return nil, err
+	}
+	info := new(StubInfo)
+	if err := json.Unmarshal(raw[:n], info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,64 @@
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestStub writes the stub under dir whose content is the parts joined, padded so that the info begins just before
+// the end of first chunk scanned and its marker is split across the chunks.
+func writeTestStub(t *testing.T, dir string, parts ...string) string {
+	t.Helper()
+	var stub bytes.Buffer
+	stub.Write(bytes.Repeat([]byte{0x7f}, stubScanChunk-len(stubInfoBegin)/2))
+	for _, part := range parts {
+		stub.WriteString(part)
+	}
+	stubPath := filepath.Join(dir, "stub")
+	if err := ioutil.WriteFile(stubPath, stub.Bytes(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return stubPath
+}
+
+func TestReadStubInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unpackker-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := &GenInput{Package: "demo", AssetVersion: "0.1.0", Environment: "production", MetaData: map[string]string{"team": "platform"}}
+	encoded, err := input.encodeStubInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Markers enclosing what is not the info, such as the template of stub itself, are skipped.
+	stubPath := writeTestStub(t, dir, stubInfoBegin, "{{ .EncodedInfo }}", stubInfoEnd, "\x00", stubInfoBegin, encoded, stubInfoEnd, "\x00\x01")
+
+	packed := time.Now().UTC()
+	info, err := ReadStubInfo(stubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "demo" || info.Version != "0.1.0" || info.Environment != "production" || !reflect.DeepEqual(info.MetaData, input.MetaData) {
+		t.Errorf("info of asset was not read back from the stub, got %+v", info)
+	}
+	if packed.Sub(info.PackedAt) > time.Minute || len(info.PackedWith) == 0 {
+		t.Errorf("time and version of unpackker with which stub was packed were not recorded, got %+v", info)
+	}
+	if !info.HasFlag(stubFlagEnvironment) || info.HasFlag("unknown") {
+		t.Errorf("flags accepted by the stub were not recorded, got %v", info.Flags)
+	}
+
+	stubPath = writeTestStub(t, dir, "stub generated by older version of unpackker")
+	if _, err := ReadStubInfo(stubPath); err == nil || !strings.Contains(err.Error(), "unable to find asset information") {
+		t.Errorf("expected stub without info to be reported, got %v", err)
+	}
+}
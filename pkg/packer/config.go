@@ -6,7 +6,10 @@ import (
 	"path/filepath"
 
 	"github.com/caarlos0/env/v6"
+	"github.com/imdario/mergo"
 	"github.com/nikhilsbhat/config/decode"
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	tdecode "github.com/nikhilsbhat/terragen/decode"
 	"github.com/nikhilsbhat/unpackker/pkg/backend"
 	"github.com/nikhilsbhat/unpackker/pkg/helper"
 	"gopkg.in/yaml.v2"
@@ -35,6 +38,57 @@ func (i *PackkerInput) LoadConfig() (*PackkerInput, error) {
 	return newConfig, nil
 }
 
+// mergeConfig loads the config from file and environment variables and merges them with the values passed through flags.
+func (i *PackkerInput) mergeConfig() (*PackkerInput, error) {
+	configFromFile, err := i.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if configFromFile != nil {
+		if err := mergo.Merge(configFromFile, i, mergo.WithOverride); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, envcfg, err := getConfigFromEnvWithValidate()
+	if err != nil {
+		fmt.Println(ui.Error(tdecode.GetStringOfMessage(err)))
+		fmt.Println(ui.Warn("Dropping env variables as we ran into problem while fetching"))
+	}
+	if envcfg {
+		fmt.Println(ui.Warn("Dropping env variables as no corresponding values set"))
+	} else {
+		if err := mergo.Merge(configFromFile, cfg, mergo.WithOverride); err != nil {
+			return nil, err
+		}
+	}
+
+	if configFromFile == nil {
+		configFromFile = i
+	}
+	if err := configFromFile.applyBackendURI(); err != nil {
+		return nil, err
+	}
+	return configFromFile, nil
+}
+
+// applyBackendURI sets the backend from URI passed either through flag, environment variable or config file, in that order.
+func (i *PackkerInput) applyBackendURI() error {
+	uri := i.BackendURI
+	if len(uri) == 0 && i.Backend != nil {
+		uri = i.Backend.URI
+	}
+	if len(uri) == 0 {
+		return nil
+	}
+
+	if i.Backend == nil {
+		i.Backend = backend.New()
+	}
+	return i.Backend.SetURI(uri)
+}
+
 func getConfigFromEnvWithValidate() (*PackkerInput, bool, error) {
 	newcfg := NewConfig()
 	envcfg, bck, err := getConfigFromEnv()
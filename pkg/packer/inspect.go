@@ -0,0 +1,161 @@
+package packer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/archive"
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/gen"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+	"github.com/spf13/cobra"
+)
+
+// inspection is what inspect reports of the asset, either from the backend or from the client stub.
+type inspection struct {
+	// Source is the backend or the path of client stub from which the asset was inspected.
+	Source      string            `json:"source"`
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Environment string            `json:"environment"`
+	Size        int64             `json:"size"`
+	Checksum    string            `json:"checksum"`
+	Uploaded    *time.Time        `json:"uploaded,omitempty"`
+	Packed      *time.Time        `json:"packed,omitempty"`
+	PackedWith  string            `json:"packedwith,omitempty"`
+	MetaData    map[string]string `json:"metadata"`
+}
+
+// Inspect shows the metadata, size, checksum, upload time, environment and version of the asset stored in the backend.
+// When InspectStub is set, the information embedded in the client stub is shown instead, without running it.
+func (i *PackkerInput) Inspect(cmd *cobra.Command, args []string) error {
+	if len(i.InspectStub) != 0 {
+		result, err := inspectStub(i.InspectStub)
+		if err != nil {
+			return err
+		}
+		return printInspection(os.Stdout, result, i.Output)
+	}
+
+	configFromFile, err := i.mergeConfig()
+	if err != nil {
+		return err
+	}
+	if len(configFromFile.AssetVersion) == 0 {
+		return fmt.Errorf("version of the asset to be inspected has to be set with 'version'")
+	}
+
+	source := configFromFile.Backend.String()
+	if err := configFromFile.initVersionBackend(); err != nil {
+		return err
+	}
+	defer configFromFile.Backend.Close()
+	object, err := configFromFile.Backend.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to find version %s of asset %s in %s: %w", configFromFile.AssetVersion, configFromFile.Name, source, err)
+	}
+
+	return printInspection(os.Stdout, &inspection{
+		Source:      source,
+		Name:        path.Base(object.Key),
+		Version:     object.MetaData[backend.MetaDataVersion],
+		Environment: object.MetaData[backend.MetaDataEnvironment],
+		Size:        object.Size,
+		Checksum:    object.MetaData[backend.MetaDataChecksum],
+		Uploaded:    &object.Modified,
+		MetaData:    object.MetaData,
+	}, configFromFile.Output)
+}
+
+// inspectStub reads the information embedded in the client stub while packing, the stub is never executed.
+// Asset packed as archive is inspected from the header of the archive.
+func inspectStub(stubPath string) (*inspection, error) {
+	stubPath, err := filepath.Abs(stubPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readStubInfo(stubPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stub, err := helper.OpenFile(stubPath)
+	if err != nil {
+		return nil, err
+	}
+	defer stub.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inspection{
+		Source:      stubPath,
+		Name:        info.Name,
+		Version:     info.Version,
+		Environment: info.Environment,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		Packed:      &info.PackedAt,
+		PackedWith:  info.PackedWith,
+		MetaData:    info.MetaData,
+	}, nil
+}
+
+// readStubInfo reads the information of asset either from the client stub or from the header of archive.
+func readStubInfo(stubPath string) (*gen.StubInfo, error) {
+	if !archive.IsArchive(stubPath) {
+		return gen.ReadStubInfo(stubPath)
+	}
+	header, err := archive.ReadHeader(stubPath)
+	if err != nil {
+		return nil, err
+	}
+	return &gen.StubInfo{
+		Name:        header.Name,
+		Version:     header.Version,
+		Environment: header.Environment,
+		MetaData:    header.MetaData,
+		PackedAt:    header.PackedAt,
+		PackedWith:  header.PackedWith,
+	}, nil
+}
+
+// printInspection writes the inspected asset in the specified format, supported formats are table and json.
+func printInspection(w io.Writer, result *inspection, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "table", "":
+		table := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(table, "SOURCE\t%s\n", result.Source)
+		fmt.Fprintf(table, "NAME\t%s\n", valueOrDash(result.Name))
+		fmt.Fprintf(table, "VERSION\t%s\n", valueOrDash(result.Version))
+		fmt.Fprintf(table, "ENVIRONMENT\t%s\n", valueOrDash(result.Environment))
+		fmt.Fprintf(table, "SIZE\t%s\n", humanSize(result.Size))
+		fmt.Fprintf(table, "CHECKSUM\t%s\n", valueOrDash(result.Checksum))
+		if result.Uploaded != nil {
+			fmt.Fprintf(table, "UPLOADED\t%s\n", result.Uploaded.Local().Format(time.RFC3339))
+		}
+		if result.Packed != nil {
+			fmt.Fprintf(table, "PACKED\t%s\n", result.Packed.Local().Format(time.RFC3339))
+		}
+		if len(result.PackedWith) != 0 {
+			fmt.Fprintf(table, "PACKED WITH\tunpackker %s\n", result.PackedWith)
+		}
+		fmt.Fprintf(table, "METADATA\t%s\n", formatMetaData(result.MetaData))
+		return table.Flush()
+	}
+	return fmt.Errorf("output format %s is not supported, supported formats are: table, json", format)
+}
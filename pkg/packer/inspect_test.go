@@ -0,0 +1,106 @@
+package packer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/archive"
+	"github.com/nikhilsbhat/unpackker/pkg/gen"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+func TestInspectStub(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	packed := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	meta := map[string]string{"team": "platform"}
+
+	encoded, err := json.Marshal(&gen.StubInfo{Name: "demo", Version: "0.1.0", Environment: "production", MetaData: meta, PackedAt: packed, PackedWith: "v0.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubPath := filepath.Join(dir, "demo_0_1_0")
+	stub := "\x7fELF" + "UNPACKKER-STUB-INFO:" + base64.RawURLEncoding.EncodeToString(encoded) + ":UNPACKKER-STUB-INFO" + "\x00"
+	if err := ioutil.WriteFile(stubPath, []byte(stub), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	assetPath := filepath.Join(dir, "asset")
+	if err := os.MkdirAll(assetPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(assetPath, "app.yaml"), []byte("port: 8080"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(dir, "demo_0_2_0.unpackker")
+	header := &archive.Header{Name: "demo", Version: "0.2.0", Environment: "development", MetaData: meta}
+	if err := archive.Create(context.Background(), archivePath, assetPath, nil, header); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		path        string
+		version     string
+		environment string
+	}{
+		{"client stub", stubPath, "0.1.0", "production"},
+		{"archive", archivePath, "0.2.0", "development"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := inspectStub(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checksum, _ := helper.FileChecksum(test.path)
+			info, _ := os.Stat(test.path)
+			if result.Source != test.path || result.Name != "demo" || result.Version != test.version || result.Environment != test.environment ||
+				result.Checksum != checksum || result.Size != info.Size() || result.MetaData["team"] != "platform" || result.Packed == nil {
+				t.Errorf("asset was not inspected from %s, got %+v", test.name, result)
+			}
+		})
+	}
+
+	result, err := inspectStub(stubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var table bytes.Buffer
+	if err := printInspection(&table, result, "table"); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{`SOURCE\s+` + regexp.QuoteMeta(stubPath), `VERSION\s+0\.1\.0`, `ENVIRONMENT\s+production`, `CHECKSUM\s+` + result.Checksum,
+		`PACKED\s+\S+`, `PACKED WITH\s+unpackker v0\.1\.0`, `METADATA\s+team=platform`} {
+		if !regexp.MustCompile(`(?m)^` + row + `$`).MatchString(table.String()) {
+			t.Errorf("expected table to have row %s, got %q", row, table.String())
+		}
+	}
+	if strings.Contains(table.String(), "UPLOADED") {
+		t.Errorf("client stub which was not uploaded was reported with upload time")
+	}
+
+	var encodedResult bytes.Buffer
+	if err := printInspection(&encodedResult, result, "json"); err != nil {
+		t.Fatal(err)
+	}
+	decoded := make(map[string]interface{})
+	if err := json.Unmarshal(encodedResult.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["version"] != "0.1.0" || decoded["checksum"] != result.Checksum || decoded["packedwith"] != "v0.1.0" || decoded["uploaded"] != nil {
+		t.Errorf("json output does not hold the asset inspected, got %s", encodedResult.String())
+	}
+
+	if _, err := inspectStub(filepath.Join(assetPath, "app.yaml")); err == nil {
+		t.Errorf("expected file which is neither client stub nor archive to be rejected")
+	}
+}
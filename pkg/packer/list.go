@@ -0,0 +1,102 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/spf13/cobra"
+)
+
+// List lists all versions of the asset stored in the configured backend either as table or json.
+func (i *PackkerInput) List(cmd *cobra.Command, args []string) error {
+	configFromFile, err := i.mergeConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := configFromFile.initListBackend(); err != nil {
+		return err
+	}
+	defer configFromFile.Backend.Close()
+
+	objects, err := configFromFile.Backend.List()
+	if err != nil {
+		return err
+	}
+	return printObjects(os.Stdout, objects, configFromFile.Output)
+}
+
+// initListBackend initializes the backend to look up the assets stored under Folder/Name.
+func (i *PackkerInput) initListBackend() error {
+	i.generateDefaults()
+	if len(i.Backend.Name) == 0 {
+		i.Backend.Name = i.Name
+	}
+	return i.Backend.InitBackend()
+}
+
+// printObjects writes the objects in the specified format, supported formats are table and json.
+func printObjects(w io.Writer, objects []*backend.Object, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(objects)
+	case "table", "":
+		table := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(table, "NAME\tVERSION\tENVIRONMENT\tSIZE\tUPLOADED\tMETADATA")
+		for _, object := range objects {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				path.Base(object.Key),
+				valueOrDash(object.MetaData[backend.MetaDataVersion]),
+				valueOrDash(object.MetaData[backend.MetaDataEnvironment]),
+				humanSize(object.Size),
+				object.Modified.Local().Format(time.RFC3339),
+				formatMetaData(object.MetaData),
+			)
+		}
+		return table.Flush()
+	}
+	return fmt.Errorf("output format %s is not supported, supported formats are: table, json", format)
+}
+
+// formatMetaData returns the user defined metadata of the asset as comma separated key=value pairs, checksum is left to json output.
+func formatMetaData(meta map[string]string) string {
+	pairs := make([]string, 0, len(meta))
+	for key, value := range meta {
+		if key == backend.MetaDataVersion || key == backend.MetaDataEnvironment || key == backend.MetaDataChecksum {
+			continue
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return valueOrDash(strings.Join(pairs, ","))
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func valueOrDash(value string) string {
+	if len(value) == 0 {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,75 @@
+package packer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+)
+
+func TestListPrintsVersions(t *testing.T) {
+	defer backendtest.ClearMem(t, "list")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	storeTestVersion(t, dir, "mem://list/assets/demo", "demo_0_1_0", bytes.Repeat([]byte("a"), 512), map[string]string{
+		backend.MetaDataVersion: "0.1.0", backend.MetaDataEnvironment: "development", "team": "platform", "commit": "a1b2c3",
+	})
+	storeTestVersion(t, dir, "mem://list/assets/demo", "demo_0_2_0", bytes.Repeat([]byte("b"), 3<<10), nil)
+
+	store, err := backend.Parse("mem://list/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := &PackkerInput{Name: "demo", Backend: store}
+	if err := input.initListBackend(); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := input.Backend.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var table bytes.Buffer
+	if err := printObjects(&table, objects, "table"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header along with a row per version, got %q", table.String())
+	}
+	rows := []*regexp.Regexp{
+		regexp.MustCompile(`^NAME\s+VERSION\s+ENVIRONMENT\s+SIZE\s+UPLOADED\s+METADATA$`),
+		regexp.MustCompile(`^demo_0_1_0\s+0\.1\.0\s+development\s+512B\s+\S+\s+commit=a1b2c3,team=platform$`),
+		regexp.MustCompile(`^demo_0_2_0\s+-\s+-\s+3\.0KiB\s+\S+\s+-$`),
+	}
+	for index, row := range rows {
+		if !row.MatchString(lines[index]) {
+			t.Errorf("expected row %d of table to match %s, got %q", index, row, lines[index])
+		}
+	}
+	if strings.Contains(table.String(), objects[0].MetaData[backend.MetaDataChecksum]) {
+		t.Errorf("checksum is expected only in json output, got %q", table.String())
+	}
+
+	var encoded bytes.Buffer
+	if err := printObjects(&encoded, objects, "json"); err != nil {
+		t.Fatal(err)
+	}
+	decoded := make([]*backend.Object, 0)
+	if err := json.Unmarshal(encoded.Bytes(), &decoded); err != nil {
+		t.Fatalf("json output could not be decoded: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0].Key != "assets/demo/demo_0_1_0" || decoded[1].Size != 3<<10 ||
+		decoded[0].MetaData["team"] != "platform" || len(decoded[0].MetaData[backend.MetaDataChecksum]) == 0 {
+		t.Errorf("json output does not hold the versions listed, got %s", encoded.String())
+	}
+
+	if err := printObjects(&bytes.Buffer{}, objects, "yaml"); err == nil || !strings.Contains(err.Error(), "table, json") {
+		t.Errorf("expected unsupported format to be rejected naming the supported ones, got %v", err)
+	}
+}
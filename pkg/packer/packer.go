@@ -2,6 +2,8 @@
 package packer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,17 +11,26 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-bindata/go-bindata/v3"
-	"github.com/imdario/mergo"
 	"github.com/nikhilsbhat/neuron/cli/ui"
 	"github.com/nikhilsbhat/terragen/decode"
+	"github.com/nikhilsbhat/unpackker/pkg/archive"
 	"github.com/nikhilsbhat/unpackker/pkg/backend"
 	gen "github.com/nikhilsbhat/unpackker/pkg/gen"
 	"github.com/nikhilsbhat/unpackker/pkg/helper"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// formatStub packs the asset as client stub built with go toolchain.
+	formatStub = "stub"
+	// formatArchive packs the asset as unpackker archive.
+	formatArchive = "archive"
+)
+
 //PackkerInput holds the required fields to pack the asset.
 type PackkerInput struct {
 	// The name of the asset client stub.
@@ -33,6 +44,10 @@ type PackkerInput struct {
 	AssetMetaData map[string]string `json:"assetmetadata" yaml:"assetmetadata"`
 	// Path defines where the packed asset has to be placed.
 	Path string `json:"path" yaml:"path"`
+	// Format in which the asset is packed, either stub or archive, defaults to stub.
+	// Stub is the client stub built with go toolchain, which unpacks the asset when run by unpacker.
+	// Archive is the unpackker archive written without go toolchain, which is unpacked by unpacker itself, see package archive.
+	Format string `json:"format" yaml:"format" env:"UNPACKKER_FORMAT"`
 	// IgnoreFiles are regexes of the files that should be avided.
 	IgnoreFiles []string `json:"ignore" yaml:"ignore"`
 	// Environment in which the asset is packed.
@@ -41,11 +56,37 @@ type PackkerInput struct {
 	AssetVersion string `json:"assetversion" yaml:"assetversion" env:"UNPACKKER_ASSET_VERSION"`
 	// Backend for the asset generated.
 	Backend *backend.Store `json:"backend" yaml:"backend"`
+	// Backends are the additional backends to which the same asset is stored along with Backend, concurrently.
+	// Asset is stored from the path of Backend, path of these is not considered.
+	Backends []*backend.Store `json:"backends" yaml:"backends"`
+	// BackendURI is the URI of backend such as gs://bucket/folder, it overrides cloud, bucket and folder of Backend.
+	BackendURI string `json:"-" yaml:"-"`
 	// ConfigPath refers to file path where the config file lies, defaults to PWD.
 	ConfigPath string `json:"configpath" yaml:"configpath" env:"UNPACKKER_CONFIG_PATH"`
 	// CleanLocalCache clears the local cache creted under PackkerInput.Path if enabled,
 	// this will be effective only if backend is type 'fs'.
 	CleanLocalCache bool `json:"cleancache" yaml:"cleancache" env:"UNPACKKER_CLEAN_LOCALCACHE"`
+	// Output is the format in which the assets are listed, either table or json.
+	Output string `json:"output" yaml:"output"`
+	// Retention holds the policies based on which stored versions of the asset are pruned.
+	Retention *backend.Retention `json:"retention" yaml:"retention"`
+	// DryRun lists the versions which would be pruned without deleting them.
+	DryRun bool `json:"dryrun" yaml:"dryrun"`
+	// PromoteTo is the environment to which the asset has to be promoted.
+	PromoteTo string `json:"promoteto" yaml:"promoteto"`
+	// FromEnvironment is the environment namespace in which the asset is looked up by promote, inspect, tag and share,
+	// defaults to the one under which it was packed.
+	FromEnvironment string `json:"fromenvironment" yaml:"fromenvironment"`
+	// PromotedBy is recorded in the metadata of promoted asset and in the tags moved, defaults to UNPACKKER_PROMOTED_BY or the current user.
+	PromotedBy string `json:"promotedby" yaml:"promotedby" env:"UNPACKKER_PROMOTED_BY"`
+	// Tags are moved to the version of asset once it is stored, defaults to latest. Set it to empty list to not tag the asset.
+	Tags []string `json:"tags" yaml:"tags"`
+	// TagDelete deletes the tags passed to tag command instead of moving them.
+	TagDelete bool `json:"-" yaml:"-"`
+	// ShareExpiryHours is the number of hours for which the signed URL printed by share is valid, defaults to 1 and could be at most 168.
+	ShareExpiryHours int `json:"shareexpiryhours" yaml:"shareexpiryhours"`
+	// InspectStub is the path of client stub which is inspected in place of the asset stored in backend.
+	InspectStub string `json:"-" yaml:"-"`
 	// targetPath refers to path where the packed asset has to be placed.
 	targetPath     string
 	filesToIgnore  []*regexp.Regexp
@@ -61,93 +102,116 @@ func NewConfig() *PackkerInput {
 
 // Packer packs the asset which would be understood by unpacker
 func (i *PackkerInput) Packer(cmd *cobra.Command, args []string) {
-	configFromFile, err := i.LoadConfig()
+	configFromFile, err := i.mergeConfig()
 	if err != nil {
 		fmt.Println(ui.Error(decode.GetStringOfMessage(err) + "\n"))
 		os.Exit(1)
 	}
 
-	if configFromFile != nil {
-		if err := mergo.Merge(configFromFile, i, mergo.WithOverride); err != nil {
-			fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-			os.Exit(1)
+	if err := configFromFile.pack(context.Background()); err != nil {
+		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
+		configFromFile.cleanMess()
+		os.Exit(1)
+	}
+
+	configFromFile.cleanMess()
+}
+
+// PackWithContext packs the asset and stores it onto the backends like Packer, for the programs embedding packer.
+// PackkerInput is used as it is set, without reading the config file and environment variables, and the errors are returned instead of exiting.
+// Go toolchain building the asset is killed and storing the asset is abandoned once ctx is done. Traces left under TempPath
+// by the failed or cancelled packing are cleared irrespective of CleanLocalCache, along with the asset which was partially built.
+func (i *PackkerInput) PackWithContext(ctx context.Context) error {
+	if err := i.applyBackendURI(); err != nil {
+		return err
+	}
+	if err := i.pack(ctx); err != nil {
+		if len(i.TempPath) != 0 {
+			os.RemoveAll(i.TempPath)
 		}
+		return err
+	}
+	if !i.CleanLocalCache {
+		return nil
+	}
+	if err := os.RemoveAll(i.TempPath); err != nil {
+		return err
 	}
+	return i.cleanCache()
+}
 
-	cfg, envcfg, err := getConfigFromEnvWithValidate()
-	if err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		fmt.Println(ui.Warn("Dropping env variables as we ran into problem while fetching"))
+func (i *PackkerInput) pack(ctx context.Context) error {
+	defer i.closeBackends()
+	if err := i.validate(ctx); err != nil {
+		return err
 	}
-	if envcfg {
-		fmt.Println(ui.Warn("Dropping env variables as no corresponding values set"))
-	} else {
-		if err := mergo.Merge(configFromFile, cfg, mergo.WithOverride); err != nil {
-			fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-			os.Exit(1)
+
+	if i.Format == formatArchive {
+		if err := i.packArchive(ctx); err != nil {
+			os.Remove(i.Backend.Path)
+			return err
 		}
+	} else if err := i.packStub(ctx); err != nil {
+		return err
 	}
 
-	if configFromFile == nil {
-		configFromFile = i
+	fmt.Println(ui.Warn(i.nameForTemp()), ui.Info(" was packed successfully\n"))
+
+	fmt.Println(ui.Info("Storing packed asset onto the specified backend\n"))
+	if err := i.storeAsset(ctx); err != nil {
+		return err
 	}
+	fmt.Println(ui.Info("Asset was stored successfully, it should be available in the backed configured\n"))
+	return nil
+}
 
-	if err := configFromFile.validate(); err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		configFromFile.cleanMess()
-		os.Exit(1)
+// packArchive writes the asset as unpackker archive, which is packed without go toolchain and is unpacked by unpacker itself.
+func (i *PackkerInput) packArchive(ctx context.Context) error {
+	fmt.Println(ui.Info("Unpackker is in the process of packing asset as archive\n"))
+	header := &archive.Header{
+		Name:        i.Name,
+		Version:     i.AssetVersion,
+		Environment: i.Environment,
+		MetaData:    i.AssetMetaData,
 	}
+	return archive.Create(ctx, i.Backend.Path, i.AssetPath, i.filesToIgnore, header)
+}
 
+// packStub builds the client stub embedding the asset with go toolchain.
+func (i *PackkerInput) packStub(ctx context.Context) error {
 	genin := new(gen.GenInput)
-	genin.Package = configFromFile.Name
-	genin.Path = configFromFile.TempPath
-	genin.Environment = configFromFile.Environment
-	genin.AssetVersion = configFromFile.AssetVersion
+	genin.Package = i.Name
+	genin.Path = i.TempPath
+	genin.Environment = i.Environment
+	genin.AssetVersion = i.AssetVersion
+	genin.MetaData = i.AssetMetaData
 
 	clientStub, err := genin.Generate()
 	if err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		configFromFile.cleanMess()
-		os.Exit(1)
+		return err
 	}
 
-	configFromFile.clinetStubPath = filepath.Join(configFromFile.TempPath, clientStub)
-	if err := configFromFile.buildAsset(); err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		configFromFile.cleanMess()
-		os.Exit(1)
+	i.clinetStubPath = filepath.Join(i.TempPath, clientStub)
+	if err := i.buildAsset(); err != nil {
+		return err
 	}
 
 	// Setup clientstub to make it ready for packaging
 	fmt.Println(ui.Info("Unpackker is in the process of packing asset\n"))
-	if err := configFromFile.setupAssetDir(); err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		configFromFile.cleanMess()
-		os.Exit(1)
+	if err := i.setupAssetDir(ctx); err != nil {
+		return err
 	}
 
 	fmt.Println(ui.Info("Prerequisites for Asset packing is completed successfully\n"))
 
-	if err := configFromFile.packAsset(); err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		configFromFile.cleanMess()
-		os.Exit(1)
-	}
-
-	fmt.Println(ui.Warn(configFromFile.nameForTemp()), ui.Info(" was packed successfully\n"))
-
-	fmt.Println(ui.Info("Storing packed asset onto the specified backend\n"))
-	if err := configFromFile.storeAsset(); err != nil {
-		fmt.Println(ui.Error(decode.GetStringOfMessage(err)))
-		configFromFile.cleanMess()
-		os.Exit(1)
+	if err := i.packAsset(ctx); err != nil {
+		os.Remove(i.Backend.Path)
+		return err
 	}
-	fmt.Println(ui.Info("Asset was stored successfully, it should be available in the backed configured\n"))
-
-	configFromFile.cleanMess()
+	return nil
 }
 
-func (i *PackkerInput) validate() error {
+func (i *PackkerInput) validate(ctx context.Context) error {
 	i.generateDefaults()
 	i.Path = i.getPath()
 	i.TempPath = i.getTempPath() + "_temp"
@@ -156,6 +220,10 @@ func (i *PackkerInput) validate() error {
 		return err
 	}
 
+	if i.Format != formatStub && i.Format != formatArchive {
+		return fmt.Errorf("format %s is not supported, supported formats are: %s, %s", i.Format, formatStub, formatArchive)
+	}
+
 	if i.tempPathExists() {
 		return fmt.Errorf("looks like Unpackker was exited abruptly which left behind few traces at %s\nIt will be cleared now", i.TempPath)
 	}
@@ -174,7 +242,7 @@ func (i *PackkerInput) validate() error {
 	}
 	i.targetPath = targetPath
 
-	if err := i.initBackend(); err != nil {
+	if err := i.initBackend(ctx); err != nil {
 		return err
 	}
 
@@ -187,6 +255,10 @@ func (i *PackkerInput) getFilesToIgnore() error {
 		i.IgnoreFiles = append(i.IgnoreFiles, helper.SplitBasePath(i.Path), helper.SplitBasePath(i.TempPath))
 		fmt.Println(ui.Info(fmt.Sprintf("Files that would be exempted are: %v \n", i.IgnoreFiles)))
 		for _, pattern := range i.IgnoreFiles {
+			// Empty pattern would match every file, it is left by the paths which are not set such as ConfigPath.
+			if len(pattern) == 0 {
+				continue
+			}
 			patterns = append(patterns, regexp.MustCompile(pattern))
 		}
 		i.filesToIgnore = patterns
@@ -195,34 +267,135 @@ func (i *PackkerInput) getFilesToIgnore() error {
 	return fmt.Errorf("nothing to ignore, or defaults are not set right")
 }
 
-func (i *PackkerInput) initBackend() error {
-	if err := i.Backend.InitBackend(); err != nil {
-		return err
-	}
+func (i *PackkerInput) initBackend(ctx context.Context) error {
 	if i.Backend == nil {
 		i.Backend = backend.New()
 	}
-	if len(i.Backend.Path) == 0 {
-		i.Backend.Path = i.targetPath
+	for _, store := range i.stores() {
+		if err := store.InitBackendWithContext(ctx); err != nil {
+			return fmt.Errorf("unable to initialize backend %s: %v", store, err)
+		}
+		// Asset is built only at the path of Backend, the additional backends store the same file.
+		switch {
+		case store != i.Backend:
+			store.Path = i.Backend.Path
+		case len(store.Path) == 0:
+			store.Path = i.targetPath
+		}
+		if len(store.Name) == 0 {
+			store.Name = i.Name
+		}
+		if len(store.MetaData) == 0 {
+			store.MetaData = i.AssetMetaData
+		}
+	}
+	return nil
+}
+
+// closeBackends releases the connections held by the backends once the asset is stored to them.
+func (i *PackkerInput) closeBackends() {
+	for _, store := range i.stores() {
+		store.Close()
+	}
+}
+
+// stores returns Backend along with the additional Backends to which the asset is stored.
+func (i *PackkerInput) stores() []*backend.Store {
+	stores := make([]*backend.Store, 0, len(i.Backends)+1)
+	if i.Backend != nil {
+		stores = append(stores, i.Backend)
 	}
-	if len(i.Backend.Name) == 0 {
-		i.Backend.Name = i.Name
+	for _, store := range i.Backends {
+		if store != nil {
+			stores = append(stores, store)
+		}
 	}
-	if len(i.Backend.MetaData) == 0 {
-		i.Backend.MetaData = i.AssetMetaData
+	return stores
+}
+
+// storeAsset stores the asset to all the backends concurrently and reports the result of each of them.
+func (i *PackkerInput) storeAsset(ctx context.Context) error {
+	stores := i.stores()
+	names := make([]string, len(stores))
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for index, store := range stores {
+		name := store.String()
+		names[index] = name
+		store.Folder = filepath.ToSlash(filepath.Join(store.Folder, store.Name))
+		store.Name = i.nameForTemp()
+		store.MetaData = i.getMetaData(store.MetaData)
+		if store.OnProgress == nil {
+			store.OnProgress = progressPrinter(name, len(stores) > 1)
+		}
+
+		wg.Add(1)
+		go func(index int, store *backend.Store) {
+			defer wg.Done()
+			if errs[index] = store.StoreAssetWithContext(ctx); errs[index] == nil {
+				errs[index] = i.tagAsset(ctx, store)
+			}
+		}(index, store)
+	}
+	wg.Wait()
+
+	if len(stores) == 1 {
+		return errs[0]
+	}
+	failed := 0
+	for index, name := range names {
+		if errs[index] != nil {
+			failed++
+			fmt.Println(ui.Error(fmt.Sprintf("Storing asset to %s failed: %v\n", name, errs[index])))
+			continue
+		}
+		fmt.Println(ui.Info(fmt.Sprintf("Asset was stored to %s\n", name)))
+	}
+	if failed != 0 {
+		return fmt.Errorf("asset could not be stored to %d of %d backends", failed, len(stores))
 	}
 	return nil
 }
 
-func (i *PackkerInput) storeAsset() error {
-	i.Backend.Folder = filepath.ToSlash(filepath.Join(i.Backend.Folder, i.Backend.Name))
-	i.Backend.Name = i.nameForTemp()
-	if err := i.Backend.StoreAsset(); err != nil {
-		return err
+// tagAsset moves the tags to the asset just stored, backends which do not hold the asset like fs without root directory are not tagged.
+func (i *PackkerInput) tagAsset(ctx context.Context, store *backend.Store) error {
+	for _, name := range i.Tags {
+		if _, err := store.SetTagWithContext(ctx, name, i.promotedBy()); err != nil {
+			if errors.Is(err, backend.ErrNotFound) {
+				fmt.Println(ui.Warn(fmt.Sprintf("Asset was not tagged as %s does not hold it\n", store)))
+				return nil
+			}
+			return err
+		}
 	}
 	return nil
 }
 
+// progressPrinter returns the callback which prints the progress of the asset being stored to the backend,
+// the backend is named in the progress when asset is stored to more than one backend.
+func progressPrinter(name string, named bool) func(backend.Progress) {
+	prefix := ""
+	if named {
+		prefix = name + ": "
+	}
+	return func(progress backend.Progress) {
+		fmt.Println(ui.Info(fmt.Sprintf("%sStored %s of %s at %s/s, ETA %s\n", prefix,
+			humanSize(progress.Transferred), humanSize(progress.Total), humanSize(int64(progress.Rate)), progress.ETA.Round(time.Second))))
+	}
+}
+
+// getMetaData returns the metadata of asset along with the version and environment under which it was packed.
+func (i *PackkerInput) getMetaData(metadata map[string]string) map[string]string {
+	meta := map[string]string{
+		backend.MetaDataVersion:     i.AssetVersion,
+		backend.MetaDataEnvironment: i.Environment,
+	}
+	for key, value := range metadata {
+		meta[key] = value
+	}
+	return meta
+}
+
 func (i *PackkerInput) generateDefaults() {
 	if len(i.Path) == 0 {
 		i.Path = "."
@@ -239,6 +412,12 @@ func (i *PackkerInput) generateDefaults() {
 	if len(i.AssetVersion) == 0 {
 		i.AssetVersion = "1.0"
 	}
+	if len(i.Format) == 0 {
+		i.Format = formatStub
+	}
+	if i.Tags == nil {
+		i.Tags = []string{"latest"}
+	}
 	if i.Backend == nil {
 		newbackend := backend.New()
 		newbackend.Cloud = "fs"
@@ -248,14 +427,14 @@ func (i *PackkerInput) generateDefaults() {
 	i.IgnoreFiles = append(i.IgnoreFiles, helper.SplitBasePath(i.ConfigPath))
 }
 
-func (i *PackkerInput) setupAssetDir() error {
-	goInit := exec.Command("go", "mod", "init", i.Name)
+func (i *PackkerInput) setupAssetDir(ctx context.Context) error {
+	goInit := exec.CommandContext(ctx, "go", "mod", "init", i.Name)
 	goInit.Dir = i.clinetStubPath
 	if err := goInit.Run(); err != nil {
 		return err
 	}
 
-	goVnd := exec.Command("go", "mod", "vendor")
+	goVnd := exec.CommandContext(ctx, "go", "mod", "vendor")
 	goVnd.Dir = i.clinetStubPath
 	if err := goVnd.Run(); err != nil {
 		return err
@@ -263,8 +442,8 @@ func (i *PackkerInput) setupAssetDir() error {
 	return nil
 }
 
-func (i *PackkerInput) packAsset() error {
-	goBuild := exec.Command("go", "build", "-o", i.Backend.Path, "-ldflags", "-s -w")
+func (i *PackkerInput) packAsset(ctx context.Context) error {
+	goBuild := exec.CommandContext(ctx, "go", "build", "-o", i.Backend.Path, "-ldflags", "-s -w")
 	goBuild.Dir = i.clinetStubPath
 
 	if err := goBuild.Run(); err != nil {
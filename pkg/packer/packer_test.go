@@ -0,0 +1,158 @@
+package packer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "unpackker-packer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// storeTestVersion stores the content as the version name of asset under the backend URI, along with its metadata.
+func storeTestVersion(t *testing.T, dir, uri, name string, content []byte, meta map[string]string) *backend.Store {
+	t.Helper()
+	assetPath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(assetPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := backend.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Name, store.Path, store.MetaData = name, assetPath, meta
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// newTestPackker returns the input packing the files under dir/asset as archive of version 0.1.0 of asset demo,
+// which is stored to the first backend URI and to the rest of them as additional backends.
+func newTestPackker(t *testing.T, dir string, uris ...string) *PackkerInput {
+	t.Helper()
+	assetPath := filepath.Join(dir, "asset")
+	if err := os.MkdirAll(filepath.Join(assetPath, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(assetPath, "config", "app.yaml"), []byte("port: 8080"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := &PackkerInput{
+		Name:         "demo",
+		AssetVersion: "0.1.0",
+		AssetPath:    assetPath,
+		Path:         filepath.Join(dir, "packed"),
+		Format:       formatArchive,
+		BackendURI:   uris[0],
+	}
+	for _, uri := range uris[1:] {
+		store, err := backend.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input.Backends = append(input.Backends, store)
+	}
+	return input
+}
+
+// statTestVersion returns the version 0.1.0 of asset demo stored under the backend URI, resolved through the tag.
+func statTestVersion(t *testing.T, uri, tag string) (*backend.Object, error) {
+	t.Helper()
+	store, err := backend.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Resolve(tag); err != nil {
+		return nil, err
+	}
+	return store.Stat()
+}
+
+func TestPackStoresToEveryBackend(t *testing.T) {
+	defer backendtest.ClearMem(t, "pack-primary")
+	defer backendtest.ClearMem(t, "pack-replica")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	input := newTestPackker(t, dir, "mem://pack-primary/assets", "mem://pack-replica/assets")
+	if err := input.PackWithContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := helper.FileChecksum(filepath.Join(dir, "packed", "demo_0_1_0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range []string{"mem://pack-primary/assets/demo", "mem://pack-replica/assets/demo"} {
+		object, err := statTestVersion(t, uri, "latest")
+		if err != nil {
+			t.Errorf("asset was not stored and tagged in %s: %v", uri, err)
+			continue
+		}
+		if object.Key != "assets/demo/demo_0_1_0" || object.MetaData[backend.MetaDataVersion] != "0.1.0" ||
+			object.MetaData[backend.MetaDataEnvironment] != "development" || object.MetaData[backend.MetaDataChecksum] != checksum {
+			t.Errorf("asset stored in %s does not have the metadata of version packed, got %s %v", uri, object.Key, object.MetaData)
+		}
+	}
+}
+
+func TestPackReportsBackendsFailingToStore(t *testing.T) {
+	defer backendtest.ClearMem(t, "pack-primary")
+	defer backendtest.ClearMem(t, "pack-replica")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	// Replica already holds the version, storing it again is rejected by that backend only.
+	storeTestVersion(t, dir, "mem://pack-replica/assets/demo", "demo_0_1_0", []byte("stored earlier"), nil)
+
+	input := newTestPackker(t, dir, "mem://pack-primary/assets", "mem://pack-replica/assets")
+	err := input.PackWithContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 backends") {
+		t.Fatalf("expected the backend which failed to store the asset to be reported, got %v", err)
+	}
+	if _, err := statTestVersion(t, "mem://pack-primary/assets/demo", "latest"); err != nil {
+		t.Errorf("asset was not stored to the backend which did not fail: %v", err)
+	}
+	if _, err := statTestVersion(t, "mem://pack-replica/assets/demo", "latest"); err == nil {
+		t.Errorf("backend which failed to store the asset was tagged")
+	}
+}
+
+func TestPackStopsOnCancel(t *testing.T) {
+	defer backendtest.ClearMem(t, "pack-primary")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	input := newTestPackker(t, dir, "mem://pack-primary/assets")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := input.PackWithContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected packing to be abandoned, got %v", err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "packed", "*")); len(entries) != 0 {
+		t.Errorf("traces of packing abandoned were left behind: %v", entries)
+	}
+	if _, err := statTestVersion(t, "mem://pack-primary/assets/demo", "latest"); err == nil {
+		t.Errorf("asset of packing abandoned was stored")
+	}
+}
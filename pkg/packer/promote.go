@@ -0,0 +1,66 @@
+package packer
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/spf13/cobra"
+)
+
+// Promote copies the already packed asset of the specified version to the target environment in the configured backend.
+// The asset is not packed again, hence what is unpacked from the target environment is exactly what was tested before.
+func (i *PackkerInput) Promote(cmd *cobra.Command, args []string) error {
+	configFromFile, err := i.mergeConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(configFromFile.AssetVersion) == 0 {
+		return fmt.Errorf("version of the asset to be promoted has to be set with 'version'")
+	}
+	if len(configFromFile.PromoteTo) == 0 {
+		return fmt.Errorf("environment to which the asset has to be promoted has to be set with 'to'")
+	}
+
+	if err := configFromFile.initVersionBackend(); err != nil {
+		return err
+	}
+	defer configFromFile.Backend.Close()
+
+	object, err := configFromFile.Backend.Promote(configFromFile.PromoteTo, configFromFile.promotedBy())
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(ui.Info(fmt.Sprintf("Asset %s was promoted to %s environment\n", configFromFile.Backend.Name, configFromFile.PromoteTo)))
+	return printObjects(os.Stdout, []*backend.Object{object}, configFromFile.Output)
+}
+
+// initVersionBackend initializes the backend to look up the version of asset under Folder/Name the way it was stored while packing,
+// from the namespace of environment FromEnvironment if set.
+func (i *PackkerInput) initVersionBackend() error {
+	i.generateDefaults()
+	if len(i.Backend.Name) == 0 {
+		i.Backend.Name = i.Name
+	}
+	i.Backend.Folder = filepath.ToSlash(filepath.Join(i.Backend.Folder, i.Backend.Name))
+	i.Backend.Name = i.nameForTemp()
+	if len(i.FromEnvironment) != 0 {
+		i.Backend.Environment = i.FromEnvironment
+	}
+	return i.Backend.InitBackend()
+}
+
+func (i *PackkerInput) promotedBy() string {
+	if len(i.PromotedBy) != 0 {
+		return i.PromotedBy
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
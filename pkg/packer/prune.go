@@ -0,0 +1,38 @@
+package packer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/spf13/cobra"
+)
+
+// Prune deletes the versions of the asset from the configured backend which are not retained by the retention policy.
+func (i *PackkerInput) Prune(cmd *cobra.Command, args []string) error {
+	configFromFile, err := i.mergeConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := configFromFile.initListBackend(); err != nil {
+		return err
+	}
+	defer configFromFile.Backend.Close()
+
+	expired, err := configFromFile.Backend.Prune(configFromFile.Retention, configFromFile.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(expired) == 0 {
+		fmt.Println(ui.Info("All versions of the asset are retained by the policy, nothing to prune\n"))
+		return nil
+	}
+	if configFromFile.DryRun {
+		fmt.Println(ui.Warn(fmt.Sprintf("Dry run, following %d version(s) would be deleted\n", len(expired))))
+	} else {
+		fmt.Println(ui.Info(fmt.Sprintf("Following %d version(s) were deleted\n", len(expired))))
+	}
+	return printObjects(os.Stdout, expired, configFromFile.Output)
+}
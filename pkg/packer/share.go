@@ -0,0 +1,74 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/spf13/cobra"
+)
+
+// sharedAsset is what share reports of the asset shared through signed URL.
+type sharedAsset struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Environment string    `json:"environment"`
+	Expires     time.Time `json:"expires"`
+	URL         string    `json:"url"`
+}
+
+// Share prints the signed URL of the specified version of asset, with which it could be fetched by unpacker
+// without the credentials of backend until ShareExpiryHours elapse.
+func (i *PackkerInput) Share(cmd *cobra.Command, args []string) error {
+	configFromFile, err := i.mergeConfig()
+	if err != nil {
+		return err
+	}
+	if len(configFromFile.AssetVersion) == 0 {
+		return fmt.Errorf("version of the asset to be shared has to be set with 'version'")
+	}
+
+	if err := configFromFile.initVersionBackend(); err != nil {
+		return err
+	}
+	defer configFromFile.Backend.Close()
+	expiry := time.Duration(configFromFile.ShareExpiryHours) * time.Hour
+	if expiry <= 0 {
+		expiry = backend.DefaultSignedURLExpiry
+	}
+	signedURL, err := configFromFile.Backend.SignedURL(expiry)
+	if err != nil {
+		return err
+	}
+
+	return printShared(os.Stdout, &sharedAsset{
+		Name:        configFromFile.Backend.Name,
+		Version:     configFromFile.AssetVersion,
+		Environment: configFromFile.Backend.Environment,
+		Expires:     time.Now().Add(expiry),
+		URL:         signedURL,
+	}, configFromFile.Output)
+}
+
+// printShared writes the shared asset in the specified format, supported formats are table and json.
+func printShared(w io.Writer, shared *sharedAsset, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(shared)
+	case "table", "":
+		table := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(table, "NAME\t%s\n", shared.Name)
+		fmt.Fprintf(table, "VERSION\t%s\n", shared.Version)
+		fmt.Fprintf(table, "ENVIRONMENT\t%s\n", valueOrDash(shared.Environment))
+		fmt.Fprintf(table, "EXPIRES\t%s\n", shared.Expires.Local().Format(time.RFC3339))
+		fmt.Fprintf(table, "URL\t%s\n", shared.URL)
+		return table.Flush()
+	}
+	return fmt.Errorf("output format %s is not supported, supported formats are: table, json", format)
+}
@@ -0,0 +1,84 @@
+package packer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nikhilsbhat/neuron/cli/ui"
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/spf13/cobra"
+)
+
+// Tag moves the tags passed as arguments to the specified version of asset in the configured backend,
+// the tags are deleted instead when TagDelete is set. All the tags of the asset are listed when no tag is passed.
+func (i *PackkerInput) Tag(cmd *cobra.Command, args []string) error {
+	configFromFile, err := i.mergeConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 0 && !configFromFile.TagDelete && len(configFromFile.AssetVersion) == 0 {
+		return fmt.Errorf("version of the asset to be tagged has to be set with 'version'")
+	}
+	if err := configFromFile.initVersionBackend(); err != nil {
+		return err
+	}
+	defer configFromFile.Backend.Close()
+
+	store := configFromFile.Backend
+	switch {
+	case len(args) == 0:
+		tags, err := store.Tags()
+		if err != nil {
+			return err
+		}
+		return printTags(os.Stdout, tags, configFromFile.Output)
+	case configFromFile.TagDelete:
+		for _, name := range args {
+			if err := store.DeleteTag(name); err != nil {
+				return err
+			}
+			fmt.Println(ui.Info(fmt.Sprintf("Tag %s was deleted\n", name)))
+		}
+		return nil
+	}
+
+	tags := make([]*backend.Tag, 0, len(args))
+	for _, name := range args {
+		tag, err := store.SetTag(name, configFromFile.promotedBy())
+		if err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	fmt.Println(ui.Info(fmt.Sprintf("Asset %s was tagged\n", store.Name)))
+	return printTags(os.Stdout, tags, configFromFile.Output)
+}
+
+// printTags writes the tags in the specified format, supported formats are table and json.
+func printTags(w io.Writer, tags []*backend.Tag, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tags)
+	case "table", "":
+		table := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(table, "TAG\tVERSION\tENVIRONMENT\tTAGGED\tTAGGEDBY")
+		for _, tag := range tags {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+				tag.Name,
+				valueOrDash(tag.Version),
+				valueOrDash(tag.Environment),
+				tag.TaggedAt.Local().Format(time.RFC3339),
+				valueOrDash(tag.TaggedBy),
+			)
+		}
+		return table.Flush()
+	}
+	return fmt.Errorf("output format %s is not supported, supported formats are: table, json", format)
+}
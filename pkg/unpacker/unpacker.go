@@ -2,16 +2,20 @@
 package unpacker
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/nikhilsbhat/neuron/cli/ui"
 	"github.com/nikhilsbhat/terragen/decode"
+	"github.com/nikhilsbhat/unpackker/pkg/archive"
 	"github.com/nikhilsbhat/unpackker/pkg/backend"
 	unexec "github.com/nikhilsbhat/unpackker/pkg/exec"
+	"github.com/nikhilsbhat/unpackker/pkg/gen"
 	"github.com/nikhilsbhat/unpackker/pkg/helper"
 )
 
@@ -19,18 +23,34 @@ import (
 type UnPackkerInput struct {
 	// Name of the packed asset.
 	Name string `json:"name" yaml:"name"`
-	// StubPath refers to path where the client stub is placed.
+	// StubPath refers to path where the client stub is placed, it could as well be the unpackker archive.
 	StubPath string `json:"stubpath" yaml:"stubpath"`
 	// TargetPath refers to path where the asset has to be unpacked.
 	TargetPath string `json:"assetpath" yaml:"assetpath"`
-	// CleanStub make sure that the client stub is removed by Unpacker after successful unpacking of asset.
+	// Environment to which the asset was promoted, the asset is fetched from its namespace in the backend.
+	// Leave it empty to fetch the asset stored while packing.
+	Environment string `json:"environment" yaml:"environment"`
+	// Version is either a tag such as latest or stable, or a semver constraint such as ^1.2 which picks the highest version
+	// satisfying it. It is resolved through the backend, in which case Folder of AssetBackend has to be the one under which
+	// versions of the asset are stored and its Name need not be set.
+	Version string `json:"version" yaml:"version"`
+	// URL is the signed URL of the asset as printed by share command, from which the asset is fetched in place of AssetBackend
+	// without its credentials. AssetBackend could still be set to specify TargetPath and the keys to decrypt the asset.
+	URL string `json:"url" yaml:"url"`
+	// CleanStub make sure that the client stub or the archive is removed by Unpacker after successful unpacking of asset.
 	CleanStub bool `json:"cleanstub" yaml:"cleanstub"`
 	// Writer to be assigned so that Unpacker can logs its outputs and errors.
 	// AssetBackend for the asset generated.
 	AssetBackend *backend.Store
-	Writer       io.Writer
-	version      string
-	cmd          *unexec.ExecCmd
+	// Mirrors are the backends holding the replica of asset, they are tried in the order specified
+	// when fetching the asset from AssetBackend fails or its checksum does not match.
+	Mirrors []*backend.Store
+	// Cache holds the fetched assets locally, so that unpacking the same asset again does not download it unless it has changed
+	// in the backend. It applies to AssetBackend and Mirrors which do not have one, set Offline of it to unpack only from the cache.
+	Cache   *backend.Cache
+	Writer  io.Writer
+	version string
+	cmd     *unexec.ExecCmd
 }
 
 // NewConfig retunrns new config of UnPackkerInput.
@@ -40,18 +60,25 @@ func NewConfig() *UnPackkerInput {
 
 // Unpacker unpacks the asset onto specified path.
 func (i *UnPackkerInput) Unpacker() error {
+	return i.UnpackerWithContext(context.Background())
+}
+
+// UnpackerWithContext is Unpacker which is abandoned once ctx is done, so that the programs embedding unpacker could apply deadlines.
+// Fetching the asset is cancelled along with the partial files it left, and the client stub unpacking it is killed.
+// Asset packed as unpackker archive is unpacked in-process without running anything, see package archive.
+func (i *UnPackkerInput) UnpackerWithContext(ctx context.Context) error {
 	if err := i.validate(); err != nil {
 		return err
 	}
 
-	if err := i.fetchAsset(); err != nil {
+	if err := i.fetchAsset(ctx); err != nil {
 		return err
 	}
 
 	i.TargetPath = i.getAssetPath(i.AssetBackend.TargetPath)
 	i.cmd = i.getRootCmd()
 
-	if err := i.unpackAsset(); err != nil {
+	if err := i.unpackAsset(ctx); err != nil {
 		return err
 	}
 
@@ -91,6 +118,9 @@ func (i *UnPackkerInput) generateDefaults() {
 	if i.Writer == nil {
 		i.Writer = os.Stdout
 	}
+	if i.AssetBackend == nil {
+		i.AssetBackend = backend.New()
+	}
 	if len(i.TargetPath) == 0 {
 		i.TargetPath = "."
 	}
@@ -121,9 +151,6 @@ func (i *UnPackkerInput) initBackend() error {
 		i.AssetBackend.TargetPath = i.StubPath
 		return nil
 	}
-	if err := i.AssetBackend.InitBackend(); err != nil {
-		return err
-	}
 	if len(i.AssetBackend.TargetPath) == 0 {
 		i.AssetBackend.TargetPath = i.StubPath
 	}
@@ -135,24 +162,101 @@ func (i *UnPackkerInput) fetchAssetFromRemote() error {
 	return nil
 }
 
-func (i *UnPackkerInput) fetchAsset() error {
-	if err := i.AssetBackend.FetchAsset(); err != nil {
+func (i *UnPackkerInput) fetchAsset(ctx context.Context) error {
+	// Client stub is already available locally, hence backend is not consulted.
+	if len(i.StubPath) != 0 {
+		return nil
+	}
+	if len(i.URL) != 0 {
+		return i.fetchAssetFromURL(ctx)
+	}
+
+	stores := []*backend.Store{i.AssetBackend}
+	for _, mirror := range i.Mirrors {
+		if mirror != nil {
+			stores = append(stores, mirror)
+		}
+	}
+	name, targetPath := i.AssetBackend.Name, i.AssetBackend.TargetPath
+	if len(stores) == 1 {
+		return i.fetchAssetFrom(ctx, i.AssetBackend, name, targetPath)
+	}
+
+	failures := make([]string, 0, len(stores))
+	for _, store := range stores {
+		err := i.fetchAssetFrom(ctx, store, name, targetPath)
+		if err == nil {
+			i.AssetBackend = store
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		fmt.Println(ui.Warn(fmt.Sprintf("Fetching asset from %s failed: %v\n", store, err)))
+		failures = append(failures, fmt.Sprintf("%s: %v", store, err))
+	}
+	return fmt.Errorf("unable to fetch asset from any of the backends: %s", strings.Join(failures, "; "))
+}
+
+// fetchAssetFrom fetches the asset from the store, name and target path of the asset are taken from AssetBackend unless the store has them.
+func (i *UnPackkerInput) fetchAssetFrom(ctx context.Context, store *backend.Store, name, targetPath string) error {
+	if len(store.Name) == 0 {
+		store.Name = name
+	}
+	if len(store.TargetPath) == 0 {
+		store.TargetPath = targetPath
+	}
+
+	if len(i.Environment) != 0 {
+		store.Environment = i.Environment
+	}
+	if store.Cache == nil {
+		store.Cache = i.Cache
+	}
+	if err := store.InitBackendWithContext(ctx); err != nil {
 		return err
 	}
-	return nil
+	defer store.Close()
+	if len(i.Version) != 0 {
+		if err := store.ResolveWithContext(ctx, i.Version); err != nil {
+			return err
+		}
+		if len(i.Environment) == 0 {
+			// Tag could point at the asset promoted to an environment.
+			i.Environment = store.Environment
+		}
+	}
+	return store.FetchAssetWithContext(ctx)
 }
 
-func (i *UnPackkerInput) unpackAsset() error {
+// fetchAssetFromURL fetches the asset shared through signed URL onto target path of AssetBackend, which defaults to TargetPath.
+func (i *UnPackkerInput) fetchAssetFromURL(ctx context.Context) error {
+	if len(i.AssetBackend.TargetPath) == 0 {
+		i.AssetBackend.TargetPath = i.TargetPath
+	}
+	return i.AssetBackend.FetchURLWithContext(ctx, i.URL)
+}
+
+func (i *UnPackkerInput) unpackAsset(ctx context.Context) error {
+	if archive.IsArchive(i.AssetBackend.TargetPath) {
+		return i.extractAsset(ctx)
+	}
 	if i.cmd != nil {
 		fmt.Println(path.Dir(i.TargetPath))
 		args := append(i.cmd.Args, "generate", "--path", path.Dir(i.TargetPath))
+		if len(i.Environment) != 0 && i.stubAcceptsEnvironment() {
+			args = append(args, "--environment", i.Environment)
+		}
 		newCmd := i.cmd
 		newCmd.Args = args
-		cmd, err := newCmd.GetCmdExec()
+		cmd, err := newCmd.GetCmdExecContext(ctx)
 		if err != nil {
 			return err
 		}
 		output, err := cmd.Output()
+		if ctx.Err() != nil {
+			return fmt.Errorf("unpacking was cancelled: %v", ctx.Err())
+		}
 		if len(output) != 0 {
 			return fmt.Errorf(string(output))
 		}
@@ -164,6 +268,43 @@ func (i *UnPackkerInput) unpackAsset() error {
 	return fmt.Errorf("oops..! an error occurred while unpacking asset")
 }
 
+// stubAcceptsEnvironment tells whether the client stub could be told the environment to which asset was promoted,
+// stubs generated before it was supported would fail on being passed the flag.
+func (i *UnPackkerInput) stubAcceptsEnvironment() bool {
+	info, err := gen.ReadStubInfo(i.AssetBackend.TargetPath)
+	if err != nil {
+		return false
+	}
+	return info.HasFlag("environment")
+}
+
+// extractAsset unpacks the asset packed as unpackker archive, under the same path where the client stub would have unpacked it.
+func (i *UnPackkerInput) extractAsset(ctx context.Context) error {
+	header, err := archive.ReadHeader(i.AssetBackend.TargetPath)
+	if err != nil {
+		return err
+	}
+
+	if len(i.Environment) != 0 && i.Environment != header.Environment {
+		fmt.Println(ui.Info(fmt.Sprintf("Asset packed under %s environment was promoted to %s environment\n", header.Environment, i.Environment)))
+	} else if header.Environment == "development" {
+		fmt.Println(ui.Warn(fmt.Sprintf("Asset is packed under %s environment, pack it under production by setting 'environment' in unpackker\n", header.Environment)))
+	}
+
+	assetPath := path.Join(path.Dir(i.TargetPath), header.Name, header.Version)
+	if helper.Statfile(assetPath) {
+		return fmt.Errorf("asset %s of version %s was already unpacked at %s", header.Name, header.Version, path.Dir(i.TargetPath))
+	}
+	fmt.Println(ui.Info("unpacking the asset under"), assetPath)
+	if _, err := archive.Extract(ctx, i.AssetBackend.TargetPath, assetPath); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("unpacking was cancelled: %v", ctx.Err())
+		}
+		return err
+	}
+	return nil
+}
+
 func (i *UnPackkerInput) fetchAssetVersion() error {
 	if i.cmd != nil {
 		args := append(i.cmd.Args, "version", "-s")
@@ -0,0 +1,145 @@
+package unpacker_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikhilsbhat/unpackker/pkg/archive"
+	"github.com/nikhilsbhat/unpackker/pkg/backend"
+	"github.com/nikhilsbhat/unpackker/pkg/backend/backendtest"
+	"github.com/nikhilsbhat/unpackker/pkg/helper"
+	"github.com/nikhilsbhat/unpackker/pkg/unpacker"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "unpackker-unpacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// newTestArchive packs the file config/app.yaml as archive of version 0.1.0 of asset demo under dir and returns its path.
+func newTestArchive(t *testing.T, dir string) string {
+	t.Helper()
+	assetPath := filepath.Join(dir, "asset")
+	if err := os.MkdirAll(filepath.Join(assetPath, "config"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(assetPath, "config", "app.yaml"), []byte("port: 8080"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(dir, "demo_0_1_0")
+	header := &archive.Header{Name: "demo", Version: "0.1.0", Environment: "production"}
+	if err := archive.Create(context.Background(), archivePath, assetPath, nil, header); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+// newTestStore returns the store of backend URI for the asset demo_0_1_0, which is fetched under targetPath.
+func newTestStore(t *testing.T, uri, targetPath string) *backend.Store {
+	t.Helper()
+	store, err := backend.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Name, store.TargetPath = "demo_0_1_0", targetPath
+	return store
+}
+
+func TestUnpackerFallsBackToMirrors(t *testing.T) {
+	defer backendtest.ClearMem(t, "unpack-primary")
+	defer backendtest.ClearMem(t, "unpack-replica")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	archivePath := newTestArchive(t, dir)
+
+	// Asset in the primary backend does not match its checksum, the first mirror does not hold it and the second one does.
+	checksum, err := helper.FileChecksum(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(dir, "tampered")
+	if err := ioutil.WriteFile(tampered, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	primary := newTestStore(t, "mem://unpack-primary/assets", "")
+	if err := primary.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.Backend().Put(context.Background(), "assets/demo_0_1_0", tampered, map[string]string{backend.MetaDataChecksum: checksum}); err != nil {
+		t.Fatal(err)
+	}
+	replica := newTestStore(t, "mem://unpack-replica/assets", "")
+	replica.Path = archivePath
+	if err := replica.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	targetPath := filepath.Join(dir, "fetched")
+	input := &unpacker.UnPackkerInput{
+		AssetBackend: newTestStore(t, "mem://unpack-primary/assets", targetPath),
+		Mirrors: []*backend.Store{
+			newTestStore(t, "mem://unpack-missing/assets", ""),
+			newTestStore(t, "mem://unpack-replica/assets", ""),
+		},
+	}
+	if err := input.UnpackerWithContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(input.AssetBackend.String(), "mem://unpack-replica") {
+		t.Errorf("expected asset to be fetched from the mirror holding it, got %s", input.AssetBackend)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(targetPath, "demo", "0.1.0", "asset", "config", "app.yaml"))
+	if err != nil || string(content) != "port: 8080" {
+		t.Errorf("asset fetched from mirror was not unpacked, got %q: %v", content, err)
+	}
+
+	input = &unpacker.UnPackkerInput{
+		AssetBackend: newTestStore(t, "mem://unpack-primary/assets", filepath.Join(dir, "failed")),
+		Mirrors:      []*backend.Store{newTestStore(t, "mem://unpack-missing/assets", "")},
+	}
+	err = input.UnpackerWithContext(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "mem://unpack-primary") || !strings.Contains(err.Error(), "mem://unpack-missing") {
+		t.Fatalf("expected failure of every backend to be reported, got %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(dir, "failed")); len(entries) != 0 {
+		t.Errorf("asset which failed to be fetched was left behind")
+	}
+}
+
+func TestUnpackerStopsOnCancel(t *testing.T) {
+	defer backendtest.ClearMem(t, "unpack-primary")
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	store := newTestStore(t, "mem://unpack-primary/assets", "")
+	store.Path = newTestArchive(t, dir)
+	if err := store.InitBackend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreAsset(); err != nil {
+		t.Fatal(err)
+	}
+
+	targetPath := filepath.Join(dir, "fetched")
+	input := &unpacker.UnPackkerInput{AssetBackend: newTestStore(t, "mem://unpack-primary/assets", targetPath)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := input.UnpackerWithContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected unpacking to be abandoned, got %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(targetPath); len(entries) != 0 {
+		t.Errorf("asset of unpacking abandoned was left behind")
+	}
+}